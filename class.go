@@ -0,0 +1,91 @@
+package vdom
+
+import (
+	"strings"
+
+	"honnef.co/go/js/dom"
+)
+
+// Classes returns the classes in the class attribute of e, in the order they
+// first appear. It returns nil if e does not have a class attribute.
+func (e *Element) Classes() []string {
+	class, found := e.AttrMap()["class"]
+	if !found {
+		return nil
+	}
+	return parseClasses(class)
+}
+
+// parseClasses splits the value of a class attribute into its classes, with
+// any duplicates removed.
+func parseClasses(class string) []string {
+	classes := []string{}
+	seen := map[string]bool{}
+	for _, name := range strings.Fields(class) {
+		if !seen[name] {
+			classes = append(classes, name)
+			seen[name] = true
+		}
+	}
+	return classes
+}
+
+// diffClasses adds an AddClass patch for each class which is in otherEl but
+// not el, in the order they appear in otherEl, followed by a RemoveClass
+// patch for each class which is in el but not otherEl, in the order they
+// appear in el. Unlike setting the class attribute, this leaves any classes
+// which were added to the actual DOM by other code alone.
+func diffClasses(patches *[]Patcher, el, otherEl *Element) {
+	classes := map[string]bool{}
+	for _, class := range el.Classes() {
+		classes[class] = true
+	}
+	otherClasses := map[string]bool{}
+	for _, class := range otherEl.Classes() {
+		otherClasses[class] = true
+		if !classes[class] {
+			*patches = append(*patches, &AddClass{
+				Node:  el,
+				Class: class,
+			})
+		}
+	}
+	for _, class := range el.Classes() {
+		if !otherClasses[class] {
+			*patches = append(*patches, &RemoveClass{
+				Node:  el,
+				Class: class,
+			})
+		}
+	}
+}
+
+// AddClass is a Patcher which will add the given class to the classList of
+// the given Node. Any other classes are left alone.
+type AddClass struct {
+	Node  Node
+	Class string
+}
+
+// Patch satisfies the Patcher interface and applies the change to the
+// actual DOM.
+func (p *AddClass) Patch(root dom.Element) error {
+	self := findInDOM(p.Node, root)
+	callNodeMethod(self, "classList", "add", p.Class)
+	return nil
+}
+
+// RemoveClass is a Patcher which will remove the given class from the
+// classList of the given Node. Any other classes are left alone.
+type RemoveClass struct {
+	Node  Node
+	Class string
+}
+
+// Patch satisfies the Patcher interface and applies the change to the
+// actual DOM.
+func (p *RemoveClass) Patch(root dom.Element) error {
+	self := findInDOM(p.Node, root)
+	callNodeMethod(self, "classList", "remove", p.Class)
+	return nil
+}
@@ -0,0 +1,89 @@
+package vdom
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClasses(t *testing.T) {
+	testCases := []struct {
+		src      string
+		expected []string
+	}{
+		{`<div></div>`, nil},
+		{`<div class=""></div>`, []string{}},
+		{`<div class="todo-list-item completed"></div>`, []string{"todo-list-item", "completed"}},
+		{"<div class=\"  a\tb\n a  \"></div>", []string{"a", "b"}},
+	}
+	for _, tc := range testCases {
+		tree, err := Parse([]byte(tc.src))
+		if err != nil {
+			t.Fatalf("Unexpected error in Parse: %s", err.Error())
+		}
+		if got := tree.Children[0].(*Element).Classes(); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%s: Expected classes to be %#v but got %#v", tc.src, tc.expected, got)
+		}
+	}
+}
+
+func TestDiffGranularClass(t *testing.T) {
+	oldTree, err := Parse([]byte(`<ul><li class="todo-list-item active">one</li></ul>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newTree, err := Parse([]byte(`<ul><li class="completed  todo-list-item" id="one">one</li></ul>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	li := oldTree.Children[0].Children()[0]
+	patches, err := DiffWithOptions(oldTree, newTree, DiffOptions{GranularClass: true})
+	if err != nil {
+		t.Fatalf("Unexpected error in DiffWithOptions: %s", err)
+	}
+	expected := PatchSet{
+		&SetAttr{Node: li, Attr: &Attr{Name: "id", Value: "one"}},
+		&AddClass{Node: li, Class: "completed"},
+		&RemoveClass{Node: li, Class: "active"},
+	}
+	if err := expectPatchSetEquals(expected, patches); err != nil {
+		t.Fatal(err)
+	}
+
+	// A class which was added by other code should be left alone.
+	root := newMemRoot(`<ul><li class="todo-list-item active">one</li></ul>`)
+	memNodeAt(root, 0, 0).SetAttribute("class", "todo-list-item active dragging")
+	if err := patches.Patch(root); err != nil {
+		t.Fatalf("Unexpected error in Patch: %s", err)
+	}
+	expectedHTML := `<ul><li class="todo-list-item dragging completed" id="one">one</li></ul>`
+	if got := root.InnerHTML(); got != expectedHTML {
+		t.Errorf("Actual DOM was not correct.\nExpected: %s\nGot:      %s", expectedHTML, got)
+	}
+
+	// Only changing the order or spacing of the classes should not need any
+	// patches.
+	reorderedTree, err := Parse([]byte(`<ul><li class="todo-list-item completed" id="one">one</li></ul>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	patches, err = DiffWithOptions(newTree, reorderedTree, DiffOptions{GranularClass: true})
+	if err != nil {
+		t.Fatalf("Unexpected error in DiffWithOptions: %s", err)
+	}
+	if len(patches) != 0 {
+		t.Errorf("Expected no patches but got %s", patchSetString(patches))
+	}
+
+	// Without the option, the whole attribute is set.
+	patches, err = Diff(oldTree, newTree)
+	if err != nil {
+		t.Fatalf("Unexpected error in Diff: %s", err)
+	}
+	expected = PatchSet{
+		&SetAttr{Node: li, Attr: &Attr{Name: "class", Value: "completed  todo-list-item"}},
+		&SetAttr{Node: li, Attr: &Attr{Name: "id", Value: "one"}},
+	}
+	if err := expectPatchSetEquals(expected, patches); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,71 @@
+// Package whitespace parses html without the text nodes which only contain
+// whitespace, for the commands which need to ignore changes to indentation.
+package whitespace
+
+import (
+	"strings"
+
+	"github.com/albrow/vdom"
+)
+
+// htmlWhitespace is the set of characters which html treats as whitespace.
+// Non-breaking spaces are not included, since the browser renders them.
+const htmlWhitespace = " \t\n\f\r"
+
+// preserved is the set of elements whose whitespace matters.
+var preserved = map[string]bool{
+	"listing":  true,
+	"pre":      true,
+	"script":   true,
+	"style":    true,
+	"textarea": true,
+	"title":    true,
+}
+
+// IsWhitespace returns true iff value only contains html whitespace.
+func IsWhitespace(value []byte) bool {
+	return strings.Trim(string(value), htmlWhitespace) == ""
+}
+
+// Parse parses src like vdom.Parse, but drops any text nodes which only
+// contain whitespace, except inside of <pre>, <textarea>, <script>, and
+// other elements where the whitespace matters.
+func Parse(src []byte) (*vdom.Tree, error) {
+	tree, err := vdom.Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	positions := positions(tree.Children)
+	if len(positions) == 0 {
+		return tree, nil
+	}
+	// Cut the whitespace out of the source and parse it again, so that the
+	// nodes have the right indexes.
+	trimmed := []byte{}
+	last := 0
+	for _, pos := range positions {
+		trimmed = append(trimmed, src[last:pos.Start.Offset]...)
+		last = pos.End.Offset
+	}
+	trimmed = append(trimmed, src[last:]...)
+	return vdom.Parse(trimmed)
+}
+
+// positions returns the positions of the text nodes in nodes (and their
+// descendants) which only contain whitespace, in source order.
+func positions(nodes []vdom.Node) []vdom.Pos {
+	result := []vdom.Pos{}
+	for _, node := range nodes {
+		switch n := node.(type) {
+		case *vdom.Text:
+			if IsWhitespace(n.Value) {
+				result = append(result, n.Pos())
+			}
+		case *vdom.Element:
+			if !preserved[strings.ToLower(n.Name)] {
+				result = append(result, positions(n.Children())...)
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,310 @@
+// Command vdom-diff prints the patches that vdom.Diff returns for two html
+// files, i.e. the operations that would be applied to the actual DOM to
+// change it from the first file to the second. It is meant for reviewing the
+// effect of a template change, or for recording patch counts.
+//
+// Usage:
+//
+//	vdom-diff [flags] old.html new.html
+//
+// The flags are:
+//
+//	-json
+//		Print the patches as JSON instead of text.
+//	-ignore-whitespace
+//		Drop text nodes which only contain whitespace (outside of <pre>,
+//		<textarea>, <script> and <style>) from both files before diffing, so
+//		that changes to indentation are not reported.
+//	-optimize
+//		Pass the patches through PatchSet.Optimize.
+//	-granular-class, -granular-style
+//		Set the corresponding fields of vdom.DiffOptions.
+//	-replace-children-ratio
+//		Set DiffOptions.ReplaceChildrenRatio.
+//
+// Diff matches children by their position, so there is no keyed mode: moving
+// an element shows up as the patches needed to change each position in turn.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/albrow/vdom"
+	"github.com/albrow/vdom/cmd/internal/whitespace"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "vdom-diff:", err)
+		os.Exit(1)
+	}
+}
+
+// run parses the flags and files named in args and writes the patches to w.
+func run(args []string, w io.Writer) error {
+	flags := flag.NewFlagSet("vdom-diff", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the patches as JSON")
+	ignoreWhitespace := flags.Bool("ignore-whitespace", false, "drop text nodes which only contain whitespace")
+	optimize := flags.Bool("optimize", false, "optimize the patches")
+	opts := vdom.DiffOptions{}
+	flags.BoolVar(&opts.GranularClass, "granular-class", false, "use AddClass and RemoveClass for changes to class")
+	flags.BoolVar(&opts.GranularStyle, "granular-style", false, "use SetStyle and RemoveStyle for changes to style")
+	flags.Float64Var(&opts.ReplaceChildrenRatio, "replace-children-ratio", 0, "see DiffOptions.ReplaceChildrenRatio")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return fmt.Errorf("expected two html files but got %d arguments", flags.NArg())
+	}
+	trees := make([]*vdom.Tree, 2)
+	for i, filename := range flags.Args() {
+		tree, err := parseFile(filename, *ignoreWhitespace)
+		if err != nil {
+			return err
+		}
+		trees[i] = tree
+	}
+	patches, err := vdom.DiffWithOptions(trees[0], trees[1], opts)
+	if err != nil {
+		return err
+	}
+	if *optimize {
+		patches = patches.Optimize()
+	}
+	if *asJSON {
+		return writeJSON(w, patches)
+	}
+	return writeText(w, patches)
+}
+
+// parseFile parses the html in the file with the given name. If
+// ignoreWhitespace is true, text nodes which only contain whitespace are
+// removed.
+func parseFile(filename string, ignoreWhitespace bool) (*vdom.Tree, error) {
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	parse := vdom.Parse
+	if ignoreWhitespace {
+		parse = whitespace.Parse
+	}
+	tree, err := parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+	return tree, nil
+}
+
+// patchInfo is a readable description of a single patch.
+type patchInfo struct {
+	Type  string `json:"type"`
+	Index []int  `json:"index"`
+	// Name is the name of the attribute, property, class, style property, or
+	// type of event listener.
+	Name string `json:"name,omitempty"`
+	// Value is the new value of the attribute, property, style property, or
+	// text.
+	Value string `json:"value,omitempty"`
+	// OldHTML and HTML are the html of the nodes which are removed and
+	// added.
+	OldHTML string `json:"oldHTML,omitempty"`
+	HTML    string `json:"html,omitempty"`
+	// Patches are the patches inside of a HeadPatch or BodyPatch.
+	Patches []patchInfo `json:"patches,omitempty"`
+}
+
+// describe returns a readable description of patch.
+func describe(patch vdom.Patcher) patchInfo {
+	info := patchInfo{Type: strings.TrimPrefix(fmt.Sprintf("%T", patch), "*vdom.")}
+	switch p := patch.(type) {
+	case *vdom.Append:
+		info.Index = p.Child.Index()
+		info.HTML = string(p.Child.HTML())
+	case *vdom.Insert:
+		info.Index = p.Child.Index()
+		info.HTML = string(p.Child.HTML())
+	case *vdom.Replace:
+		info.Index = p.Old.Index()
+		info.OldHTML = string(p.Old.HTML())
+		info.HTML = string(p.New.HTML())
+	case *vdom.Remove:
+		info.Index = p.Node.Index()
+		info.OldHTML = string(p.Node.HTML())
+	case *vdom.RemoveRange:
+		info.Index = p.Nodes[0].Index()
+		info.OldHTML = nodesHTML(p.Nodes)
+	case *vdom.ReplaceChildren:
+		if p.Parent != nil {
+			info.Index = p.Parent.Index()
+		}
+		info.HTML = nodesHTML(p.Children)
+	case *vdom.SetAttr:
+		info.Index = p.Node.Index()
+		info.Name = p.Attr.Name
+		info.Value = p.Attr.Value
+	case *vdom.RemoveAttr:
+		info.Index = p.Node.Index()
+		info.Name = p.AttrName
+	case *vdom.SetText:
+		info.Index = p.Node.Index()
+		info.Value = string(p.Value)
+	case *vdom.SetComment:
+		info.Index = p.Node.Index()
+		info.Value = string(p.Value)
+	case *vdom.SetProperty:
+		info.Index = p.Node.Index()
+		info.Name = p.Name
+		info.Value = fmt.Sprint(p.Value)
+	case *vdom.SetListener:
+		info.Index = p.Node.Index()
+		info.Name = p.Listener.Type
+	case *vdom.RemoveListener:
+		info.Index = p.Node.Index()
+		info.Name = p.Type
+	case *vdom.AddClass:
+		info.Index = p.Node.Index()
+		info.Name = p.Class
+	case *vdom.RemoveClass:
+		info.Index = p.Node.Index()
+		info.Name = p.Class
+	case *vdom.SetStyle:
+		info.Index = p.Node.Index()
+		info.Name = p.Style.Property
+		info.Value = p.Style.String()
+	case *vdom.RemoveStyle:
+		info.Index = p.Node.Index()
+		info.Name = p.Property
+	case *vdom.SetTitle:
+		info.Value = p.Title
+	case *vdom.HeadPatch:
+		info.Patches = describeAll(p.Patches)
+	case *vdom.BodyPatch:
+		info.Patches = describeAll(p.Patches)
+	}
+	if info.Index == nil {
+		info.Index = []int{}
+	}
+	return info
+}
+
+// describeAll returns a readable description of each of the patches.
+func describeAll(patches vdom.PatchSet) []patchInfo {
+	infos := make([]patchInfo, len(patches))
+	for i, patch := range patches {
+		infos[i] = describe(patch)
+	}
+	return infos
+}
+
+// nodesHTML returns the html for all of the nodes.
+func nodesHTML(nodes []vdom.Node) string {
+	result := ""
+	for _, node := range nodes {
+		result += string(node.HTML())
+	}
+	return result
+}
+
+// counts returns the number of patches of each type, including the patches
+// inside of a HeadPatch or BodyPatch.
+func counts(infos []patchInfo) map[string]int {
+	result := map[string]int{}
+	for _, info := range infos {
+		result[info.Type]++
+		for typ, count := range counts(info.Patches) {
+			result[typ] += count
+		}
+	}
+	return result
+}
+
+// total returns the number of patches, including the patches inside of a
+// HeadPatch or BodyPatch.
+func total(infos []patchInfo) int {
+	result := 0
+	for _, count := range counts(infos) {
+		result += count
+	}
+	return result
+}
+
+// writeText writes one line for each patch, followed by the number of
+// patches of each type. The patches inside of a HeadPatch or BodyPatch are
+// indented below it.
+func writeText(w io.Writer, patches vdom.PatchSet) error {
+	infos := describeAll(patches)
+	if err := writeLines(w, infos, ""); err != nil {
+		return err
+	}
+	typeCounts := counts(infos)
+	types := make([]string, 0, len(typeCounts))
+	for typ := range typeCounts {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+	summary := fmt.Sprintf("%d patches", total(infos))
+	for i, typ := range types {
+		if i == 0 {
+			summary += ": "
+		} else {
+			summary += ", "
+		}
+		summary += fmt.Sprintf("%d %s", typeCounts[typ], typ)
+	}
+	_, err := fmt.Fprintln(w, summary)
+	return err
+}
+
+// writeLines writes one line for each of the infos, starting with indent.
+func writeLines(w io.Writer, infos []patchInfo, indent string) error {
+	for _, info := range infos {
+		line := fmt.Sprintf("%s%s %v", indent, info.Type, info.Index)
+		if info.Name != "" {
+			line += " " + info.Name
+		}
+		if info.Value != "" {
+			line += fmt.Sprintf(" %q", info.Value)
+		}
+		if info.OldHTML != "" {
+			line += " - " + info.OldHTML
+		}
+		if info.HTML != "" {
+			line += " + " + info.HTML
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+		if err := writeLines(w, info.Patches, indent+"\t"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeJSON writes the patches and the number of patches of each type as
+// JSON.
+func writeJSON(w io.Writer, patches vdom.PatchSet) error {
+	infos := describeAll(patches)
+	data, err := json.MarshalIndent(struct {
+		Patches []patchInfo    `json:"patches"`
+		Count   int            `json:"count"`
+		Counts  map[string]int `json:"counts"`
+	}{
+		Patches: infos,
+		Count:   total(infos),
+		Counts:  counts(infos),
+	}, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/albrow/vdom"
+)
+
+// writeFiles writes oldHTML and newHTML to temporary files and returns their
+// names.
+func writeFiles(t *testing.T, oldHTML, newHTML string) (string, string) {
+	dir, err := ioutil.TempDir("", "vdom-diff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldFile := filepath.Join(dir, "old.html")
+	newFile := filepath.Join(dir, "new.html")
+	if err := ioutil.WriteFile(oldFile, []byte(oldHTML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(newFile, []byte(newHTML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return oldFile, newFile
+}
+
+func TestRunText(t *testing.T) {
+	oldFile, newFile := writeFiles(t,
+		`<ul class="todos"><li>one</li><li>two</li></ul>`,
+		`<ul class="todos done"><li>one</li><li>dos</li><li>three</li></ul>`,
+	)
+	defer os.RemoveAll(filepath.Dir(oldFile))
+	testCases := []struct {
+		name     string
+		flags    []string
+		expected string
+	}{
+		{
+			name:  "default",
+			flags: nil,
+			expected: `SetAttr [0] class "todos done"
+Append [0 2] + <li>three</li>
+SetText [0 1 0] "dos"
+3 patches: 1 Append, 1 SetAttr, 1 SetText
+`,
+		},
+		{
+			name:  "granular class",
+			flags: []string{"-granular-class"},
+			expected: `AddClass [0] done
+Append [0 2] + <li>three</li>
+SetText [0 1 0] "dos"
+3 patches: 1 AddClass, 1 Append, 1 SetText
+`,
+		},
+	}
+	for _, tc := range testCases {
+		buf := bytes.NewBuffer(nil)
+		if err := run(append(tc.flags, oldFile, newFile), buf); err != nil {
+			t.Errorf("%s: Unexpected error: %s", tc.name, err.Error())
+			continue
+		}
+		if got := buf.String(); got != tc.expected {
+			t.Errorf("%s: Output was not correct.\nExpected:\n%s\nGot:\n%s", tc.name, tc.expected, got)
+		}
+	}
+}
+
+func TestRunJSON(t *testing.T) {
+	oldFile, newFile := writeFiles(t, `<div><p>one</p></div>`, `<div><span>one</span></div>`)
+	defer os.RemoveAll(filepath.Dir(oldFile))
+	buf := bytes.NewBuffer(nil)
+	if err := run([]string{"-json", oldFile, newFile}, buf); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	var got struct {
+		Patches []patchInfo
+		Count   int
+		Counts  map[string]int
+	}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("Unexpected error decoding JSON: %s\n%s", err.Error(), buf.String())
+	}
+	if got.Count != 1 || got.Counts["Replace"] != 1 {
+		t.Errorf("Expected 1 Replace patch but got %s", buf.String())
+	}
+	if len(got.Patches) == 1 && (got.Patches[0].OldHTML != "<p>one</p>" || got.Patches[0].HTML != "<span>one</span>") {
+		t.Errorf("Replace patch was not correct: %#v", got.Patches[0])
+	}
+}
+
+func TestRunIgnoreWhitespace(t *testing.T) {
+	oldFile, newFile := writeFiles(t,
+		"<ul><li>one</li><li>two</li></ul><pre> x </pre>",
+		"<ul>\n  <li>one</li>\n  <li>two</li>\n</ul>\n<pre> x </pre>",
+	)
+	defer os.RemoveAll(filepath.Dir(oldFile))
+	buf := bytes.NewBuffer(nil)
+	if err := run([]string{"-ignore-whitespace", oldFile, newFile}, buf); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if got := buf.String(); got != "0 patches\n" {
+		t.Errorf("Expected no patches but got:\n%s", got)
+	}
+	buf.Reset()
+	if err := run([]string{oldFile, newFile}, buf); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if buf.String() == "0 patches\n" {
+		t.Error("Expected patches for the whitespace without -ignore-whitespace")
+	}
+}
+
+func TestWriteTextNested(t *testing.T) {
+	oldDoc, err := vdom.ParseDocument([]byte(`<title>Old</title><p>one</p>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newDoc, err := vdom.ParseDocument([]byte(`<title>New</title><p>uno</p>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	patches, err := vdom.DiffDocument(oldDoc, newDoc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	patches = append(patches, &vdom.SetTitle{Title: "New"})
+	buf := bytes.NewBuffer(nil)
+	if err := writeText(buf, patches); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	expected := `HeadPatch []
+	SetText [0 0] "New"
+BodyPatch []
+	SetText [0 0] "uno"
+SetTitle [] "New"
+5 patches: 1 BodyPatch, 1 HeadPatch, 2 SetText, 1 SetTitle
+`
+	if got := buf.String(); got != expected {
+		t.Errorf("Output was not correct.\nExpected:\n%s\nGot:\n%s", expected, got)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	if err := run([]string{"only-one.html"}, ioutil.Discard); err == nil {
+		t.Error("Expected an error for a single argument but got none")
+	}
+	if err := run([]string{"missing.html", "missing.html"}, ioutil.Discard); err == nil {
+		t.Error("Expected an error for a missing file but got none")
+	}
+}
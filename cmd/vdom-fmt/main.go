@@ -0,0 +1,293 @@
+// Command vdom-fmt formats html files and html templates, so that template
+// diffs in code review only show real changes. It uses the same parser as
+// vdom, and writes the result with Tree.WriteIndentedHTML: attribute values
+// are double-quoted, boolean attributes and void elements are written
+// without values or slashes, and children are indented wherever that does
+// not change how the browser renders them.
+//
+// Before writing anything, vdom-fmt parses the formatted html again and
+// checks that it is the same as the original with Tree.Compare, ignoring
+// text nodes which only contain whitespace. It also checks that there is
+// whitespace next to each inline node in the formatted html exactly where
+// there was in the original, since that changes how the browser renders it.
+// If either check fails, the file is left alone and vdom-fmt reports an
+// error.
+//
+// Usage:
+//
+//	vdom-fmt [flags] [files]
+//
+// Without any files, vdom-fmt formats its standard input. The flags are:
+//
+//	-w
+//		Write the result back to each file instead of printing it.
+//	-l
+//		Only list the files whose formatting would change.
+//	-indent
+//		The string to indent with (default a tab).
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/albrow/vdom"
+	"github.com/albrow/vdom/cmd/internal/whitespace"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "vdom-fmt:", err)
+		os.Exit(1)
+	}
+}
+
+// run parses the flags in args and formats the files they name, or r if
+// there are none, writing any output to w.
+func run(args []string, r io.Reader, w io.Writer) error {
+	flags := flag.NewFlagSet("vdom-fmt", flag.ContinueOnError)
+	write := flags.Bool("w", false, "write the result to the file instead of printing it")
+	list := flags.Bool("l", false, "list the files whose formatting would change")
+	indent := flags.String("indent", "\t", "the string to indent with")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		if *write {
+			return fmt.Errorf("can not use -w with standard input")
+		}
+		src, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		formatted, err := format(src, *indent)
+		if err != nil {
+			return fmt.Errorf("<standard input>: %s", err)
+		}
+		if *list {
+			if !bytes.Equal(src, formatted) {
+				_, err = fmt.Fprintln(w, "<standard input>")
+			}
+			return err
+		}
+		_, err = w.Write(formatted)
+		return err
+	}
+	for _, filename := range flags.Args() {
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		formatted, err := format(src, *indent)
+		if err != nil {
+			return fmt.Errorf("%s: %s", filename, err)
+		}
+		changed := !bytes.Equal(src, formatted)
+		if *list && changed {
+			if _, err := fmt.Fprintln(w, filename); err != nil {
+				return err
+			}
+		}
+		if *write && changed {
+			info, err := os.Stat(filename)
+			if err != nil {
+				return err
+			}
+			if err := ioutil.WriteFile(filename, formatted, info.Mode().Perm()); err != nil {
+				return err
+			}
+		}
+		if !*list && !*write {
+			if _, err := w.Write(formatted); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// format returns the formatted html for src, after checking that it is the
+// same as src except for whitespace between nodes.
+func format(src []byte, indent string) ([]byte, error) {
+	tree, err := vdom.Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(nil)
+	if err := tree.WriteIndentedHTML(buf, indent); err != nil {
+		return nil, err
+	}
+	original, err := whitespace.Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	formatted, err := whitespace.Parse(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("could not parse the formatted html: %s", err)
+	}
+	if match, msg := original.Compare(formatted, true); !match {
+		return nil, fmt.Errorf("formatting would change the html: %s", msg)
+	}
+	reparsed, err := vdom.Parse(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("could not parse the formatted html: %s", err)
+	}
+	if err := checkInlineWhitespace(nil, tree.Children, reparsed.Children); err != nil {
+		return nil, fmt.Errorf("formatting would change the html: %s", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// blockElements is the set of html elements which the browser does not
+// render inline. It is the same as the set which vdom uses when formatting.
+var blockElements = map[string]bool{
+	"address":    true,
+	"article":    true,
+	"aside":      true,
+	"base":       true,
+	"blockquote": true,
+	"body":       true,
+	"caption":    true,
+	"col":        true,
+	"colgroup":   true,
+	"dd":         true,
+	"details":    true,
+	"dialog":     true,
+	"div":        true,
+	"dl":         true,
+	"dt":         true,
+	"fieldset":   true,
+	"figcaption": true,
+	"figure":     true,
+	"footer":     true,
+	"form":       true,
+	"h1":         true,
+	"h2":         true,
+	"h3":         true,
+	"h4":         true,
+	"h5":         true,
+	"h6":         true,
+	"head":       true,
+	"header":     true,
+	"hgroup":     true,
+	"hr":         true,
+	"html":       true,
+	"li":         true,
+	"link":       true,
+	"main":       true,
+	"menu":       true,
+	"meta":       true,
+	"nav":        true,
+	"noscript":   true,
+	"ol":         true,
+	"optgroup":   true,
+	"option":     true,
+	"p":          true,
+	"script":     true,
+	"section":    true,
+	"style":      true,
+	"summary":    true,
+	"table":      true,
+	"tbody":      true,
+	"td":         true,
+	"template":   true,
+	"tfoot":      true,
+	"th":         true,
+	"thead":      true,
+	"title":      true,
+	"tr":         true,
+	"ul":         true,
+}
+
+// checkInlineWhitespace returns an error if there is whitespace next to an
+// inline node in formatted where there was none in original, or the other
+// way around. original and formatted are the children of parent (which is
+// nil for the first-level children of a tree) before and after formatting,
+// and must be the same apart from text which only contains whitespace.
+func checkInlineWhitespace(parent *vdom.Element, original, formatted []vdom.Node) error {
+	originalNodes, originalSpaced := spacing(original)
+	formattedNodes, formattedSpaced := spacing(formatted)
+	if len(originalNodes) != len(formattedNodes) {
+		return fmt.Errorf("expected %d nodes but got %d", len(originalNodes), len(formattedNodes))
+	}
+	for i := range originalSpaced {
+		if originalSpaced[i] == formattedSpaced[i] {
+			continue
+		}
+		if parent == nil && (i == 0 || i == len(originalNodes)) {
+			// Whitespace before or after the whole tree does not matter.
+			continue
+		}
+		if before := nearestRendered(originalNodes[:i], -1); before != nil && isInline(before) {
+			return fmt.Errorf("the whitespace after %s would change", nodeName(before))
+		}
+		if after := nearestRendered(originalNodes[i:], 1); after != nil && isInline(after) {
+			return fmt.Errorf("the whitespace before %s would change", nodeName(after))
+		}
+	}
+	for i, node := range originalNodes {
+		if el, ok := node.(*vdom.Element); ok {
+			if err := checkInlineWhitespace(el, el.Children(), formattedNodes[i].Children()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// spacing returns the nodes which are not text that only contains
+// whitespace, along with whether there is whitespace before each of them
+// and after the last one.
+func spacing(nodes []vdom.Node) ([]vdom.Node, []bool) {
+	result := []vdom.Node{}
+	spaced := []bool{false}
+	for _, node := range nodes {
+		if text, ok := node.(*vdom.Text); ok && whitespace.IsWhitespace(text.Value) {
+			spaced[len(spaced)-1] = true
+			continue
+		}
+		result = append(result, node)
+		spaced = append(spaced, false)
+	}
+	return result, spaced
+}
+
+// nearestRendered returns the first node in nodes which is not a comment,
+// starting from the end if step is negative, or nil if there is none.
+func nearestRendered(nodes []vdom.Node, step int) vdom.Node {
+	i, end := 0, len(nodes)
+	if step < 0 {
+		i, end = len(nodes)-1, -1
+	}
+	for ; i != end; i += step {
+		if _, ok := nodes[i].(*vdom.Comment); !ok {
+			return nodes[i]
+		}
+	}
+	return nil
+}
+
+// isInline returns true iff the browser renders node inline, so that
+// whitespace next to it is shown as a space.
+func isInline(node vdom.Node) bool {
+	switch n := node.(type) {
+	case *vdom.Text:
+		return true
+	case *vdom.Element:
+		return n.Namespace != "" || !blockElements[strings.ToLower(n.Name)]
+	}
+	return false
+}
+
+// nodeName returns a short description of node for error messages.
+func nodeName(node vdom.Node) string {
+	if el, ok := node.(*vdom.Element); ok {
+		return fmt.Sprintf("<%s> at line %d", el.Name, el.Pos().Start.Line)
+	}
+	return fmt.Sprintf("text at line %d", node.Pos().Start.Line)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/albrow/vdom"
+)
+
+const (
+	unformatted = "<ul class='todos'>\n<li>one</li>\n    <li><input type=checkbox checked=checked/> two</li></ul>\n"
+	formatted   = "<ul class=\"todos\">\n\t<li>one</li>\n\t<li><input type=\"checkbox\" checked> two</li>\n</ul>\n"
+)
+
+// writeFile writes src to a file in a temporary directory and returns its
+// name.
+func writeFile(t *testing.T, src string) string {
+	dir, err := ioutil.TempDir("", "vdom-fmt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, "todos.tmpl")
+	if err := ioutil.WriteFile(filename, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestRunStdin(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	if err := run(nil, strings.NewReader(unformatted), buf); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if got := buf.String(); got != formatted {
+		t.Errorf("Output was not correct.\nExpected:\n%s\nGot:\n%s", formatted, got)
+	}
+	buf.Reset()
+	if err := run([]string{"-indent", "  "}, strings.NewReader(unformatted), buf); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	expected := strings.Replace(formatted, "\t", "  ", -1)
+	if got := buf.String(); got != expected {
+		t.Errorf("Output with -indent was not correct.\nExpected:\n%s\nGot:\n%s", expected, got)
+	}
+}
+
+func TestRunFiles(t *testing.T) {
+	filename := writeFile(t, unformatted)
+	defer os.RemoveAll(filepath.Dir(filename))
+
+	buf := bytes.NewBuffer(nil)
+	if err := run([]string{"-l", filename}, nil, buf); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if got := buf.String(); got != filename+"\n" {
+		t.Errorf("Expected -l to list %s but got %q", filename, got)
+	}
+
+	buf.Reset()
+	if err := run([]string{"-w", filename}, nil, buf); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Expected -w not to print anything but got %q", buf.String())
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); got != formatted {
+		t.Errorf("File was not formatted.\nExpected:\n%s\nGot:\n%s", formatted, got)
+	}
+
+	// Now that the file is formatted, -l should not list it.
+	buf.Reset()
+	if err := run([]string{"-l", filename}, nil, buf); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Expected -l not to list a formatted file but got %q", buf.String())
+	}
+}
+
+func TestRunWhitespace(t *testing.T) {
+	testCases := []struct {
+		name     string
+		src      string
+		expected string
+	}{
+		{
+			name:     "newline after void element",
+			src:      "<form>\n<input>\n<br>\n</form>",
+			expected: "<form>\n\t<input>\n\t<br>\n</form>\n",
+		},
+		{
+			name:     "whitespace between only some inline elements",
+			src:      "<p><b>x</b> <i>y</i><b>z</b></p>",
+			expected: "<p><b>x</b> <i>y</i><b>z</b></p>\n",
+		},
+		{
+			name:     "non-breaking space",
+			src:      "<div>\n<p>&nbsp;</p>\n</div>",
+			expected: "<div>\n\t<p>&nbsp;</p>\n</div>\n",
+		},
+	}
+	for _, tc := range testCases {
+		buf := bytes.NewBuffer(nil)
+		if err := run(nil, strings.NewReader(tc.src), buf); err != nil {
+			t.Errorf("%s: Unexpected error: %s", tc.name, err.Error())
+			continue
+		}
+		if got := buf.String(); got != tc.expected {
+			t.Errorf("%s: Output was not correct.\nExpected: %q\nGot:      %q", tc.name, tc.expected, got)
+		}
+	}
+}
+
+func TestCheckInlineWhitespace(t *testing.T) {
+	original, err := vdom.Parse([]byte("<p><b>x</b> <i>y</i><b>z</b></p>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	indented, err := vdom.Parse([]byte("<p>\n\t<b>x</b>\n\t<i>y</i>\n\t<b>z</b>\n</p>\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkInlineWhitespace(nil, original.Children, indented.Children); err == nil {
+		t.Error("Expected an error for added whitespace between inline elements but got none")
+	}
+	blocks, err := vdom.Parse([]byte("<ul><li>one</li><!-- two --><li>three</li></ul>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	indentedBlocks, err := vdom.Parse([]byte("<ul>\n\t<li>one</li>\n\t<!-- two -->\n\t<li>three</li>\n</ul>\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkInlineWhitespace(nil, blocks.Children, indentedBlocks.Children); err != nil {
+		t.Errorf("Unexpected error for added whitespace between block elements: %s", err.Error())
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	if err := run([]string{"-w"}, strings.NewReader(unformatted), ioutil.Discard); err == nil {
+		t.Error("Expected an error for -w with standard input but got none")
+	}
+	if err := run([]string{"missing.html"}, nil, ioutil.Discard); err == nil {
+		t.Error("Expected an error for a missing file but got none")
+	}
+	if err := run(nil, strings.NewReader("<div><p>one</span></div>"), ioutil.Discard); err == nil {
+		t.Error("Expected an error for invalid html but got none")
+	}
+}
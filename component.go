@@ -0,0 +1,308 @@
+package vdom
+
+import (
+	"honnef.co/go/js/dom"
+)
+
+// Component is a view which can render itself as a virtual tree. Typically
+// Render executes a template and parses the result with Parse. Render should
+// return a new tree each time it is called, since the nodes for embedded
+// components are added to it. Components are compared with ==, so they should
+// be comparable (e.g. a pointer to a struct) and each component should only
+// be embedded once per render.
+type Component interface {
+	Render() (*Tree, error)
+}
+
+// Mounter is implemented by components which need to know when their nodes
+// are first added to the actual DOM.
+type Mounter interface {
+	Mounted()
+}
+
+// Updater is implemented by components which need to know when a patch has
+// changed any of their nodes in the actual DOM.
+type Updater interface {
+	Updated()
+}
+
+// Unmounter is implemented by components which need to know when their nodes
+// are about to be removed from the actual DOM.
+type Unmounter interface {
+	Unmounting()
+}
+
+// Embed makes e the host for the component c. Whenever the tree containing e
+// is rendered by a Root, the children of e are replaced with the nodes
+// rendered by c. This is how you nest components: the parent component
+// calls Embed on an element in the tree it renders.
+func (e *Element) Embed(c Component) {
+	e.component = c
+}
+
+// componentHost is a component along with the element it was rendered into.
+// host is nil for the component that was mounted at the root.
+type componentHost struct {
+	component Component
+	host      *Element
+}
+
+// Root owns the actual DOM for a mounted component. It remembers the tree
+// from the last render so that each new render only needs to apply the
+// differences, and it calls the lifecycle methods of the component and any
+// components embedded in it.
+type Root struct {
+	// OnError is called with any error that occurs during a render which was
+	// scheduled with Invalidate. If OnError is nil, the error causes a panic.
+	OnError func(error)
+	// Scheduler decides when to render after Invalidate is called. If it is
+	// nil, DefaultScheduler is used.
+	Scheduler  *Scheduler
+	root       dom.Element
+	component  Component
+	tree       *Tree
+	hosts      []componentHost
+	dispatcher *Dispatcher
+}
+
+// Mount renders c into root, replacing anything that was already there, and
+// returns a Root which can be used to render c again. Mount also creates a
+// Dispatcher for root, so any Listeners in the rendered trees are called.
+func Mount(root dom.Element, c Component) (*Root, error) {
+	root.SetInnerHTML("")
+	r := &Root{
+		root:      root,
+		component: c,
+		tree:      &Tree{},
+	}
+	r.dispatcher = NewDispatcher(root, r.tree)
+	if err := r.Render(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// MountHydrated is like Mount, but instead of replacing what is already in
+// root, it expects root to already contain the html for c (e.g. because it
+// was rendered on the server with WriteHTML) and adopts it with Hydrate. If
+// the actual DOM does not match what c renders, it returns the error from
+// Hydrate and leaves root unchanged, in which case you can fall back to
+// Mount.
+func MountHydrated(root dom.Element, c Component) (*Root, error) {
+	r := &Root{
+		root:      root,
+		component: c,
+		tree:      &Tree{},
+	}
+	tree, hosts, err := r.render()
+	if err != nil {
+		return nil, err
+	}
+	if err := Hydrate(root, tree); err != nil {
+		return nil, err
+	}
+	r.tree = tree
+	r.hosts = hosts
+	r.dispatcher = NewDispatcher(root, tree)
+	mounted := make([]Component, len(hosts))
+	for i, host := range hosts {
+		mounted[i] = host.component
+	}
+	callMounted(mounted)
+	return r, nil
+}
+
+// Tree returns the tree from the last render, including the nodes for all
+// embedded components.
+func (r *Root) Tree() *Tree {
+	return r.tree
+}
+
+// Render immediately renders the component again and patches the actual
+// DOM to match. Components which are no longer embedded have Unmounting
+// called before the patches are applied. Afterwards, new components have
+// Mounted called and components whose nodes were changed by a patch have
+// Updated called. Embedded components are notified before the components
+// they are embedded in.
+func (r *Root) Render() error {
+	newTree, newHosts, err := r.render()
+	if err != nil {
+		return err
+	}
+	patches, err := Diff(r.tree, newTree)
+	if err != nil {
+		return err
+	}
+	mounted := []Component{}
+	updated := []Component{}
+	for _, old := range r.hosts {
+		newHost, found := findHost(newHosts, old.component)
+		switch {
+		case !found:
+			unmounting(old.component)
+		case isDiscardedBy(patches, old.host):
+			// The nodes for the component are replaced, so as far as the actual
+			// DOM is concerned, it is unmounted and then mounted again.
+			unmounting(old.component)
+			mounted = append(mounted, newHost.component)
+		case isTouchedBy(patches, old.host):
+			updated = append(updated, newHost.component)
+		}
+	}
+	for _, newHost := range newHosts {
+		if _, found := findHost(r.hosts, newHost.component); !found {
+			mounted = append(mounted, newHost.component)
+		}
+	}
+	if err := patches.Patch(r.root); err != nil {
+		return err
+	}
+	r.tree = newTree
+	r.hosts = newHosts
+	r.dispatcher.SetTree(newTree)
+	callMounted(mounted)
+	// Notify embedded components first by going through them backwards.
+	for i := len(updated) - 1; i >= 0; i-- {
+		if u, ok := updated[i].(Updater); ok {
+			u.Updated()
+		}
+	}
+	return nil
+}
+
+// Invalidate schedules the component to be rendered again on the next frame
+// using the Scheduler for r. Calling Invalidate several times before the
+// render happens only causes a single render.
+func (r *Root) Invalidate() {
+	r.scheduler().Invalidate(r)
+}
+
+// scheduler returns the Scheduler for r.
+func (r *Root) scheduler() *Scheduler {
+	if r.Scheduler == nil {
+		return DefaultScheduler
+	}
+	return r.Scheduler
+}
+
+// Unmount calls Unmounting for every component, removes the rendered nodes
+// from the actual DOM and stops dispatching events. r should not be used
+// after calling Unmount.
+func (r *Root) Unmount() {
+	r.scheduler().cancel(r)
+	for _, host := range r.hosts {
+		unmounting(host.component)
+	}
+	r.dispatcher.Close()
+	r.root.SetInnerHTML("")
+	r.tree = &Tree{}
+	r.hosts = nil
+}
+
+// render renders the component for r and all the components embedded in it.
+// It returns the resulting tree along with the host of each component in the
+// order they were rendered.
+func (r *Root) render() (*Tree, []componentHost, error) {
+	tree, err := r.component.Render()
+	if err != nil {
+		return nil, nil, err
+	}
+	hosts := []componentHost{{component: r.component}}
+	for _, child := range tree.Children {
+		if err := renderEmbedded(child, &hosts); err != nil {
+			return nil, nil, err
+		}
+	}
+	return tree, hosts, nil
+}
+
+// renderEmbedded renders any components embedded in node or its descendants
+// and adds the resulting nodes to the tree.
+func renderEmbedded(node Node, hosts *[]componentHost) error {
+	el, ok := node.(*Element)
+	if !ok {
+		return nil
+	}
+	if el.component != nil {
+		*hosts = append(*hosts, componentHost{component: el.component, host: el})
+		tree, err := el.component.Render()
+		if err != nil {
+			return err
+		}
+		el.setChildren(tree.Children)
+	}
+	for _, child := range el.children {
+		if err := renderEmbedded(child, hosts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findHost returns the host for the given component.
+func findHost(hosts []componentHost, c Component) (componentHost, bool) {
+	for _, host := range hosts {
+		if host.component == c {
+			return host, true
+		}
+	}
+	return componentHost{}, false
+}
+
+// callMounted calls Mounted for each of the components which is a Mounter.
+// The components should be in the order they were rendered. Embedded
+// components are notified first by going through them backwards.
+func callMounted(components []Component) {
+	for i := len(components) - 1; i >= 0; i-- {
+		if m, ok := components[i].(Mounter); ok {
+			m.Mounted()
+		}
+	}
+}
+
+// unmounting calls Unmounting if c is an Unmounter.
+func unmounting(c Component) {
+	if u, ok := c.(Unmounter); ok {
+		u.Unmounting()
+	}
+}
+
+// isDiscardedBy returns true iff any of the patches removes host (or one of
+// its ancestors) from the actual DOM. It is always false for the root.
+func isDiscardedBy(patches PatchSet, host *Element) bool {
+	if host == nil {
+		return false
+	}
+	for _, patch := range patches {
+		if discardsInside(patch, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTouchedBy returns true iff any of the patches changes the nodes inside
+// of host. If host is nil, i.e. the root, any patch counts.
+func isTouchedBy(patches PatchSet, host *Element) bool {
+	if host == nil {
+		return len(patches) > 0
+	}
+	for _, patch := range patches {
+		switch p := patch.(type) {
+		case *Append, *ReplaceChildren:
+			// These change the children of their target.
+			if isInside(patchTarget(p), host, true) {
+				return true
+			}
+		case *RemoveRange:
+			if isInside(p.Nodes[0], host, false) {
+				return true
+			}
+		default:
+			if isInside(patchTarget(p), host, false) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,178 @@
+package vdom
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// testApp is a component which embeds a testChild inside of a host element.
+type testApp struct {
+	title   string
+	hostTag string
+	child   *testChild
+	log     *[]string
+}
+
+func (a *testApp) Render() (*Tree, error) {
+	tree, err := Parse([]byte(fmt.Sprintf("<div><h1>%s</h1><%s></%s></div>", a.title, a.hostTag, a.hostTag)))
+	if err != nil {
+		return nil, err
+	}
+	if a.child != nil {
+		tree.Children[0].Children()[1].(*Element).Embed(a.child)
+	}
+	return tree, nil
+}
+
+func (a *testApp) Mounted()    { *a.log = append(*a.log, "app mounted") }
+func (a *testApp) Updated()    { *a.log = append(*a.log, "app updated") }
+func (a *testApp) Unmounting() { *a.log = append(*a.log, "app unmounting") }
+
+// testChild is a component which renders a single paragraph.
+type testChild struct {
+	text string
+	log  *[]string
+}
+
+func (c *testChild) Render() (*Tree, error) {
+	return Parse([]byte(fmt.Sprintf("<p>%s</p>", c.text)))
+}
+
+func (c *testChild) Mounted()    { *c.log = append(*c.log, "child mounted") }
+func (c *testChild) Updated()    { *c.log = append(*c.log, "child updated") }
+func (c *testChild) Unmounting() { *c.log = append(*c.log, "child unmounting") }
+
+func TestMount(t *testing.T) {
+	log := []string{}
+	child := &testChild{text: "one", log: &log}
+	app := &testApp{title: "Title", hostTag: "section", child: child, log: &log}
+	root := newMemRoot("<p>old content</p>")
+	r, err := Mount(root, app)
+	if err != nil {
+		t.Fatalf("Unexpected error in Mount: %s", err.Error())
+	}
+	expectHTML := func(expected string) {
+		if got := root.InnerHTML(); got != expected {
+			t.Errorf("Expected html to be %s but got %s", expected, got)
+		}
+	}
+	expectLog := func(step string, expected ...string) {
+		if len(expected) == 0 {
+			expected = []string{}
+		}
+		if !reflect.DeepEqual(log, expected) {
+			t.Errorf("%s: Expected lifecycle methods %v but got %v", step, expected, log)
+		}
+		log = []string{}
+	}
+	expectHTML("<div><h1>Title</h1><section><p>one</p></section></div>")
+	expectLog("mount", "child mounted", "app mounted")
+
+	// Changing the child only changes nodes inside of the child, but the
+	// child is also inside of the app.
+	child.text = "two"
+	if err := r.Render(); err != nil {
+		t.Fatalf("Unexpected error in Render: %s", err.Error())
+	}
+	expectHTML("<div><h1>Title</h1><section><p>two</p></section></div>")
+	expectLog("change child", "child updated", "app updated")
+
+	// Changing the app does not change any nodes inside of the child.
+	app.title = "New Title"
+	if err := r.Render(); err != nil {
+		t.Fatalf("Unexpected error in Render: %s", err.Error())
+	}
+	expectHTML("<div><h1>New Title</h1><section><p>two</p></section></div>")
+	expectLog("change app", "app updated")
+
+	// Rendering without any changes doesn't call any lifecycle methods.
+	if err := r.Render(); err != nil {
+		t.Fatalf("Unexpected error in Render: %s", err.Error())
+	}
+	expectLog("no change")
+
+	// Changing the host element means the nodes for the child are replaced.
+	app.hostTag = "article"
+	if err := r.Render(); err != nil {
+		t.Fatalf("Unexpected error in Render: %s", err.Error())
+	}
+	expectHTML("<div><h1>New Title</h1><article><p>two</p></article></div>")
+	expectLog("change host", "child unmounting", "child mounted", "app updated")
+
+	// Removing the child.
+	app.child = nil
+	if err := r.Render(); err != nil {
+		t.Fatalf("Unexpected error in Render: %s", err.Error())
+	}
+	expectHTML("<div><h1>New Title</h1><article></article></div>")
+	expectLog("remove child", "child unmounting", "app updated")
+
+	// Adding the child back.
+	app.child = child
+	if err := r.Render(); err != nil {
+		t.Fatalf("Unexpected error in Render: %s", err.Error())
+	}
+	expectHTML("<div><h1>New Title</h1><article><p>two</p></article></div>")
+	expectLog("add child", "child mounted", "app updated")
+
+	r.Unmount()
+	expectHTML("")
+	expectLog("unmount", "app unmounting", "child unmounting")
+}
+
+func TestInvalidate(t *testing.T) {
+	log := []string{}
+	child := &testChild{text: "one", log: &log}
+	root := newMemRoot("")
+	r, err := Mount(root, child)
+	if err != nil {
+		t.Fatalf("Unexpected error in Mount: %s", err.Error())
+	}
+	defer r.Unmount()
+	frames := &ManualFrames{}
+	r.Scheduler = NewScheduler(frames)
+	child.text = "two"
+	r.Invalidate()
+	child.text = "three"
+	r.Invalidate()
+	if frames.Pending() != 1 {
+		t.Fatalf("Expected 1 requested frame but got %d", frames.Pending())
+	}
+	if expected, got := "<p>one</p>", root.InnerHTML(); got != expected {
+		t.Errorf("Expected Invalidate not to render right away. Expected %s but got %s", expected, got)
+	}
+	frames.Tick()
+	if expected, got := "<p>three</p>", root.InnerHTML(); got != expected {
+		t.Errorf("Expected html to be %s but got %s", expected, got)
+	}
+}
+
+func TestMountListeners(t *testing.T) {
+	clicks := 0
+	c := &listenerComponent{onClick: func(*Event) { clicks++ }}
+	root := newMemRoot("")
+	r, err := Mount(root, c)
+	if err != nil {
+		t.Fatalf("Unexpected error in Mount: %s", err.Error())
+	}
+	defer r.Unmount()
+	memNodeAt(root, 0, 0).DispatchEvent(newMemEvent("click"))
+	if clicks != 1 {
+		t.Errorf("Expected listener to be called once but got %d", clicks)
+	}
+}
+
+// listenerComponent renders a button with a click listener.
+type listenerComponent struct {
+	onClick EventHandler
+}
+
+func (c *listenerComponent) Render() (*Tree, error) {
+	tree, err := Parse([]byte("<div><button>Click</button></div>"))
+	if err != nil {
+		return nil, err
+	}
+	tree.Children[0].Children()[0].(*Element).AddEventListener("click", c.onClick)
+	return tree, nil
+}
@@ -1,14 +1,79 @@
 package vdom
 
+// DiffOptions can be used to tune the behavior of DiffWithOptions.
+type DiffOptions struct {
+	// ReplaceChildrenRatio controls when it is cheaper to replace all the
+	// children of an element at once (by setting its inner html) than to
+	// patch them one by one. For each element, the number of patches needed
+	// for its children is compared to the number of nodes in the new version
+	// of its subtree. If the number of patches divided by the number of nodes
+	// is greater than ReplaceChildrenRatio, a single ReplaceChildren patch is
+	// used instead. The default of 0 means that the children are always
+	// patched one by one.
+	ReplaceChildrenRatio float64
+	// GranularClass makes changes to the class attribute use AddClass and
+	// RemoveClass patches for the individual classes instead of a SetAttr for
+	// the whole attribute. Classes which were added to the actual DOM by
+	// other code are left alone, and CSS transitions tied to the classes
+	// which did not change are not restarted.
+	GranularClass bool
+	// GranularStyle makes changes to the style attribute use SetStyle and
+	// RemoveStyle patches for the individual declarations instead of a
+	// SetAttr for the whole attribute.
+	GranularStyle bool
+}
+
+// Diff returns the patches needed to make the actual DOM for t match
+// other. It is the same as DiffWithOptions with the default options.
 func Diff(t, other *Tree) (PatchSet, error) {
+	return DiffWithOptions(t, other, DiffOptions{})
+}
+
+// DiffWithOptions returns the patches needed to make the actual DOM for t
+// match other, using the given options.
+func DiffWithOptions(t, other *Tree, opts DiffOptions) (PatchSet, error) {
 	patches := []Patcher{}
-	if err := recursiveDiff(&patches, t.Children, other.Children); err != nil {
+	if err := diffChildren(&patches, nil, t.Children, other.Children, opts); err != nil {
 		return nil, err
 	}
 	return patches, nil
 }
 
-func recursiveDiff(patches *[]Patcher, nodes, otherNodes []Node) error {
+// diffChildren adds the patches needed to make nodes match otherNodes. nodes
+// are the children of parent, or the first-level children of the tree if
+// parent is nil. If there are enough patches that it would be cheaper to
+// replace all of the children at once, it adds a single ReplaceChildren
+// patch instead.
+func diffChildren(patches *[]Patcher, parent *Element, nodes, otherNodes []Node, opts DiffOptions) error {
+	childPatches := []Patcher{}
+	if err := recursiveDiff(&childPatches, nodes, otherNodes, opts); err != nil {
+		return err
+	}
+	if opts.ReplaceChildrenRatio > 0 && len(childPatches) > 0 {
+		cost := float64(len(childPatches))
+		if cost > opts.ReplaceChildrenRatio*float64(subtreeSize(otherNodes)) {
+			*patches = append(*patches, &ReplaceChildren{
+				Parent:   parent,
+				Children: otherNodes,
+			})
+			return nil
+		}
+	}
+	*patches = append(*patches, childPatches...)
+	return nil
+}
+
+// subtreeSize returns the number of nodes in nodes, including all of
+// their descendants.
+func subtreeSize(nodes []Node) int {
+	size := len(nodes)
+	for _, node := range nodes {
+		size += subtreeSize(node.Children())
+	}
+	return size
+}
+
+func recursiveDiff(patches *[]Patcher, nodes, otherNodes []Node, opts DiffOptions) error {
 	numOtherNodes := len(otherNodes)
 	numNodes := len(nodes)
 	minNumNodes := numOtherNodes
@@ -24,10 +89,13 @@ func recursiveDiff(patches *[]Patcher, nodes, otherNodes []Node) error {
 		minNumNodes = numNodes
 	} else if numNodes > numOtherNodes {
 		// There are more nodes than there are otherNodes.
-		// We should remove the additional children.
-		for _, node := range nodes[numOtherNodes:] {
+		// We should remove the additional children. They are removed starting
+		// from the last one, so that removing one does not change the index of
+		// the others. This matters for first-level children, which have no
+		// parent whose children can be updated.
+		for i := numNodes - 1; i >= numOtherNodes; i-- {
 			*patches = append(*patches, &Remove{
-				Node: node,
+				Node: nodes[i],
 			})
 		}
 		minNumNodes = numOtherNodes
@@ -36,12 +104,8 @@ func recursiveDiff(patches *[]Patcher, nodes, otherNodes []Node) error {
 		otherNode := otherNodes[i]
 		node := nodes[i]
 		if match, _ := CompareNodes(node, otherNode, false); !match {
-			// The nodes have different tag names or values. We should replace
-			// node with otherNode
-			*patches = append(*patches, &Replace{
-				Old: node,
-				New: otherNode,
-			})
+			// The nodes have different types, tag names or values.
+			*patches = append(*patches, changeNode(node, otherNode))
 			continue
 		}
 		// NOTE: Since CompareNodes checks the type,
@@ -51,32 +115,97 @@ func recursiveDiff(patches *[]Patcher, nodes, otherNodes []Node) error {
 			// Both nodes are elements. We need to treat them differently because
 			// they have children and attributes.
 			el := node.(*Element)
+			if el.Hash() == otherEl.Hash() && el.sameContents(otherEl) {
+				// The elements have the same contents, so there is nothing to
+				// do for them or anything inside of them. The hashes alone are
+				// not enough, since different elements can have the same hash.
+				continue
+			}
 			// Add the patches needed to make the attributes match (if any)
-			diffAttributes(patches, el, otherEl)
+			diffAttributes(patches, el, otherEl, opts)
+			// Add the patches needed to make the event listeners match (if any)
+			diffListeners(patches, el, otherEl)
 			// Recursively apply diff algorithm to each element's children
-			recursiveDiff(patches, el.Children(), otherEl.Children())
+			if err := diffChildren(patches, el, el.Children(), otherEl.Children(), opts); err != nil {
+				return err
+			}
+			if el.Name == "textarea" {
+				// The value of a textarea is its text content, and just like an
+				// input, we need to set the property to change what the user sees.
+				if otherContent := textContent(otherEl); textContent(el) != otherContent {
+					*patches = append(*patches, &SetProperty{
+						Node:  el,
+						Name:  "value",
+						Value: otherContent,
+					})
+				}
+			}
 		}
 	}
 	return nil
 }
 
+// changeNode returns a patch which changes node into otherNode, assuming
+// that CompareNodes has already found that they are different. Text and
+// comment nodes can have their value changed in place, but anything else
+// needs to be replaced.
+func changeNode(node, otherNode Node) Patcher {
+	switch n := node.(type) {
+	case *Text:
+		if otherText, ok := otherNode.(*Text); ok {
+			return &SetText{
+				Node:  n,
+				Value: otherText.Value,
+			}
+		}
+	case *Comment:
+		if otherComment, ok := otherNode.(*Comment); ok {
+			return &SetComment{
+				Node:  n,
+				Value: otherComment.Value,
+			}
+		}
+	}
+	// The nodes have different types or tag names. We should replace
+	// node with otherNode
+	return &Replace{
+		Old: node,
+		New: otherNode,
+	}
+}
+
 // diffAttributes compares the attributes in el to the attributes in otherEl
 // and adds the necessary patches to make the attributes in el match those in
-// otherEl
-func diffAttributes(patches *[]Patcher, el, otherEl *Element) {
-	otherAttrs := otherEl.AttrMap()
-	attrs := el.AttrMap()
-	for attrName := range attrs {
-		// Remove any attributes in el that are not found in otherEl
-		if _, found := otherAttrs[attrName]; !found {
-			*patches = append(*patches, &RemoveAttr{
-				Node:     el,
-				AttrName: attrName,
-			})
-		}
+// otherEl. The attributes which were added or changed come first, in the
+// order they appear in otherEl, followed by the attributes which were
+// removed, in the order they appear in el. If the options ask for granular
+// changes to the class or style attributes, those patches come last.
+func diffAttributes(patches *[]Patcher, el, otherEl *Element, opts DiffOptions) {
+	// Elements which were not parsed might have attributes which the browser
+	// would have normalized.
+	normalAttrs := normalizeAttrs(el.Attrs, el.Namespace)
+	normalOtherAttrs := normalizeAttrs(otherEl.Attrs, otherEl.Namespace)
+	attrs := map[string]string{}
+	for _, attr := range normalAttrs {
+		attrs[attr.Name] = attr.Value
 	}
-	// Now iterate through the attributes in otherEl
-	for name, otherValue := range otherAttrs {
+	// Iterate through the attributes in otherEl in source order, so that the
+	// patches are always in the same order.
+	seen := map[string]bool{}
+	// The class and style attributes are handled separately if the options
+	// ask for granular changes.
+	if opts.GranularClass {
+		seen["class"] = true
+	}
+	if opts.GranularStyle {
+		seen["style"] = true
+	}
+	for _, otherAttr := range normalOtherAttrs {
+		name, otherValue := otherAttr.Name, otherAttr.Value
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
 		value, found := attrs[name]
 		if !found {
 			// The attribute exists in otherEl but not in el,
@@ -88,7 +217,8 @@ func diffAttributes(patches *[]Patcher, el, otherEl *Element) {
 					Value: otherValue,
 				},
 			})
-		} else if value != otherValue {
+			diffProperty(patches, el, name, otherValue, true)
+		} else if !attrValuesEqual(el.Namespace, name, value, otherValue) {
 			// The attribute exists in el but has a different value
 			// than it does in otherEl. We should set it to the value
 			// in otherEl.
@@ -99,6 +229,75 @@ func diffAttributes(patches *[]Patcher, el, otherEl *Element) {
 					Value: otherValue,
 				},
 			})
+			diffProperty(patches, el, name, otherValue, true)
+		}
+	}
+	// Now remove any attributes in el that are not found in otherEl, also in
+	// source order.
+	for _, attr := range normalAttrs {
+		if seen[attr.Name] {
+			continue
 		}
+		seen[attr.Name] = true
+		*patches = append(*patches, &RemoveAttr{
+			Node:     el,
+			AttrName: attr.Name,
+		})
+		diffProperty(patches, el, attr.Name, "", false)
+	}
+	if opts.GranularClass {
+		diffClasses(patches, el, otherEl)
+	}
+	if opts.GranularStyle {
+		diffStyles(patches, el, otherEl)
+	}
+}
+
+// diffListeners compares the types of the Listeners in el to the types of
+// the Listeners in otherEl and adds the necessary patches to make them match.
+// It does not compare the handlers themselves, since functions can't be
+// compared and a Dispatcher always calls the handlers from the current tree.
+func diffListeners(patches *[]Patcher, el, otherEl *Element) {
+	types := map[string]bool{}
+	for _, listener := range el.Listeners {
+		types[listener.Type] = true
+	}
+	otherTypes := map[string]bool{}
+	for _, listener := range otherEl.Listeners {
+		if !types[listener.Type] && !otherTypes[listener.Type] {
+			*patches = append(*patches, &SetListener{
+				Node:     el,
+				Listener: listener,
+			})
+		}
+		otherTypes[listener.Type] = true
+	}
+	for _, listener := range el.Listeners {
+		if !otherTypes[listener.Type] {
+			*patches = append(*patches, &RemoveListener{
+				Node: el,
+				Type: listener.Type,
+			})
+			// Only remove each type once.
+			otherTypes[listener.Type] = true
+		}
+	}
+}
+
+// diffProperty adds a SetProperty patch if the attribute with the given name
+// is reflected by a property which holds the current state of el. It should
+// only be called if the attribute changed since the last render. value is
+// the new value for the attribute and found is false if it was removed.
+// Since we only compare against the last render, anything the user has
+// changed since then (e.g. by typing into an input) is left alone until the
+// attribute changes again.
+func diffProperty(patches *[]Patcher, el *Element, name string, value string, found bool) {
+	if !isPropertyAttr(el, name) {
+		return
 	}
+	*patches = append(*patches, &SetProperty{
+		Node:  el,
+		Name:  name,
+		Value: propertyValue(name, value, found),
+	})
 }
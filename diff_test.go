@@ -0,0 +1,463 @@
+package vdom
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestDiffReplaceChildren tests that DiffWithOptions falls back to replacing
+// all the children of an element when the ratio of patches to nodes is too
+// high.
+func TestDiffReplaceChildren(t *testing.T) {
+	testCases := []struct {
+		// A human-readable name describing this test case
+		name string
+		// The html for the old and new trees
+		oldHTML string
+		newHTML string
+		// The ReplaceChildrenRatio to use
+		ratio float64
+		// The number of ReplaceChildren patches we expect
+		expectedReplaceChildren int
+	}{
+		{
+			name:                    "Fallback disabled",
+			oldHTML:                 "<ul><li>one</li><li>two</li><li>three</li></ul>",
+			newHTML:                 "<ul><li>uno</li><li>dos</li><li>tres</li></ul>",
+			ratio:                   0,
+			expectedReplaceChildren: 0,
+		},
+		{
+			name:                    "Every item replaced",
+			oldHTML:                 "<ul><li>one</li><li>two</li><li>three</li></ul>",
+			newHTML:                 "<ul><p>one</p><p>two</p><p>three</p></ul>",
+			ratio:                   0.4,
+			expectedReplaceChildren: 1,
+		},
+		{
+			name:                    "One item replaced",
+			oldHTML:                 "<ul><li>one</li><li>two</li><li>three</li></ul>",
+			newHTML:                 "<ul><p>one</p><li>two</li><li>three</li></ul>",
+			ratio:                   0.4,
+			expectedReplaceChildren: 0,
+		},
+		{
+			name:                    "Root nodes changed",
+			oldHTML:                 "one<div></div>",
+			newHTML:                 "uno<span></span>",
+			ratio:                   0.4,
+			expectedReplaceChildren: 1,
+		},
+		{
+			name:                    "All children removed",
+			oldHTML:                 "<ul><li>one</li><li>two</li><li>three</li></ul>",
+			newHTML:                 "<ul></ul>",
+			ratio:                   0.4,
+			expectedReplaceChildren: 1,
+		},
+	}
+	for _, tc := range testCases {
+		oldTree, err := Parse([]byte(tc.oldHTML))
+		if err != nil {
+			t.Fatal(err)
+		}
+		newTree, err := Parse([]byte(tc.newHTML))
+		if err != nil {
+			t.Fatal(err)
+		}
+		patches, err := DiffWithOptions(oldTree, newTree, DiffOptions{ReplaceChildrenRatio: tc.ratio})
+		if err != nil {
+			t.Errorf("%s: Unexpected error in DiffWithOptions: %s", tc.name, err)
+			continue
+		}
+		gotReplaceChildren := 0
+		for _, patch := range patches {
+			if _, ok := patch.(*ReplaceChildren); ok {
+				gotReplaceChildren++
+			}
+		}
+		if gotReplaceChildren != tc.expectedReplaceChildren {
+			t.Errorf("%s: Expected %d ReplaceChildren patches but got %d", tc.name, tc.expectedReplaceChildren, gotReplaceChildren)
+		}
+		// Apply the patches to an in-memory DOM and check the result
+		root := newMemRoot(tc.oldHTML)
+		if err := patches.Patch(root); err != nil {
+			t.Errorf("%s: Unexpected error in Patch: %s", tc.name, err)
+			continue
+		}
+		if root.InnerHTML() != tc.newHTML {
+			t.Errorf("%s: Expected inner html to be %s but got %s", tc.name, tc.newHTML, root.InnerHTML())
+		}
+	}
+}
+
+// TestDiffSetText tests that Diff changes the values of text and comment
+// nodes in place instead of replacing them.
+// TestDiffHashCollision tests that Diff does not skip elements which have
+// the same hash but different contents, whether the hashes collide or one of
+// them is stale.
+func TestDiffHashCollision(t *testing.T) {
+	tree, err := Parse([]byte(`<ul><li class="a">one</li></ul>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newTree, err := Parse([]byte(`<ul><li class="a">uno</li></ul>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Pretend that the hashes of the two lists collide.
+	ul, otherUl := tree.Children[0].(*Element), newTree.Children[0].(*Element)
+	ul.hash, ul.hashed = 42, true
+	otherUl.hash, otherUl.hashed = 42, true
+	patches, err := Diff(tree, newTree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, expected := patchSetString(patches), "[*vdom.SetText]"; got != expected {
+		t.Errorf("Patches for colliding hashes were not correct. Expected %s but got %s", expected, got)
+	}
+
+	// Change the attributes of an element after its hash is cached.
+	tree, err = Parse([]byte(`<ul><li class="a">one</li></ul>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newTree, err = Parse([]byte(`<ul><li class="a">one</li></ul>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newTree.Children[0].(*Element).Hash()
+	newTree.Children[0].Children()[0].(*Element).Attrs[0].Value = "b"
+	patches, err = Diff(tree, newTree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, expected := patchSetString(patches), `[SetAttr(class="b")]`; got != expected {
+		t.Errorf("Patches for a stale hash were not correct. Expected %s but got %s", expected, got)
+	}
+}
+
+// TestDiffRemoves tests that Diff removes extra nodes starting from the last
+// one, and that the patches have the right effect for first-level nodes,
+// whose siblings are not reindexed by Remove.
+func TestDiffRemoves(t *testing.T) {
+	testCases := []struct {
+		src      string
+		otherSrc string
+	}{
+		{
+			src:      "<ul><li>one</li><li>two</li><li>three</li></ul>",
+			otherSrc: "<ul><li>one</li></ul>",
+		},
+		{
+			src:      "<li>one</li><li>two</li><li>three</li><!--four-->",
+			otherSrc: "<li>one</li>",
+		},
+	}
+	for _, tc := range testCases {
+		tree, err := Parse([]byte(tc.src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		other, err := Parse([]byte(tc.otherSrc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		patches, err := Diff(tree, other)
+		if err != nil {
+			t.Fatal(err)
+		}
+		last := -1
+		for _, patch := range patches {
+			remove, ok := patch.(*Remove)
+			if !ok {
+				t.Fatalf("Expected only Remove patches for %s but got %s", tc.src, patchSetString(patches))
+			}
+			index := remove.Node.Index()
+			if last != -1 && index[len(index)-1] != last-1 {
+				t.Errorf("Expected Remove patches for %s to go from the last node to the first but got index %v after %d", tc.src, index, last)
+			}
+			last = index[len(index)-1]
+		}
+		root := newMemRoot(tc.src)
+		if err := patches.Patch(root); err != nil {
+			t.Fatalf("Unexpected error in Patch for %s: %s", tc.src, err.Error())
+		}
+		if root.InnerHTML() != tc.otherSrc {
+			t.Errorf("Actual DOM was not correct.\nExpected: %s\nGot:      %s", tc.otherSrc, root.InnerHTML())
+		}
+	}
+}
+
+func TestDiffSetText(t *testing.T) {
+	oldHTML := "<div>one<!--two--></div>"
+	newHTML := "<div>uno<!--dos--></div>"
+	oldTree, err := Parse([]byte(oldHTML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newTree, err := Parse([]byte(newHTML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	patches, err := Diff(oldTree, newTree)
+	if err != nil {
+		t.Fatalf("Unexpected error in Diff: %s", err)
+	}
+	if len(patches) != 2 {
+		t.Fatalf("Expected 2 patches but got %d", len(patches))
+	}
+	if _, ok := patches[0].(*SetText); !ok {
+		t.Errorf("Expected patches[0] to be a SetText but got %T", patches[0])
+	}
+	if _, ok := patches[1].(*SetComment); !ok {
+		t.Errorf("Expected patches[1] to be a SetComment but got %T", patches[1])
+	}
+	// Apply the patches to an in-memory DOM and check that the nodes were
+	// changed in place.
+	root := newMemRoot(oldHTML)
+	div := root.children[0]
+	text, comment := div.children[0], div.children[1]
+	if err := patches.Patch(root); err != nil {
+		t.Fatalf("Unexpected error in Patch: %s", err)
+	}
+	if root.InnerHTML() != newHTML {
+		t.Errorf("Expected inner html to be %s but got %s", newHTML, root.InnerHTML())
+	}
+	if div.children[0] != text || div.children[1] != comment {
+		t.Error("Expected the text and comment nodes to be changed in place, but they were replaced")
+	}
+}
+
+// TestDiffProperties tests that Diff sets the properties which hold the
+// current state of form controls when the corresponding attributes change.
+func TestDiffProperties(t *testing.T) {
+	testCases := []struct {
+		// A human-readable name describing this test case
+		name string
+		// The html for the old and new trees
+		oldHTML string
+		newHTML string
+		// The properties we expect to be set on the element in the actual DOM.
+		expectedProps map[string]interface{}
+	}{
+		{
+			name:          "Input value changed",
+			oldHTML:       `<input type="text" value="foo">`,
+			newHTML:       `<input type="text" value="bar">`,
+			expectedProps: map[string]interface{}{"value": "bar"},
+		},
+		{
+			name:          "Input value unchanged",
+			oldHTML:       `<input type="text" value="foo">`,
+			newHTML:       `<input type="text" value="foo">`,
+			expectedProps: nil,
+		},
+		{
+			name:          "Checkbox checked",
+			oldHTML:       `<input type="checkbox">`,
+			newHTML:       `<input type="checkbox" checked>`,
+			expectedProps: map[string]interface{}{"checked": true},
+		},
+		{
+			name:          "Checkbox unchecked",
+			oldHTML:       `<input type="checkbox" checked>`,
+			newHTML:       `<input type="checkbox">`,
+			expectedProps: map[string]interface{}{"checked": false},
+		},
+		{
+			name:          "Indeterminate is not a property attribute",
+			oldHTML:       `<input type="checkbox">`,
+			newHTML:       `<input type="checkbox" indeterminate>`,
+			expectedProps: nil,
+		},
+		{
+			name:          "Option selected",
+			oldHTML:       `<option value="1">One</option>`,
+			newHTML:       `<option value="1" selected>One</option>`,
+			expectedProps: map[string]interface{}{"selected": true},
+		},
+		{
+			name:          "Textarea content changed",
+			oldHTML:       `<textarea>foo</textarea>`,
+			newHTML:       `<textarea>bar</textarea>`,
+			expectedProps: map[string]interface{}{"value": "bar"},
+		},
+		{
+			name:          "Checked written differently",
+			oldHTML:       `<input type="checkbox" checked>`,
+			newHTML:       `<input type="checkbox" checked="checked">`,
+			expectedProps: nil,
+		},
+		{
+			name:          "Video muted",
+			oldHTML:       `<video src="a.mp4"></video>`,
+			newHTML:       `<video src="a.mp4" muted></video>`,
+			expectedProps: map[string]interface{}{"muted": true},
+		},
+		{
+			name:          "Value attribute on a div",
+			oldHTML:       `<div value="foo"></div>`,
+			newHTML:       `<div value="bar"></div>`,
+			expectedProps: nil,
+		},
+	}
+	for _, tc := range testCases {
+		// Wrap each element in a div, since the parser can't handle an
+		// autoclosed tag at the very end of the html.
+		oldHTML := "<div>" + tc.oldHTML + "</div>"
+		newHTML := "<div>" + tc.newHTML + "</div>"
+		oldTree, err := Parse([]byte(oldHTML))
+		if err != nil {
+			t.Fatal(err)
+		}
+		newTree, err := Parse([]byte(newHTML))
+		if err != nil {
+			t.Fatal(err)
+		}
+		patches, err := Diff(oldTree, newTree)
+		if err != nil {
+			t.Errorf("%s: Unexpected error in Diff: %s", tc.name, err)
+			continue
+		}
+		root := newMemRoot(oldHTML)
+		if err := patches.Patch(root); err != nil {
+			t.Errorf("%s: Unexpected error in Patch: %s", tc.name, err)
+			continue
+		}
+		if gotProps := root.children[0].children[0].props; !reflect.DeepEqual(gotProps, tc.expectedProps) {
+			t.Errorf("%s: Expected properties to be %v but got %v", tc.name, tc.expectedProps, gotProps)
+		}
+	}
+}
+
+// TestDiffAttributesOrder tests that Diff always returns the patches for
+// attributes in the same order: added or changed attributes in the order of
+// the new element, followed by removed attributes in the order of the old
+// element.
+func TestDiffAttributesOrder(t *testing.T) {
+	oldTree, err := Parse([]byte(`<div id="a" class="b" title="c" lang="d" dir="e"></div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newTree, err := Parse([]byte(`<div role="f" lang="g" id="a" data-x="h" class="i"></div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	div := oldTree.Children[0]
+	expected := PatchSet{
+		&SetAttr{Node: div, Attr: &Attr{Name: "role", Value: "f"}},
+		&SetAttr{Node: div, Attr: &Attr{Name: "lang", Value: "g"}},
+		&SetAttr{Node: div, Attr: &Attr{Name: "data-x", Value: "h"}},
+		&SetAttr{Node: div, Attr: &Attr{Name: "class", Value: "i"}},
+		&RemoveAttr{Node: div, AttrName: "title"},
+		&RemoveAttr{Node: div, AttrName: "dir"},
+	}
+	// Map iteration order is random, so diff a few times to make sure the
+	// order does not depend on it.
+	for i := 0; i < 20; i++ {
+		patches, err := Diff(oldTree, newTree)
+		if err != nil {
+			t.Fatalf("Unexpected error in Diff: %s", err)
+		}
+		if err := expectPatchSetEquals(expected, patches); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// expectPatchSetEquals returns an error if got does not have exactly the
+// same patches as expected, in the same order. Each patch is compared with
+// expectPatchEquals.
+func expectPatchSetEquals(expected, got PatchSet) error {
+	if len(expected) != len(got) {
+		return fmt.Errorf("Expected %d patches but got %d: %s", len(expected), len(got), patchSetString(got))
+	}
+	for i := range expected {
+		if err := expectPatchEquals(expected[i], got[i]); err != nil {
+			return fmt.Errorf("patches[%d] was not correct: %s", i, err)
+		}
+	}
+	return nil
+}
+
+// patchSetString returns a readable summary of patches for error messages.
+func patchSetString(patches PatchSet) string {
+	parts := make([]string, len(patches))
+	for i, patch := range patches {
+		switch p := patch.(type) {
+		case *SetAttr:
+			parts[i] = fmt.Sprintf("SetAttr(%s=%q)", p.Attr.Name, p.Attr.Value)
+		case *RemoveAttr:
+			parts[i] = fmt.Sprintf("RemoveAttr(%s)", p.AttrName)
+		case *AddClass:
+			parts[i] = fmt.Sprintf("AddClass(%s)", p.Class)
+		case *RemoveClass:
+			parts[i] = fmt.Sprintf("RemoveClass(%s)", p.Class)
+		case *SetStyle:
+			parts[i] = fmt.Sprintf("SetStyle(%s)", p.Style)
+		case *RemoveStyle:
+			parts[i] = fmt.Sprintf("RemoveStyle(%s)", p.Property)
+		default:
+			parts[i] = fmt.Sprintf("%T", patch)
+		}
+	}
+	return "[" + strings.Join(parts, " ") + "]"
+}
+
+// TestDiffBooleanAttrs tests that Diff only cares whether boolean attributes
+// are present, and not what their values are.
+func TestDiffBooleanAttrs(t *testing.T) {
+	oldTree, err := Parse([]byte(`<form><input disabled="" required><button hidden>Go</button></form>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newTree, err := Parse([]byte(`<form><input DISABLED="disabled" required="required"><button>Go</button></form>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	button := oldTree.Children[0].Children()[1]
+	patches, err := Diff(oldTree, newTree)
+	if err != nil {
+		t.Fatalf("Unexpected error in Diff: %s", err)
+	}
+	expected := PatchSet{
+		&RemoveAttr{Node: button, AttrName: "hidden"},
+	}
+	if err := expectPatchSetEquals(expected, patches); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestDiffHiddenUntilFound tests that hidden is not treated as a boolean
+// attribute, since hidden="until-found" lets the browser show the element
+// when it is searched for.
+func TestDiffHiddenUntilFound(t *testing.T) {
+	oldTree, err := Parse([]byte(`<div hidden>Details</div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newTree, err := Parse([]byte(`<div hidden="until-found">Details</div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if match, _ := oldTree.Compare(newTree, true); match {
+		t.Error("Expected hidden and hidden=\"until-found\" to be different")
+	}
+	oldEl, newEl := oldTree.Children[0].(*Element), newTree.Children[0].(*Element)
+	if oldEl.Hash() == newEl.Hash() {
+		t.Error("Expected hidden and hidden=\"until-found\" to have different hashes")
+	}
+	patches, err := Diff(oldTree, newTree)
+	if err != nil {
+		t.Fatalf("Unexpected error in Diff: %s", err)
+	}
+	expected := PatchSet{
+		&SetAttr{Node: oldEl, Attr: &Attr{Name: "hidden", Value: "until-found"}},
+	}
+	if err := expectPatchSetEquals(expected, patches); err != nil {
+		t.Fatal(err)
+	}
+}
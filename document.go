@@ -0,0 +1,264 @@
+package vdom
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	"honnef.co/go/js/dom"
+)
+
+// Document is a virtual html document. Unlike a Tree, which is rendered
+// inside of some root element, a Document always has an <html> element
+// with a <head> and a <body>, just like the actual document in the browser.
+// The contents of the head and body are kept in separate trees, so the
+// indexes of their nodes start at document.head and document.body. This
+// lets you manage the head (e.g. the title and meta tags) from go with the
+// same Diff and Patch pipeline you use for the body.
+type Document struct {
+	// Doctype is the doctype of the document, or nil if it does not have
+	// one.
+	Doctype *Doctype
+	// Attrs are the attributes of the <html> element.
+	Attrs []Attr
+	// Head holds the children of the <head> element.
+	Head *Tree
+	// Body holds the children of the <body> element.
+	Body *Tree
+}
+
+// headElements is the set of elements which the browser puts into the head
+// if they come before any content for the body.
+var headElements = map[string]bool{
+	"base":     true,
+	"link":     true,
+	"meta":     true,
+	"noscript": true,
+	"script":   true,
+	"style":    true,
+	"template": true,
+	"title":    true,
+}
+
+// ParseDocument parses src as a whole html document. Just like the browser,
+// it does not require the <html>, <head>, or <body> tags. If they are
+// missing, any <title>, <meta>, <link>, <style>, <script>, or <base>
+// elements before the first content for the body go into the head and
+// everything else goes into the body. Once the head has started, comments
+// and whitespace go into the head until it ends, like they do in the
+// browser. Comments and whitespace outside of the head and body are dropped,
+// since patches never need to change them.
+func ParseDocument(src []byte) (*Document, error) {
+	tree, err := ParseFragment(src, nil)
+	if err != nil {
+		return nil, err
+	}
+	doc := &Document{}
+	nodes := []Node{}
+	for _, child := range tree.Children {
+		switch n := child.(type) {
+		case *Doctype:
+			if doc.Doctype == nil && len(nodes) == 0 {
+				doc.Doctype = n
+			}
+		case *Element:
+			if strings.EqualFold(n.Name, "html") {
+				doc.Attrs = append(doc.Attrs, n.Attrs...)
+				nodes = append(nodes, n.children...)
+			} else {
+				nodes = append(nodes, n)
+			}
+		default:
+			nodes = append(nodes, n)
+		}
+	}
+	headNodes, bodyNodes := []Node{}, []Node{}
+	inBody := false
+	// headStarted is true once there is a <head> or an element which starts
+	// an implied head. inImpliedHead is true while the implied head is open.
+	headStarted, inImpliedHead := false, false
+	for _, node := range nodes {
+		el, isElement := node.(*Element)
+		switch {
+		case isElement && strings.EqualFold(el.Name, "head") && !inBody:
+			headStarted, inImpliedHead = true, false
+			headNodes = append(headNodes, el.children...)
+		case isElement && strings.EqualFold(el.Name, "body"):
+			inBody = true
+			bodyNodes = append(bodyNodes, el.children...)
+		case isElement && headElements[strings.ToLower(el.Name)] && !inBody:
+			if !headStarted {
+				headStarted, inImpliedHead = true, true
+			}
+			headNodes = append(headNodes, el)
+		case !inBody && isWhitespaceOrComment(node):
+			if inImpliedHead {
+				headNodes = append(headNodes, node)
+			}
+			// Otherwise the browser drops whitespace outside of the head and
+			// body.
+		default:
+			inBody = true
+			bodyNodes = append(bodyNodes, node)
+		}
+	}
+	doc.Head = newModifiedTree(headNodes)
+	doc.Body = newModifiedTree(bodyNodes)
+	return doc, nil
+}
+
+// isWhitespaceOrComment returns true iff node is a comment or a text node
+// which only contains whitespace.
+func isWhitespaceOrComment(node Node) bool {
+	switch n := node.(type) {
+	case *Comment:
+		return true
+	case *Text:
+		return len(bytes.Trim(n.Value, htmlWhitespace)) == 0
+	}
+	return false
+}
+
+// newModifiedTree returns a new tree with the given first-level children,
+// which may come from a different tree. The tree does not have any source,
+// so its html is built from the nodes.
+func newModifiedTree(children []Node) *Tree {
+	tree := &Tree{
+		Children: children,
+		modified: true,
+	}
+	for i, child := range children {
+		setPosition(child, nil, []int{i})
+	}
+	return tree
+}
+
+// Title returns the text of the first <title> element in the head, or an
+// empty string if there is none.
+func (d *Document) Title() string {
+	for _, child := range d.Head.Children {
+		if el, ok := child.(*Element); ok && strings.EqualFold(el.Name, "title") {
+			return textContent(el)
+		}
+	}
+	return ""
+}
+
+// HTML returns the html for the whole document, including the <html>,
+// <head>, and <body> tags.
+func (d *Document) HTML() []byte {
+	result := []byte{}
+	if d.Doctype != nil {
+		result = append(result, d.Doctype.HTML()...)
+	}
+	result = append(result, []byte("<html")...)
+	for _, attr := range d.Attrs {
+		result = append(result, []byte(attrHTML("", attr))...)
+	}
+	result = append(result, []byte("><head>")...)
+	result = append(result, d.Head.HTML()...)
+	result = append(result, []byte("</head><body>")...)
+	result = append(result, d.Body.HTML()...)
+	return append(result, []byte("</body></html>")...)
+}
+
+// WriteHTML writes the escaped html for the whole document to w. See
+// Tree.WriteHTML.
+func (d *Document) WriteHTML(w io.Writer) error {
+	hw := &htmlWriter{w: w}
+	if d.Doctype != nil {
+		hw.writeNode(d.Doctype)
+	}
+	hw.write("<html")
+	for _, attr := range d.Attrs {
+		hw.writeAttr("", attr)
+	}
+	hw.write("><head>")
+	hw.writeChildren(nil, d.Head.Children)
+	hw.write("</head><body>")
+	hw.writeChildren(nil, d.Body.Children)
+	hw.write("</body></html>")
+	return hw.err
+}
+
+// DiffDocument returns the patches needed to change the actual document from
+// document to other. Changes to the head are wrapped in a HeadPatch and
+// changes to the body are wrapped in a BodyPatch, so the root which is
+// passed to Patch is not used. DiffDocument does not change the doctype or
+// the attributes of the <html> element.
+func DiffDocument(document, other *Document) (PatchSet, error) {
+	patches := PatchSet{}
+	headPatches, err := Diff(document.Head, other.Head)
+	if err != nil {
+		return nil, err
+	}
+	if len(headPatches) > 0 {
+		patches = append(patches, &HeadPatch{Patches: headPatches})
+	}
+	bodyPatches, err := Diff(document.Body, other.Body)
+	if err != nil {
+		return nil, err
+	}
+	if len(bodyPatches) > 0 {
+		patches = append(patches, &BodyPatch{Patches: bodyPatches})
+	}
+	return patches, nil
+}
+
+// documentHead and documentBody return the head and body of the actual
+// document. They can be swapped out for an in-memory implementation when
+// running pure go tests.
+var (
+	documentHead = func() dom.Element {
+		return document.(dom.HTMLDocument).Head()
+	}
+	documentBody = func() dom.Element {
+		return document.(dom.HTMLDocument).Body()
+	}
+)
+
+// setDocumentTitle sets the title of the actual document. It can be swapped
+// out when running pure go tests.
+var setDocumentTitle = func(title string) {
+	document.(dom.HTMLDocument).SetTitle(title)
+}
+
+// HeadPatch is a Patcher which applies Patches to document.head instead of
+// the given root. The Patches should come from diffing the Head of two
+// Documents.
+type HeadPatch struct {
+	Patches PatchSet
+}
+
+// Patch satisfies the Patcher interface and applies the change to the
+// actual DOM.
+func (p *HeadPatch) Patch(root dom.Element) error {
+	return p.Patches.Patch(documentHead())
+}
+
+// BodyPatch is a Patcher which applies Patches to document.body instead of
+// the given root. The Patches should come from diffing the Body of two
+// Documents.
+type BodyPatch struct {
+	Patches PatchSet
+}
+
+// Patch satisfies the Patcher interface and applies the change to the
+// actual DOM.
+func (p *BodyPatch) Patch(root dom.Element) error {
+	return p.Patches.Patch(documentBody())
+}
+
+// SetTitle is a Patcher which sets document.title. The browser changes the
+// text of the <title> element in the head, or creates one if there is none.
+// The given root is not used.
+type SetTitle struct {
+	Title string
+}
+
+// Patch satisfies the Patcher interface and applies the change to the
+// actual DOM.
+func (p *SetTitle) Patch(root dom.Element) error {
+	setDocumentTitle(p.Title)
+	return nil
+}
@@ -0,0 +1,180 @@
+package vdom
+
+import (
+	"bytes"
+	"testing"
+
+	"honnef.co/go/js/dom"
+)
+
+func TestParseDocumentStructure(t *testing.T) {
+	testCases := []struct {
+		name         string
+		src          string
+		expectedHead string
+		expectedBody string
+		expectedHTML string
+	}{
+		{
+			name:         "explicit tags",
+			src:          "<!DOCTYPE html>\n<html lang=\"en\">\n<head><title>Home</title><meta name=\"description\" content=\"home page\"></head>\n<body><p>Hello</p></body>\n</html>",
+			expectedHead: `<title>Home</title><meta name="description" content="home page">`,
+			// Just like the browser, whitespace after the body goes into the body.
+			expectedBody: "<p>Hello</p>\n",
+			expectedHTML: "<!DOCTYPE html><html lang=\"en\"><head><title>Home</title><meta name=\"description\" content=\"home page\"></head><body><p>Hello</p>\n</body></html>",
+		},
+		{
+			name: "implied tags",
+			src:  "<title>Home</title>\n<link rel=\"icon\" href=\"/icon.png\">\n<p>Hello</p><meta name=\"late\"><p>World</p>",
+			// Just like the browser, whitespace after the title and link is
+			// part of the implied head.
+			expectedHead: "<title>Home</title>\n<link rel=\"icon\" href=\"/icon.png\">\n",
+			expectedBody: `<p>Hello</p><meta name="late"><p>World</p>`,
+			expectedHTML: "<html><head><title>Home</title>\n<link rel=\"icon\" href=\"/icon.png\">\n</head><body><p>Hello</p><meta name=\"late\"><p>World</p></body></html>",
+		},
+		{
+			name:         "empty head",
+			src:          "<div><table><tr><td>one</td></tr></table></div>",
+			expectedHead: "",
+			expectedBody: "<div><table><tbody><tr><td>one</td></tr></tbody></table></div>",
+			expectedHTML: "<html><head></head><body><div><table><tbody><tr><td>one</td></tr></tbody></table></div></body></html>",
+		},
+	}
+	for _, tc := range testCases {
+		doc, err := ParseDocument([]byte(tc.src))
+		if err != nil {
+			t.Errorf("%s: Unexpected error in ParseDocument: %s", tc.name, err.Error())
+			continue
+		}
+		if got := string(doc.Head.HTML()); got != tc.expectedHead {
+			t.Errorf("%s: Head was not correct.\nExpected: %s\nGot:      %s", tc.name, tc.expectedHead, got)
+		}
+		if got := string(doc.Body.HTML()); got != tc.expectedBody {
+			t.Errorf("%s: Body was not correct.\nExpected: %s\nGot:      %s", tc.name, tc.expectedBody, got)
+		}
+		if got := string(doc.HTML()); got != tc.expectedHTML {
+			t.Errorf("%s: HTML was not correct.\nExpected: %s\nGot:      %s", tc.name, tc.expectedHTML, got)
+		}
+		buf := bytes.NewBuffer(nil)
+		if err := doc.WriteHTML(buf); err != nil {
+			t.Errorf("%s: Unexpected error in WriteHTML: %s", tc.name, err.Error())
+		} else if buf.String() != tc.expectedHTML {
+			t.Errorf("%s: WriteHTML was not correct.\nExpected: %s\nGot:      %s", tc.name, tc.expectedHTML, buf.String())
+		}
+		expectCorrectIndexes(t, tc.name, doc.Head.Children, []int{})
+		expectCorrectIndexes(t, tc.name, doc.Body.Children, []int{})
+	}
+}
+
+// TestParseDocumentImpliedHead tests that an implied head has the same
+// whitespace and comments as the same head written explicitly, like it does
+// in the browser.
+func TestParseDocumentImpliedHead(t *testing.T) {
+	implied, err := ParseDocument([]byte("<!DOCTYPE html>\n<!-- before -->\n<title>Home</title>\n<!-- c -->\n<meta charset=\"utf-8\">\n<p>Hello</p>"))
+	if err != nil {
+		t.Fatalf("Unexpected error in ParseDocument: %s", err.Error())
+	}
+	explicit, err := ParseDocument([]byte("<!DOCTYPE html>\n<html><head><title>Home</title>\n<!-- c -->\n<meta charset=\"utf-8\">\n</head><body><p>Hello</p></body></html>"))
+	if err != nil {
+		t.Fatalf("Unexpected error in ParseDocument: %s", err.Error())
+	}
+	if match, msg := explicit.Head.Compare(implied.Head, true); !match {
+		t.Errorf("Implied head was not the same as the explicit head.\n%s\nExplicit: %s\nImplied:  %s", msg, explicit.Head.HTML(), implied.Head.HTML())
+	}
+	if match, msg := explicit.Body.Compare(implied.Body, true); !match {
+		t.Errorf("Implied body was not the same as the explicit body.\n%s", msg)
+	}
+	// The comment is the third node in both heads, so patches for it would
+	// find it in the actual head.
+	if _, ok := implied.Head.Children[2].(*Comment); !ok {
+		t.Errorf("Expected the third node in the head to be a comment but got %T", implied.Head.Children[2])
+	}
+}
+
+func TestDocumentTitle(t *testing.T) {
+	doc, err := ParseDocument([]byte("<head><meta charset=\"utf-8\"><title>Home &amp; Away</title></head><body></body>"))
+	if err != nil {
+		t.Fatalf("Unexpected error in ParseDocument: %s", err.Error())
+	}
+	if got := doc.Title(); got != "Home & Away" {
+		t.Errorf("Expected title to be %q but got %q", "Home & Away", got)
+	}
+}
+
+// withMemDocument replaces the head and body of the actual document with
+// in-memory nodes while f runs.
+func withMemDocument(head, body *memNode, f func()) {
+	oldHead, oldBody := documentHead, documentBody
+	documentHead = func() dom.Element { return head }
+	documentBody = func() dom.Element { return body }
+	defer func() {
+		documentHead, documentBody = oldHead, oldBody
+	}()
+	f()
+}
+
+func TestDiffDocument(t *testing.T) {
+	src := `<head><meta name="description" content="home page"><title>Home</title></head><body><h1>Home</h1></body>`
+	doc, err := ParseDocument([]byte(src))
+	if err != nil {
+		t.Fatalf("Unexpected error in ParseDocument: %s", err.Error())
+	}
+	head := newMemRoot(string(doc.Head.HTML()))
+	body := newMemRoot(string(doc.Body.HTML()))
+	newSrc := `<head><meta name="description" content="about page"><title>About</title><link rel="canonical" href="/about"></head><body><h1>About</h1></body>`
+	newDoc, err := ParseDocument([]byte(newSrc))
+	if err != nil {
+		t.Fatalf("Unexpected error in ParseDocument: %s", err.Error())
+	}
+	patches, err := DiffDocument(doc, newDoc)
+	if err != nil {
+		t.Fatalf("Unexpected error in DiffDocument: %s", err.Error())
+	}
+	if len(patches) != 2 {
+		t.Fatalf("Expected a HeadPatch and a BodyPatch but got %d patches", len(patches))
+	}
+	if _, ok := patches[0].(*HeadPatch); !ok {
+		t.Errorf("Expected first patch to be a HeadPatch but got %T", patches[0])
+	}
+	if _, ok := patches[1].(*BodyPatch); !ok {
+		t.Errorf("Expected second patch to be a BodyPatch but got %T", patches[1])
+	}
+	withMemDocument(head, body, func() {
+		// The root is not used, so it can be nil.
+		if err := patches.Patch(nil); err != nil {
+			t.Fatalf("Unexpected error in Patch: %s", err.Error())
+		}
+	})
+	if got, expected := head.InnerHTML(), string(newDoc.Head.HTML()); got != expected {
+		t.Errorf("Head was not correct.\nExpected: %s\nGot:      %s", expected, got)
+	}
+	if got, expected := body.InnerHTML(), string(newDoc.Body.HTML()); got != expected {
+		t.Errorf("Body was not correct.\nExpected: %s\nGot:      %s", expected, got)
+	}
+
+	// Diffing a document with itself should not need any patches.
+	patches, err = DiffDocument(newDoc, newDoc)
+	if err != nil {
+		t.Fatalf("Unexpected error in DiffDocument: %s", err.Error())
+	}
+	if len(patches) != 0 {
+		t.Errorf("Expected no patches but got %d", len(patches))
+	}
+}
+
+func TestSetTitle(t *testing.T) {
+	oldSetTitle := setDocumentTitle
+	defer func() {
+		setDocumentTitle = oldSetTitle
+	}()
+	got := ""
+	setDocumentTitle = func(title string) {
+		got = title
+	}
+	if err := (&SetTitle{Title: "About"}).Patch(nil); err != nil {
+		t.Fatalf("Unexpected error in Patch: %s", err.Error())
+	}
+	if got != "About" {
+		t.Errorf("Expected title to be set to %q but got %q", "About", got)
+	}
+}
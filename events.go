@@ -0,0 +1,282 @@
+package vdom
+
+import (
+	"fmt"
+
+	"github.com/gopherjs/gopherjs/js"
+	"honnef.co/go/js/dom"
+)
+
+// EventHandler is a go function which handles events for a virtual Element.
+type EventHandler func(ev *Event)
+
+// Listener is an event listener attached to a virtual Element. Type is the
+// type of event, e.g. "click".
+type Listener struct {
+	Type    string
+	Handler EventHandler
+}
+
+// AddEventListener adds a Listener to e which will call handler for
+// every event of the given type. Listeners are only called for events in the
+// actual DOM if there is a Dispatcher for the root.
+func (e *Element) AddEventListener(typ string, handler EventHandler) {
+	e.Listeners = append(e.Listeners, Listener{
+		Type:    typ,
+		Handler: handler,
+	})
+	// The types of the listeners are part of the hash.
+	e.forgetHash()
+}
+
+// Event is passed to an EventHandler when an event occurs.
+type Event struct {
+	// Type is the type of the event, e.g. "click".
+	Type string
+	// Target is the virtual node corresponding to the node in the actual DOM
+	// where the event occurred.
+	Target Node
+	// CurrentTarget is the virtual element whose Listener is being called.
+	// As the event bubbles up through the virtual tree, this changes to each
+	// of the ancestors of Target in turn.
+	CurrentTarget *Element
+	// Native is the event from the actual DOM.
+	Native  dom.Event
+	stopped bool
+}
+
+// StopPropagation stops the event from bubbling up to any more elements,
+// both in the virtual tree and in the actual DOM.
+func (ev *Event) StopPropagation() {
+	ev.stopped = true
+	ev.Native.StopPropagation()
+}
+
+// PreventDefault cancels the default action for the event in the actual DOM.
+func (ev *Event) PreventDefault() {
+	ev.Native.PreventDefault()
+}
+
+// nonBubblingEvents is the set of event types which do not bubble in the
+// actual DOM. A Dispatcher listens for these during the capturing phase
+// instead, and only calls the Listeners of the target.
+var nonBubblingEvents = map[string]bool{
+	"blur":       true,
+	"error":      true,
+	"focus":      true,
+	"load":       true,
+	"mouseenter": true,
+	"mouseleave": true,
+	"scroll":     true,
+}
+
+// dispatchers holds the Dispatcher for each root, keyed by dispatcherKey.
+// Patches use it to make sure the Dispatcher listens for any new types of
+// events.
+var dispatchers = map[interface{}]*Dispatcher{}
+
+// dispatcherKey returns the key for root in dispatchers. In gopherjs, each
+// call to dom.WrapElement returns a new wrapper for the same element, so the
+// key is the underlying js object. Elements without one (e.g. in tests) are
+// their own key.
+func dispatcherKey(root dom.Element) interface{} {
+	if object := root.Underlying(); object != nil {
+		return object
+	}
+	return root
+}
+
+// A Dispatcher routes events in the actual DOM to the Listeners of the
+// corresponding virtual Elements. Instead of adding a listener to every
+// element in the actual DOM, it adds a single listener for each type of
+// event to the root and uses the index of the target to find the virtual
+// node where the event occurred. The event then bubbles up through the
+// virtual tree, calling the Listeners of each element along the way.
+//
+// Since it looks up Listeners in the current virtual tree whenever an event
+// occurs, a Dispatcher does not need any patches when an EventHandler
+// changes. However, you must call SetTree with the new tree each time you
+// apply patches to root.
+type Dispatcher struct {
+	root      dom.Element
+	tree      *Tree
+	listeners map[string]func(*js.Object)
+}
+
+// NewDispatcher creates a Dispatcher for root, which should contain the
+// actual DOM for tree. root should be the same element that you pass to the
+// Patch method of any patches for tree, since that is how patches find
+// the Dispatcher. It does not need to be the same wrapper, e.g. from
+// dom.WrapElement. Creating a new Dispatcher for root replaces the old one.
+func NewDispatcher(root dom.Element, tree *Tree) *Dispatcher {
+	if old, found := dispatchers[dispatcherKey(root)]; found {
+		old.Close()
+	}
+	d := &Dispatcher{
+		root:      root,
+		listeners: map[string]func(*js.Object){},
+	}
+	dispatchers[dispatcherKey(root)] = d
+	d.SetTree(tree)
+	return d
+}
+
+// SetTree changes the virtual tree that d uses to find Listeners. You should
+// call it with the new tree after applying patches to the root. SetTree also
+// makes sure that d is listening for every type of event that any element in
+// tree has a Listener for.
+func (d *Dispatcher) SetTree(tree *Tree) {
+	d.tree = tree
+	for _, child := range tree.Children {
+		d.listenForSubtree(child)
+	}
+}
+
+// Close removes all the listeners that d added to the root. After Close is
+// called, d will not route any more events and patches for the root can no
+// longer add Listeners.
+func (d *Dispatcher) Close() {
+	for typ, listener := range d.listeners {
+		d.root.RemoveEventListener(typ, nonBubblingEvents[typ], listener)
+	}
+	d.listeners = map[string]func(*js.Object){}
+	if key := dispatcherKey(d.root); dispatchers[key] == d {
+		delete(dispatchers, key)
+	}
+}
+
+// listen makes sure that d is listening for events of the given type.
+func (d *Dispatcher) listen(typ string) {
+	if _, found := d.listeners[typ]; found {
+		return
+	}
+	d.listeners[typ] = d.root.AddEventListener(typ, nonBubblingEvents[typ], d.dispatch)
+}
+
+// listenForSubtree makes sure that d is listening for every type of event
+// that node or any of its descendants has a Listener for.
+func (d *Dispatcher) listenForSubtree(node Node) {
+	if el, ok := node.(*Element); ok {
+		for _, listener := range el.Listeners {
+			d.listen(listener.Type)
+		}
+	}
+	for _, child := range node.Children() {
+		d.listenForSubtree(child)
+	}
+}
+
+// dispatch is called for each event in the actual DOM that d is listening
+// for. It finds the corresponding virtual node and calls the appropriate
+// Listeners.
+func (d *Dispatcher) dispatch(native dom.Event) {
+	if d.tree == nil {
+		return
+	}
+	index, found := indexInDOM(native.Target(), d.root)
+	if !found {
+		return
+	}
+	target := d.tree.nodeAt(index)
+	if target == nil {
+		// The actual DOM has nodes which are not in the virtual tree.
+		return
+	}
+	ev := &Event{
+		Type:   native.Type(),
+		Target: target,
+		Native: native,
+	}
+	el, ok := target.(*Element)
+	if !ok {
+		el = target.Parent()
+	}
+	for ; el != nil && !ev.stopped; el = el.Parent() {
+		ev.CurrentTarget = el
+		for _, listener := range el.Listeners {
+			if listener.Type == ev.Type {
+				listener.Handler(ev)
+			}
+		}
+		if nonBubblingEvents[ev.Type] {
+			break
+		}
+	}
+}
+
+// indexInDOM returns the child indexes starting at root that can be used to
+// get to node in the actual DOM. It returns false if node is not inside of
+// root.
+func indexInDOM(node dom.Node, root dom.Element) ([]int, bool) {
+	index := []int{}
+	for !sameNode(node, root) {
+		parent := node.ParentNode()
+		if parent == nil {
+			return nil, false
+		}
+		i := 0
+		for i < len(parent.ChildNodes()) && !sameNode(parent.ChildNodes()[i], node) {
+			i++
+		}
+		index = append([]int{i}, index...)
+		node = parent
+	}
+	return index, true
+}
+
+// sameNode returns true iff a and b are the same node in the actual DOM. We
+// can't simply compare them, because each call to a method which returns a
+// dom.Node returns a new go value wrapping the js object.
+func sameNode(a, b dom.Node) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a == b {
+		return true
+	}
+	return a.Underlying() != nil && a.Underlying() == b.Underlying()
+}
+
+// nodeAt returns the node in t which has the given index, or nil if there
+// is no such node.
+func (t *Tree) nodeAt(index []int) Node {
+	if len(index) == 0 || index[0] >= len(t.Children) {
+		return nil
+	}
+	node := t.Children[index[0]]
+	for _, i := range index[1:] {
+		if i >= len(node.Children()) {
+			return nil
+		}
+		node = node.Children()[i]
+	}
+	return node
+}
+
+// listenForSubtree makes sure that the Dispatcher for root is listening for
+// every type of event that node or any of its descendants has a Listener
+// for. It returns an error if there are Listeners but no Dispatcher.
+func listenForSubtree(root dom.Element, node Node) error {
+	if d, found := dispatchers[dispatcherKey(root)]; found {
+		d.listenForSubtree(node)
+		return nil
+	}
+	if hasListeners(node) {
+		return fmt.Errorf("vdom: node has event listeners but there is no Dispatcher for the root. Use NewDispatcher to create one.")
+	}
+	return nil
+}
+
+// hasListeners returns true iff node or any of its descendants has a
+// Listener.
+func hasListeners(node Node) bool {
+	if el, ok := node.(*Element); ok && len(el.Listeners) > 0 {
+		return true
+	}
+	for _, child := range node.Children() {
+		if hasListeners(child) {
+			return true
+		}
+	}
+	return false
+}
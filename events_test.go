@@ -0,0 +1,313 @@
+package vdom
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gopherjs/gopherjs/js"
+)
+
+func TestDispatcher(t *testing.T) {
+	src := "<div><ul><li><a>one</a></li><li>two</li></ul></div>"
+	tree, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatalf("Unexpected error in Parse: %s", err.Error())
+	}
+	root := newMemRoot(src)
+	div := tree.Children[0].(*Element)
+	ul := div.Children()[0].(*Element)
+	li := ul.Children()[0].(*Element)
+	a := li.Children()[0].(*Element)
+	got := []*Element{}
+	record := func(ev *Event) {
+		if ev.Target != a {
+			t.Errorf("Expected Target to be %s but got %v", a.HTML(), ev.Target)
+		}
+		got = append(got, ev.CurrentTarget)
+	}
+	li.AddEventListener("click", record)
+	ul.AddEventListener("click", record)
+	div.AddEventListener("click", record)
+	ul.AddEventListener("focus", record)
+	d := NewDispatcher(root, tree)
+	defer d.Close()
+
+	// Click events bubble up through all the ancestors of the target.
+	memNodeAt(root, 0, 0, 0, 0).DispatchEvent(newMemEvent("click"))
+	if expected := []*Element{li, ul, div}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Listeners were called in the wrong order. Expected %v but got %v", expected, got)
+	}
+
+	// Focus events don't bubble, so only the listeners of the target are
+	// called.
+	got = nil
+	memNodeAt(root, 0, 0, 0, 0).DispatchEvent(newMemEvent("focus"))
+	if len(got) != 0 {
+		t.Errorf("Expected focus listener of ancestor not to be called but got %v", got)
+	}
+
+	// Stopping propagation stops the event from bubbling any further.
+	got = nil
+	ul.Listeners[0].Handler = func(ev *Event) {
+		record(ev)
+		ev.StopPropagation()
+	}
+	memNodeAt(root, 0, 0, 0, 0).DispatchEvent(newMemEvent("click"))
+	if expected := []*Element{li, ul}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected propagation to stop at ul. Expected %v but got %v", expected, got)
+	}
+}
+
+func TestDiffListeners(t *testing.T) {
+	noop := func(*Event) {}
+	testCases := []struct {
+		name     string
+		old      []string
+		new      []string
+		expected []Patcher
+	}{
+		{
+			name:     "no change",
+			old:      []string{"click"},
+			new:      []string{"click"},
+			expected: []Patcher{},
+		},
+		{
+			name: "add listener",
+			old:  []string{"click"},
+			new:  []string{"click", "input"},
+			expected: []Patcher{
+				&SetListener{Listener: Listener{Type: "input"}},
+			},
+		},
+		{
+			name: "remove listener",
+			old:  []string{"click", "click", "input"},
+			new:  []string{"input"},
+			expected: []Patcher{
+				&RemoveListener{Type: "click"},
+			},
+		},
+		{
+			name: "change type",
+			old:  []string{"click"},
+			new:  []string{"input"},
+			expected: []Patcher{
+				&SetListener{Listener: Listener{Type: "input"}},
+				&RemoveListener{Type: "click"},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		tree, err := Parse([]byte("<div>one</div>"))
+		if err != nil {
+			t.Fatalf("Unexpected error in Parse: %s", err.Error())
+		}
+		newTree, err := Parse([]byte("<div>one</div>"))
+		if err != nil {
+			t.Fatalf("Unexpected error in Parse: %s", err.Error())
+		}
+		el := tree.Children[0].(*Element)
+		for _, typ := range tc.old {
+			el.AddEventListener(typ, noop)
+		}
+		newEl := newTree.Children[0].(*Element)
+		for _, typ := range tc.new {
+			newEl.AddEventListener(typ, noop)
+		}
+		patches, err := Diff(tree, newTree)
+		if err != nil {
+			t.Fatalf("Unexpected error in Diff: %s", err.Error())
+		}
+		if len(patches) != len(tc.expected) {
+			t.Errorf("%s: Expected %d patches but got %d: %v", tc.name, len(tc.expected), len(patches), patches)
+			continue
+		}
+		for i, patch := range patches {
+			switch p := patch.(type) {
+			case *SetListener:
+				expected, ok := tc.expected[i].(*SetListener)
+				if !ok || p.Node != el || p.Listener.Type != expected.Listener.Type {
+					t.Errorf("%s: Expected patch %d to be %#v but got %#v", tc.name, i, tc.expected[i], p)
+				}
+			case *RemoveListener:
+				expected, ok := tc.expected[i].(*RemoveListener)
+				if !ok || p.Node != el || p.Type != expected.Type {
+					t.Errorf("%s: Expected patch %d to be %#v but got %#v", tc.name, i, tc.expected[i], p)
+				}
+			default:
+				t.Errorf("%s: Unexpected patch %d: %#v", tc.name, i, p)
+			}
+		}
+	}
+}
+
+// TestDiffListenersAfterHash tests that adding a listener to an element whose
+// hash was already computed (e.g. by an earlier Diff) is not missed.
+func TestDiffListenersAfterHash(t *testing.T) {
+	tree, err := Parse([]byte("<div><button>one</button></div>"))
+	if err != nil {
+		t.Fatalf("Unexpected error in Parse: %s", err.Error())
+	}
+	newTree, err := Parse([]byte("<div><button>one</button></div>"))
+	if err != nil {
+		t.Fatalf("Unexpected error in Parse: %s", err.Error())
+	}
+	patches, err := Diff(tree, newTree)
+	if err != nil {
+		t.Fatalf("Unexpected error in Diff: %s", err.Error())
+	}
+	if len(patches) != 0 {
+		t.Fatalf("Expected no patches but got %d", len(patches))
+	}
+	button := newTree.Children[0].Children()[0].(*Element)
+	button.AddEventListener("click", func(*Event) {})
+	patches, err = Diff(tree, newTree)
+	if err != nil {
+		t.Fatalf("Unexpected error in Diff: %s", err.Error())
+	}
+	if len(patches) != 1 {
+		t.Fatalf("Expected 1 patch but got %d: %v", len(patches), patches)
+	}
+	if p, ok := patches[0].(*SetListener); !ok || p.Listener.Type != "click" {
+		t.Errorf("Expected a SetListener for click but got %#v", patches[0])
+	}
+}
+
+func TestPatchListeners(t *testing.T) {
+	src := "<div><p>one</p></div>"
+	tree, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatalf("Unexpected error in Parse: %s", err.Error())
+	}
+	root := newMemRoot(src)
+	d := NewDispatcher(root, tree)
+	defer d.Close()
+
+	// Replace the p with a button which has a click listener. The Dispatcher
+	// was not listening for clicks before, so the Replace needs to make sure
+	// that it is now.
+	newTree, err := Parse([]byte("<div><button>one</button></div>"))
+	if err != nil {
+		t.Fatalf("Unexpected error in Parse: %s", err.Error())
+	}
+	clicks := 0
+	newTree.Children[0].Children()[0].(*Element).AddEventListener("click", func(*Event) {
+		clicks++
+	})
+	patches, err := Diff(tree, newTree)
+	if err != nil {
+		t.Fatalf("Unexpected error in Diff: %s", err.Error())
+	}
+	if err := patches.Patch(root); err != nil {
+		t.Fatalf("Unexpected error in Patch: %s", err.Error())
+	}
+	d.SetTree(newTree)
+	memNodeAt(root, 0, 0, 0).DispatchEvent(newMemEvent("click"))
+	if clicks != 1 {
+		t.Errorf("Expected listener of new button to be called once but got %d", clicks)
+	}
+
+	// Add a listener to the div. The handler of the button changes too, but
+	// that doesn't need a patch.
+	latestTree, err := Parse([]byte("<div><button>one</button></div>"))
+	if err != nil {
+		t.Fatalf("Unexpected error in Parse: %s", err.Error())
+	}
+	got := []string{}
+	latestDiv := latestTree.Children[0].(*Element)
+	latestDiv.AddEventListener("input", func(*Event) {
+		got = append(got, "div input")
+	})
+	latestDiv.Children()[0].(*Element).AddEventListener("click", func(*Event) {
+		got = append(got, "button click")
+	})
+	patches, err = Diff(newTree, latestTree)
+	if err != nil {
+		t.Fatalf("Unexpected error in Diff: %s", err.Error())
+	}
+	if len(patches) != 1 {
+		t.Fatalf("Expected 1 patch but got %d: %v", len(patches), patches)
+	}
+	if err := patches.Patch(root); err != nil {
+		t.Fatalf("Unexpected error in Patch: %s", err.Error())
+	}
+	d.SetTree(latestTree)
+	memNodeAt(root, 0, 0, 0).DispatchEvent(newMemEvent("click"))
+	memNodeAt(root, 0, 0, 0).DispatchEvent(newMemEvent("input"))
+	if expected := []string{"button click", "div input"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v but got %v", expected, got)
+	}
+	if clicks != 1 {
+		t.Errorf("Expected old listener not to be called again but it was called %d times", clicks)
+	}
+}
+
+// wrappedMemNode is another wrapper for the same memNode and js object, like
+// the ones returned by each call to dom.WrapElement in gopherjs.
+type wrappedMemNode struct {
+	*memNode
+	object *js.Object
+}
+
+func (n *wrappedMemNode) Underlying() *js.Object {
+	return n.object
+}
+
+func TestPatchListenersWrappedRoot(t *testing.T) {
+	tree, err := Parse([]byte("<div>one</div>"))
+	if err != nil {
+		t.Fatalf("Unexpected error in Parse: %s", err.Error())
+	}
+	root := newMemRoot("<div>one</div>")
+	object := new(js.Object)
+	d := NewDispatcher(&wrappedMemNode{memNode: root, object: object}, tree)
+	defer d.Close()
+	patch := &SetListener{
+		Node:     tree.Children[0].(*Element),
+		Listener: Listener{Type: "click", Handler: func(*Event) {}},
+	}
+	if err := patch.Patch(&wrappedMemNode{memNode: root, object: object}); err != nil {
+		t.Errorf("Unexpected error when patching with a different wrapper for the root: %s", err.Error())
+	}
+	d.Close()
+	if err := patch.Patch(&wrappedMemNode{memNode: root, object: object}); err == nil {
+		t.Error("Expected an error after the Dispatcher was closed but got none")
+	}
+}
+
+func TestPatchListenersWithoutDispatcher(t *testing.T) {
+	tree, err := Parse([]byte("<div>one</div>"))
+	if err != nil {
+		t.Fatalf("Unexpected error in Parse: %s", err.Error())
+	}
+	root := newMemRoot("<div>one</div>")
+	el := tree.Children[0].(*Element)
+	patch := &SetListener{
+		Node:     el,
+		Listener: Listener{Type: "click", Handler: func(*Event) {}},
+	}
+	if err := patch.Patch(root); err == nil {
+		t.Error("Expected an error when adding a listener without a Dispatcher but got none")
+	}
+	other, err := Parse([]byte("<span>two</span>"))
+	if err != nil {
+		t.Fatalf("Unexpected error in Parse: %s", err.Error())
+	}
+	child := other.Children[0].(*Element)
+	child.AddEventListener("click", func(*Event) {})
+	appendPatch := &Append{Parent: el, Child: child}
+	if err := appendPatch.Patch(root); err == nil {
+		t.Error("Expected an error when appending a node with listeners without a Dispatcher but got none")
+	}
+}
+
+// memNodeAt returns the node in the in-memory DOM with the given index,
+// starting at root.
+func memNodeAt(root *memNode, index ...int) *memNode {
+	node := root
+	for _, i := range index {
+		node = node.children[i]
+	}
+	return node
+}
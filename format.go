@@ -0,0 +1,178 @@
+package vdom
+
+import (
+	"io"
+	"strings"
+)
+
+// blockElements is the set of html elements which the browser does not
+// render inline, so whitespace between them does not change how the page
+// looks.
+var blockElements = map[string]bool{
+	"address":    true,
+	"article":    true,
+	"aside":      true,
+	"base":       true,
+	"blockquote": true,
+	"body":       true,
+	"caption":    true,
+	"col":        true,
+	"colgroup":   true,
+	"dd":         true,
+	"details":    true,
+	"dialog":     true,
+	"div":        true,
+	"dl":         true,
+	"dt":         true,
+	"fieldset":   true,
+	"figcaption": true,
+	"figure":     true,
+	"footer":     true,
+	"form":       true,
+	"h1":         true,
+	"h2":         true,
+	"h3":         true,
+	"h4":         true,
+	"h5":         true,
+	"h6":         true,
+	"head":       true,
+	"header":     true,
+	"hgroup":     true,
+	"hr":         true,
+	"html":       true,
+	"li":         true,
+	"link":       true,
+	"main":       true,
+	"menu":       true,
+	"meta":       true,
+	"nav":        true,
+	"noscript":   true,
+	"ol":         true,
+	"optgroup":   true,
+	"option":     true,
+	"p":          true,
+	"script":     true,
+	"section":    true,
+	"style":      true,
+	"summary":    true,
+	"table":      true,
+	"tbody":      true,
+	"td":         true,
+	"template":   true,
+	"tfoot":      true,
+	"th":         true,
+	"thead":      true,
+	"title":      true,
+	"tr":         true,
+	"ul":         true,
+}
+
+// htmlWhitespace is the set of characters which html treats as whitespace.
+// Unlike strings.TrimSpace, it does not include non-breaking spaces, which
+// the browser renders.
+const htmlWhitespace = " \t\n\f\r"
+
+// textEscaper and attrEscaper escape only the characters which must be
+// escaped, so that template actions (which may contain quotes) are kept as
+// they are. Non-breaking spaces are escaped too, so that they can be told
+// apart from regular spaces.
+var (
+	textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\u00a0", "&nbsp;")
+	attrEscaper = strings.NewReplacer("&", "&amp;", `"`, "&quot;", "\u00a0", "&nbsp;")
+)
+
+// WriteIndentedHTML writes the html for t to w in a canonical format, which
+// is useful for keeping html files and templates consistent. Like WriteHTML,
+// it builds the html from the nodes themselves: attribute values are always
+// double-quoted, boolean attributes are written without a value, and void
+// elements are written without a closing tag or slash. Text is only escaped
+// where it has to be, so any template actions are kept as they are.
+//
+// The children of an element are written on their own lines, indented with
+// indent once for each level, only if that does not change how the browser
+// renders them, i.e. if the element only contains whitespace between its
+// children and either they are all block elements or there was already
+// whitespace before, after, and between each of them. Otherwise the children
+// are written inline, exactly as they are.
+// The contents of <pre>, <textarea>, <script>, and other elements where
+// whitespace matters are never changed.
+func (t *Tree) WriteIndentedHTML(w io.Writer, indent string) error {
+	hw := &htmlWriter{w: w, format: true, indenting: true, indent: indent}
+	hw.writeChildren(nil, t.Children)
+	if len(t.Children) > 0 && !hw.atLineStart {
+		hw.write("\n")
+	}
+	return hw.err
+}
+
+// formatsAsBlock returns true iff nodes, which are the children of parent,
+// can each be written on their own line. parent may be nil if the nodes are
+// the first-level children of a tree, in which case there does not need to
+// be whitespace before the first node or after the last one.
+func formatsAsBlock(parent *Element, nodes []Node) bool {
+	if parent != nil && parent.Namespace == "" {
+		if rawTextElements[parent.Name] || rcdataElements[parent.Name] || parent.Name == "pre" || parent.Name == "listing" {
+			return false
+		}
+	}
+	// spaced is true iff there is whitespace between each pair of adjacent
+	// nodes, and before the first and after the last if parent is not nil.
+	// Adding whitespace where there was none may add a space between inline
+	// nodes, so unless they are all block elements there must already be
+	// whitespace everywhere writeBlock puts a newline.
+	spaced := true
+	allBlocks := true
+	afterWhitespace := parent == nil
+	for _, node := range nodes {
+		switch n := node.(type) {
+		case *Text:
+			if strings.Trim(string(n.Value), htmlWhitespace) != "" {
+				return false
+			}
+			afterWhitespace = true
+			continue
+		case *Element:
+			if n.Namespace != "" || !blockElements[n.Name] {
+				allBlocks = false
+			}
+		}
+		if !afterWhitespace {
+			spaced = false
+		}
+		afterWhitespace = false
+	}
+	if parent != nil && !afterWhitespace {
+		spaced = false
+	}
+	return spaced || allBlocks
+}
+
+// writeBlock writes each of nodes, which are the children of parent, on
+// their own line, leaving out any text which only contains whitespace.
+// parent may be nil if the nodes are the first-level children of a tree, in
+// which case they are not indented and each line ends with a newline.
+func (hw *htmlWriter) writeBlock(parent *Element, nodes []Node) {
+	if parent != nil {
+		hw.depth++
+	}
+	wrote := false
+	for _, node := range nodes {
+		if _, ok := node.(*Text); ok {
+			continue
+		}
+		if parent != nil {
+			hw.write("\n" + strings.Repeat(hw.indent, hw.depth))
+		}
+		hw.writeNode(node)
+		if parent == nil {
+			hw.write("\n")
+		}
+		wrote = true
+	}
+	if parent != nil {
+		hw.depth--
+		if wrote {
+			hw.write("\n" + strings.Repeat(hw.indent, hw.depth))
+		}
+	}
+}
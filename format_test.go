@@ -0,0 +1,104 @@
+package vdom
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteIndentedHTML(t *testing.T) {
+	testCases := []struct {
+		name     string
+		src      string
+		expected string
+	}{
+		{
+			name:     "block elements",
+			src:      `<div class='list'><ul><li>one</li><li>two</li></ul></div>`,
+			expected: "<div class=\"list\">\n  <ul>\n    <li>one</li>\n    <li>two</li>\n  </ul>\n</div>\n",
+		},
+		{
+			name:     "reindented",
+			src:      "<div>\n\t\t\t<span>a</span>   <span>b</span>\n</div>",
+			expected: "<div>\n  <span>a</span>\n  <span>b</span>\n</div>\n",
+		},
+		{
+			name:     "inline elements are not split",
+			src:      `<p>Hello, <b>world</b>!</p><div><span>a</span><span>b</span></div>`,
+			expected: "<p>Hello, <b>world</b>!</p>\n<div><span>a</span><span>b</span></div>\n",
+		},
+		{
+			name:     "attributes and void elements",
+			src:      `<form><input type=text disabled="disabled" value='say "hi"'/><br/></form>`,
+			expected: "<form><input type=\"text\" disabled value=\"say &quot;hi&quot;\"><br></form>\n",
+		},
+		{
+			name:     "template actions",
+			src:      `<ul>  <li class="{{ if .Done }}done{{ end }}">{{ printf "%s's" .Title }}</li>  </ul>`,
+			expected: "<ul>\n  <li class=\"{{ if .Done }}done{{ end }}\">{{ printf \"%s's\" .Title }}</li>\n</ul>\n",
+		},
+		{
+			name:     "whitespace is kept where it matters",
+			src:      "<div>\n<pre>  a\n b </pre>\n<textarea> x </textarea>\n<script> if (a < b) {} </script>\n</div>",
+			expected: "<div>\n  <pre>  a\n b </pre>\n  <textarea> x </textarea>\n  <script> if (a < b) {} </script>\n</div>\n",
+		},
+		{
+			name:     "document",
+			src:      "<!DOCTYPE html><html><head><title>Todos</title></head><body><!-- app --><div></div></body></html>",
+			expected: "<!DOCTYPE html>\n<html>\n  <head>\n    <title>Todos</title>\n  </head>\n  <body>\n    <!-- app -->\n    <div></div>\n  </body>\n</html>\n",
+		},
+		{
+			name:     "non-breaking spaces are not whitespace",
+			src:      "<div><p>&nbsp;</p>\u00a0<p>\u00a0</p></div>",
+			expected: "<div><p>&nbsp;</p>&nbsp;<p>&nbsp;</p></div>\n",
+		},
+		{
+			name:     "whitespace after void elements",
+			src:      "<form>\n<input>\n<br>\n</form>",
+			expected: "<form>\n  <input>\n  <br>\n</form>\n",
+		},
+		{
+			name:     "whitespace between only some inline elements",
+			src:      "<p><b>x</b> <i>y</i><b>z</b></p>",
+			expected: "<p><b>x</b> <i>y</i><b>z</b></p>\n",
+		},
+		{
+			name:     "no whitespace around inline elements",
+			src:      "<p><b>x</b> <i>y</i></p><div>\n<span>a</span>\n<span>b</span></div>",
+			expected: "<p><b>x</b> <i>y</i></p>\n<div>\n<span>a</span>\n<span>b</span></div>\n",
+		},
+		{
+			name:     "top-level text",
+			src:      "Hello <b>there</b>",
+			expected: "Hello <b>there</b>\n",
+		},
+	}
+	for _, tc := range testCases {
+		tree, err := Parse([]byte(tc.src))
+		if err != nil {
+			t.Errorf("%s: Unexpected error in Parse: %s", tc.name, err.Error())
+			continue
+		}
+		buf := bytes.NewBuffer(nil)
+		if err := tree.WriteIndentedHTML(buf, "  "); err != nil {
+			t.Errorf("%s: Unexpected error in WriteIndentedHTML: %s", tc.name, err.Error())
+			continue
+		}
+		if got := buf.String(); got != tc.expected {
+			t.Errorf("%s: WriteIndentedHTML was not correct.\nExpected: %q\nGot:      %q", tc.name, tc.expected, got)
+		}
+		// Formatting the result again should not change it.
+		reparsed, err := Parse(buf.Bytes())
+		if err != nil {
+			t.Errorf("%s: Unexpected error parsing the result of WriteIndentedHTML: %s", tc.name, err.Error())
+			continue
+		}
+		again := bytes.NewBuffer(nil)
+		if err := reparsed.WriteIndentedHTML(again, "  "); err != nil {
+			t.Errorf("%s: Unexpected error in WriteIndentedHTML: %s", tc.name, err.Error())
+			continue
+		}
+		if again.String() != buf.String() {
+			t.Errorf("%s: Formatting was not idempotent.\nFirst:  %q\nSecond: %q", tc.name, buf.String(), again.String())
+		}
+	}
+}
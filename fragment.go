@@ -0,0 +1,206 @@
+package vdom
+
+import (
+	"html"
+	"strings"
+)
+
+// ParseFragment parses src as the children of context, which may be an
+// element in an existing tree or just an &Element{Name: "tbody"}. The
+// browser parses some html differently depending on the element it is inside
+// of. ParseFragment follows the same rules as the html5 fragment parsing
+// algorithm for the cases which change the structure of the tree, so that a
+// component which renders e.g. table rows gets the same tree that the
+// browser makes when a patch inserts them:
+//
+//   - Inside of a table, rows are wrapped in an implied <tbody> and <col>
+//     elements are wrapped in an implied <colgroup>.
+//   - Inside of a <tbody>, <thead> or <tfoot>, cells are wrapped in an
+//     implied <tr>.
+//   - Inside of a <select>, any elements other than <option>, <optgroup>
+//     and <hr> are dropped, but their children are kept.
+//   - Inside of a <textarea> or <title>, src is a single text node with any
+//     character references decoded. Inside of a <script>, <style> and
+//     other raw text elements, src is a single text node as written.
+//   - Inside of <svg> or <math> (but not inside of a <foreignObject>), none
+//     of the rules above apply.
+//
+// The same rules are also applied to the children of each element in the
+// tree, using the element as the context. If context is nil, src is parsed
+// as the contents of <body>. Note that unlike the browser, ParseFragment does
+// not move text or other content which is not allowed inside of a table
+// (known as foster parenting). It is left where it was written instead.
+func ParseFragment(src []byte, context *Element) (*Tree, error) {
+	foreign := childNamespace(context) != ""
+	contextName := ""
+	if context != nil && !foreign {
+		contextName = context.Name
+		if rawTextElements[contextName] || rcdataElements[contextName] {
+			return rawTextTree(src, contextName), nil
+		}
+	}
+	// The namespaces need to be known while parsing, since the names of
+	// attributes are only case insensitive on html elements.
+	tree, err := parse(NewIndexedByteReader(src), true, context)
+	if err != nil {
+		return nil, err
+	}
+	if foreign {
+		// Nothing at the top level of the fragment needs to change, but the
+		// children of any foreignObject should still follow the html rules.
+		for _, child := range tree.Children {
+			applyContextRules(tree, child, true)
+		}
+		return tree, nil
+	}
+	if children, changed := contextChildren(tree, contextName, tree.Children); changed {
+		tree.Children = children
+		for i, child := range children {
+			setPosition(child, nil, []int{i})
+		}
+		tree.modified = true
+	}
+	return tree, nil
+}
+
+// rawTextTree returns a tree with a single text node for src, which is the
+// contents of a raw text or rcdata element named contextName.
+func rawTextTree(src []byte, contextName string) *Tree {
+	tree := &Tree{}
+	if len(src) == 0 {
+		return tree
+	}
+	value := string(src)
+	if rcdataElements[contextName] {
+		value = html.UnescapeString(value)
+	}
+	tree.Children = []Node{
+		&Text{
+			Value: []byte(value),
+			index: []int{0},
+		},
+	}
+	return tree
+}
+
+// applyContextRules applies the rules for each element in the subtree
+// starting at node to its children. foreign is true if node is svg or mathml
+// content.
+func applyContextRules(tree *Tree, node Node, foreign bool) {
+	el, ok := node.(*Element)
+	if !ok {
+		return
+	}
+	switch strings.ToLower(el.Name) {
+	case "svg", "math":
+		foreign = true
+	case "foreignobject":
+		foreign = false
+	}
+	if !foreign {
+		if children, changed := contextChildren(tree, el.Name, el.children); changed {
+			el.setChildren(children)
+		}
+	}
+	for _, child := range el.children {
+		applyContextRules(tree, child, foreign)
+	}
+}
+
+// contextChildren returns the nodes that the browser would create for nodes
+// inside of an html element named contextName, and whether they are any
+// different from nodes. It applies the rules to the descendants of nodes as
+// well.
+func contextChildren(tree *Tree, contextName string, nodes []Node) ([]Node, bool) {
+	for _, node := range nodes {
+		if _, ok := node.(*Element); ok {
+			applyContextRules(tree, node, false)
+		}
+	}
+	switch contextName {
+	case "table":
+		result, changed := wrapImplied(tree, nodes, "tbody", isElementNamed("tr", "td", "th"), isElementNamed("caption", "colgroup", "col", "thead", "tbody", "tfoot"))
+		result, colChanged := wrapImplied(tree, result, "colgroup", isElementNamed("col"), isElementNamed("caption", "colgroup", "thead", "tbody", "tfoot"))
+		return result, changed || colChanged
+	case "tbody", "thead", "tfoot":
+		return wrapImplied(tree, nodes, "tr", isElementNamed("td", "th"), isElementNamed("tr"))
+	case "select":
+		return unwrapElements(nodes, isElementNamed("option", "optgroup", "hr"))
+	}
+	return nodes, false
+}
+
+// isElementNamed returns a function which returns true iff a node is an
+// element with one of the given names.
+func isElementNamed(names ...string) func(Node) bool {
+	return func(node Node) bool {
+		el, ok := node.(*Element)
+		if !ok {
+			return false
+		}
+		for _, name := range names {
+			if strings.EqualFold(el.Name, name) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// wrapImplied wraps each run of nodes starting with a node for which opens
+// returns true in an implied element with the given name. The run continues
+// until a node for which closes returns true. For example, the browser wraps
+// rows in a table in an implied tbody, which stays open until the table ends
+// or another section of the table begins. The rules are applied to the
+// implied elements as well. It returns true if any nodes were wrapped.
+func wrapImplied(tree *Tree, nodes []Node, name string, opens, closes func(Node) bool) ([]Node, bool) {
+	result := []Node{}
+	changed := false
+	var implied *Element
+	var impliedChildren []Node
+	closeImplied := func() {
+		if implied != nil {
+			implied.setChildren(impliedChildren)
+			applyContextRules(tree, implied, false)
+			implied = nil
+		}
+	}
+	for _, node := range nodes {
+		if implied == nil && opens(node) {
+			implied = &Element{
+				Name:     name,
+				tree:     tree,
+				modified: true,
+			}
+			impliedChildren = nil
+			result = append(result, implied)
+			changed = true
+		} else if implied != nil && closes(node) {
+			closeImplied()
+		}
+		if implied != nil {
+			impliedChildren = append(impliedChildren, node)
+		} else {
+			result = append(result, node)
+		}
+	}
+	closeImplied()
+	return result, changed
+}
+
+// unwrapElements replaces any element for which keep returns false with its
+// children. It returns true if any elements were replaced.
+func unwrapElements(nodes []Node, keep func(Node) bool) ([]Node, bool) {
+	result := []Node{}
+	changed := false
+	for _, node := range nodes {
+		if el, ok := node.(*Element); ok && !keep(node) {
+			children, _ := unwrapElements(el.children, keep)
+			result = append(result, children...)
+			changed = true
+			continue
+		}
+		result = append(result, node)
+	}
+	return result, changed
+}
@@ -0,0 +1,136 @@
+package vdom
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFragment(t *testing.T) {
+	testCases := []struct {
+		name     string
+		src      string
+		context  *Element
+		expected string
+	}{
+		{
+			name:     "nil context",
+			src:      "<div><p>Hello</p></div>",
+			context:  nil,
+			expected: "<div><p>Hello</p></div>",
+		},
+		{
+			name:     "rows in table",
+			src:      "<tr><td>one</td></tr>\n<tr><td>two</td></tr>",
+			context:  &Element{Name: "table"},
+			expected: "<tbody><tr><td>one</td></tr>\n<tr><td>two</td></tr></tbody>",
+		},
+		{
+			name:     "cells in table",
+			src:      "<td>one</td><td>two</td>",
+			context:  &Element{Name: "table"},
+			expected: "<tbody><tr><td>one</td><td>two</td></tr></tbody>",
+		},
+		{
+			name:     "sections in table",
+			src:      "<caption>c</caption><col><tr><td>one</td></tr><tfoot><tr><td>two</td></tr></tfoot>",
+			context:  &Element{Name: "table"},
+			expected: "<caption>c</caption><colgroup><col></colgroup><tbody><tr><td>one</td></tr></tbody><tfoot><tr><td>two</td></tr></tfoot>",
+		},
+		{
+			name:     "explicit tbody in table",
+			src:      "<tbody><tr><td>one</td></tr></tbody>",
+			context:  &Element{Name: "table"},
+			expected: "<tbody><tr><td>one</td></tr></tbody>",
+		},
+		{
+			name:     "cells in tbody",
+			src:      "<td>one</td><td>two</td><tr><td>three</td></tr>",
+			context:  &Element{Name: "tbody"},
+			expected: "<tr><td>one</td><td>two</td></tr><tr><td>three</td></tr>",
+		},
+		{
+			name:     "nested table",
+			src:      "<div><table><tr><td>one</td></tr></table></div>",
+			context:  nil,
+			expected: "<div><table><tbody><tr><td>one</td></tr></tbody></table></div>",
+		},
+		{
+			name:     "select",
+			src:      "<option>one</option><div><span>two</span></div><optgroup><option>three</option></optgroup>",
+			context:  &Element{Name: "select"},
+			expected: "<option>one</option>two<optgroup><option>three</option></optgroup>",
+		},
+		{
+			name:     "textarea",
+			src:      "<b>bold</b> &amp; more",
+			context:  &Element{Name: "textarea"},
+			expected: "<b>bold</b> & more",
+		},
+		{
+			name:     "script",
+			src:      "if (a < b && c) { x = '<tr>' }",
+			context:  &Element{Name: "script"},
+			expected: "if (a < b && c) { x = '<tr>' }",
+		},
+		{
+			name:     "svg",
+			src:      "<tr><td>one</td></tr><foreignObject><table><tr></tr></table></foreignObject>",
+			context:  &Element{Name: "svg"},
+			expected: "<tr><td>one</td></tr><foreignObject><table><tbody><tr></tr></tbody></table></foreignObject>",
+		},
+	}
+	for _, tc := range testCases {
+		tree, err := ParseFragment([]byte(tc.src), tc.context)
+		if err != nil {
+			t.Errorf("%s: Unexpected error in ParseFragment: %s", tc.name, err.Error())
+			continue
+		}
+		if got := string(tree.HTML()); got != tc.expected {
+			t.Errorf("%s: HTML was not correct.\nExpected: %s\nGot:      %s", tc.name, tc.expected, got)
+		}
+		expectCorrectIndexes(t, tc.name, tree.Children, []int{})
+	}
+}
+
+func TestParseFragmentContext(t *testing.T) {
+	// The context can be an element in an existing tree. The rules for svg
+	// should apply to any element inside of an svg.
+	tree, err := Parse([]byte("<div><svg><g></g></svg></div>"))
+	if err != nil {
+		t.Fatalf("Unexpected error in Parse: %s", err.Error())
+	}
+	g := tree.Children[0].Children()[0].Children()[0].(*Element)
+	fragment, err := ParseFragment([]byte("<tr></tr>"), g)
+	if err != nil {
+		t.Fatalf("Unexpected error in ParseFragment: %s", err.Error())
+	}
+	if got := string(fragment.HTML()); got != "<tr></tr>" {
+		t.Errorf("Expected <tr> not to be wrapped inside of svg but got %s", got)
+	}
+
+	// An empty raw text fragment has no children.
+	fragment, err = ParseFragment([]byte{}, &Element{Name: "style"})
+	if err != nil {
+		t.Fatalf("Unexpected error in ParseFragment: %s", err.Error())
+	}
+	if len(fragment.Children) != 0 {
+		t.Errorf("Expected no children but got %d", len(fragment.Children))
+	}
+}
+
+// expectCorrectIndexes checks that the index and parent of each node matches
+// its actual position in the tree.
+func expectCorrectIndexes(t *testing.T, name string, nodes []Node, index []int) {
+	for i, node := range nodes {
+		expected := append(append([]int{}, index...), i)
+		if got := node.Index(); !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: Expected index %v but got %v", name, expected, got)
+		}
+		for _, child := range node.Children() {
+			if parent := child.Parent(); parent != node {
+				t.Errorf("%s: Expected parent of node at %v to be %v but got %v", name, child.Index(), node, parent)
+			}
+		}
+		expectCorrectIndexes(t, name, node.Children(), expected)
+	}
+}
@@ -0,0 +1,314 @@
+package vdom
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// HeadEntries are the entries for document.head which are declared by a
+// single component. Any fields which are empty are not declared.
+type HeadEntries struct {
+	Title   string
+	Meta    []Meta
+	Links   []Link
+	Scripts []Script
+}
+
+// Meta is a <meta> element which is identified by either its Name (e.g.
+// description) or its Property (e.g. og:title).
+type Meta struct {
+	Name     string
+	Property string
+	Content  string
+}
+
+// Link is a <link> element which is identified by its Rel and Href. Since
+// there can only be one canonical url and one manifest, links with those
+// rels are identified by their Rel alone. Attrs holds any other attributes,
+// e.g. type or sizes.
+type Link struct {
+	Rel   string
+	Href  string
+	Attrs []Attr
+}
+
+// Script is a <script> element which is identified by its Src. Attrs holds
+// any other attributes, e.g. async or type.
+type Script struct {
+	Src   string
+	Attrs []Attr
+}
+
+// uniqueLinkRels is the set of rels for which a document can only have one
+// link.
+var uniqueLinkRels = map[string]bool{
+	"canonical": true,
+	"manifest":  true,
+}
+
+// Head merges the HeadEntries declared by several components and keeps
+// document.head in sync with them. Each component declares its entries with
+// Set. If more than one component declares an entry with the same identity
+// (e.g. the title, or a meta with the same name), the one with the highest
+// priority wins. If the priorities are the same, the one whose source sorts
+// last wins. This means the result only depends on the declarations, and not
+// on the order in which the components rendered.
+//
+// Any elements which were already in the head (e.g. from the static html of
+// the page) are kept. If a component declares an entry with the same
+// identity as one of them, the entry replaces it in the same position until
+// the declaration is removed.
+type Head struct {
+	// static is the html of the elements which were in the head when the
+	// Head was created.
+	static  []Node
+	sources map[string]headSource
+	// tree is the current tree for the actual head.
+	tree *Tree
+}
+
+// headSource is the entries declared by one source, along with their
+// priority.
+type headSource struct {
+	priority int
+	entries  HeadEntries
+}
+
+// NewHead returns a new Head for document.head. It parses the current
+// contents of the head, so that they can be kept.
+func NewHead() (*Head, error) {
+	tree, err := ParseFragment([]byte(documentHead().InnerHTML()), &Element{Name: "head"})
+	if err != nil {
+		return nil, err
+	}
+	return &Head{
+		static:  tree.Children,
+		sources: map[string]headSource{},
+		tree:    tree,
+	}, nil
+}
+
+// Set declares the entries for the given source (e.g. the name of a
+// component), replacing any entries it declared before. Higher priorities
+// win when entries conflict. The actual head is not changed until you call
+// Update.
+func (h *Head) Set(source string, priority int, entries HeadEntries) {
+	h.sources[source] = headSource{
+		priority: priority,
+		entries:  entries,
+	}
+}
+
+// Remove removes all the entries for the given source, e.g. when the
+// component is unmounted. The actual head is not changed until you call
+// Update.
+func (h *Head) Remove(source string) {
+	delete(h.sources, source)
+}
+
+// Tree returns a new tree for the head with all of the current entries
+// merged together.
+func (h *Head) Tree() (*Tree, error) {
+	keys, merged := h.merge()
+	buf := bytes.NewBuffer(nil)
+	hw := &htmlWriter{w: buf}
+	written := map[string]bool{}
+	for _, node := range h.static {
+		key := headKey(node)
+		if entry, found := merged[key]; found && key != "" {
+			if !written[key] {
+				hw.writeNode(entry)
+				written[key] = true
+			}
+			continue
+		}
+		hw.writeNode(node)
+	}
+	for _, key := range keys {
+		if !written[key] {
+			hw.writeNode(merged[key])
+		}
+	}
+	if hw.err != nil {
+		return nil, hw.err
+	}
+	return ParseFragment(buf.Bytes(), &Element{Name: "head"})
+}
+
+// Update changes the actual head to match the current entries. It only
+// applies the patches needed to get from the last tree to the new one. The
+// elements are matched up by their identity, so adding or removing an entry
+// does not touch the elements after it. This matters because replacing a
+// stylesheet or script would make the browser load or run it again.
+func (h *Head) Update() error {
+	tree, err := h.Tree()
+	if err != nil {
+		return err
+	}
+	patches, err := diffHead(h.tree.Children, tree.Children)
+	if err != nil {
+		return err
+	}
+	if err := (&HeadPatch{Patches: patches}).Patch(nil); err != nil {
+		return err
+	}
+	h.tree = tree
+	return nil
+}
+
+// merge returns the winning element for each key, along with the keys in
+// the order they should appear in the head: the title, then meta elements,
+// links, and scripts, each in the order they were first declared.
+func (h *Head) merge() ([]string, map[string]*Element) {
+	names := make([]string, 0, len(h.sources))
+	for name := range h.sources {
+		names = append(names, name)
+	}
+	// Sort the sources so that the winner of each conflict comes last.
+	sort.Slice(names, func(i, j int) bool {
+		a, b := h.sources[names[i]], h.sources[names[j]]
+		if a.priority != b.priority {
+			return a.priority < b.priority
+		}
+		return names[i] < names[j]
+	})
+	merged := map[string]*Element{}
+	var titleKeys, metaKeys, linkKeys, scriptKeys []string
+	add := func(keys *[]string, el *Element) {
+		key := headKey(el)
+		if _, found := merged[key]; !found {
+			*keys = append(*keys, key)
+		}
+		merged[key] = el
+	}
+	for _, name := range names {
+		entries := h.sources[name].entries
+		if entries.Title != "" {
+			title := &Element{Name: "title"}
+			title.children = []Node{&Text{Value: []byte(entries.Title)}}
+			add(&titleKeys, title)
+		}
+		for _, meta := range entries.Meta {
+			el := &Element{Name: "meta"}
+			if meta.Name != "" {
+				el.Attrs = append(el.Attrs, Attr{Name: "name", Value: meta.Name})
+			} else {
+				el.Attrs = append(el.Attrs, Attr{Name: "property", Value: meta.Property})
+			}
+			el.Attrs = append(el.Attrs, Attr{Name: "content", Value: meta.Content})
+			add(&metaKeys, el)
+		}
+		for _, link := range entries.Links {
+			el := &Element{Name: "link"}
+			el.Attrs = append(el.Attrs, Attr{Name: "rel", Value: link.Rel}, Attr{Name: "href", Value: link.Href})
+			el.Attrs = append(el.Attrs, link.Attrs...)
+			add(&linkKeys, el)
+		}
+		for _, script := range entries.Scripts {
+			el := &Element{Name: "script"}
+			el.Attrs = append(el.Attrs, Attr{Name: "src", Value: script.Src})
+			el.Attrs = append(el.Attrs, script.Attrs...)
+			add(&scriptKeys, el)
+		}
+	}
+	keys := append(titleKeys, metaKeys...)
+	keys = append(keys, linkKeys...)
+	keys = append(keys, scriptKeys...)
+	return keys, merged
+}
+
+// diffHead returns the patches which change the first-level nodes in the
+// actual head from nodes to otherNodes. Unlike Diff, which matches nodes by
+// their position, it matches them by their key (see headKeys), and only
+// inserts or removes the nodes whose keys were added or removed. Nodes which
+// moved relative to the others are removed and inserted again.
+func diffHead(nodes, otherNodes []Node) (PatchSet, error) {
+	positions := map[string]int{}
+	for i, key := range headKeys(nodes) {
+		positions[key] = i
+	}
+	patches := []Patcher{}
+	kept := make([]bool, len(nodes))
+	inserted := []Node{}
+	last := -1
+	for i, key := range headKeys(otherNodes) {
+		j, found := positions[key]
+		if !found || j < last {
+			inserted = append(inserted, otherNodes[i])
+			continue
+		}
+		// The patches for the nodes which are kept come first, while the
+		// indexes of the nodes in the actual head still match nodes.
+		if err := recursiveDiff(&patches, nodes[j:j+1], otherNodes[i:i+1], DiffOptions{}); err != nil {
+			return nil, err
+		}
+		kept[j] = true
+		last = j
+	}
+	// Remove nodes starting from the last one, so that the indexes of the
+	// others stay the same.
+	for j := len(nodes) - 1; j >= 0; j-- {
+		if !kept[j] {
+			patches = append(patches, &Remove{Node: nodes[j]})
+		}
+	}
+	// Now the nodes which were kept are in the same order as in otherNodes,
+	// so inserting the others in order puts each one at its index.
+	for _, node := range inserted {
+		patches = append(patches, &Insert{Child: node})
+	}
+	return patches, nil
+}
+
+// headKeys returns a unique key for each of the nodes in the head. The key
+// is the headKey of the node, or "unmanaged" for nodes which a Head does not
+// manage (e.g. whitespace or <meta charset>), followed by the number of
+// nodes before it with the same headKey. This means the unmanaged nodes,
+// which are the same in every tree from a Head, are matched up in order.
+func headKeys(nodes []Node) []string {
+	keys := make([]string, len(nodes))
+	counts := map[string]int{}
+	for i, node := range nodes {
+		key := headKey(node)
+		if key == "" {
+			key = "unmanaged"
+		}
+		keys[i] = fmt.Sprintf("%s #%d", key, counts[key])
+		counts[key]++
+	}
+	return keys
+}
+
+// headKey returns the identity of node for the purposes of merging entries
+// in the head, or an empty string if it is not one of the elements that a
+// Head manages.
+func headKey(node Node) string {
+	el, ok := node.(*Element)
+	if !ok {
+		return ""
+	}
+	attrs := el.AttrMap()
+	switch strings.ToLower(el.Name) {
+	case "title":
+		return "title"
+	case "meta":
+		if name, found := attrs["name"]; found {
+			return "meta name=" + name
+		} else if property, found := attrs["property"]; found {
+			return "meta property=" + property
+		}
+	case "link":
+		rel := strings.ToLower(attrs["rel"])
+		if uniqueLinkRels[rel] {
+			return "link rel=" + rel
+		}
+		return "link rel=" + rel + " href=" + attrs["href"]
+	case "script":
+		if src, found := attrs["src"]; found {
+			return "script src=" + src
+		}
+	}
+	return ""
+}
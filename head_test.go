@@ -0,0 +1,203 @@
+package vdom
+
+import (
+	"testing"
+)
+
+func TestHeadMerge(t *testing.T) {
+	head := newMemRoot(`<meta charset="utf-8"><title>Site</title><link rel="stylesheet" href="/main.css">`)
+	withMemDocument(head, newMemRoot(""), func() {
+		h, err := NewHead()
+		if err != nil {
+			t.Fatalf("Unexpected error in NewHead: %s", err.Error())
+		}
+		h.Set("page", 1, HeadEntries{
+			Title: "About",
+			Meta: []Meta{
+				{Name: "description", Content: "about page"},
+				{Property: "og:title", Content: "About"},
+			},
+			Links: []Link{
+				{Rel: "canonical", Href: "/about"},
+			},
+		})
+		h.Set("layout", 0, HeadEntries{
+			Title: "Layout",
+			Meta: []Meta{
+				{Name: "description", Content: "layout"},
+				{Name: "viewport", Content: "width=device-width"},
+			},
+			Scripts: []Script{
+				{Src: "/app.js", Attrs: []Attr{{Name: "async", Value: ""}}},
+			},
+		})
+		// The same priority as page, but it sorts after page so it wins.
+		h.Set("widget", 1, HeadEntries{
+			Links: []Link{
+				{Rel: "canonical", Href: "/widget"},
+			},
+		})
+		if err := h.Update(); err != nil {
+			t.Fatalf("Unexpected error in Update: %s", err.Error())
+		}
+		expected := `<meta charset="utf-8"><title>About</title><link rel="stylesheet" href="/main.css">` +
+			`<meta name="description" content="about page"><meta name="viewport" content="width=device-width">` +
+			`<meta property="og:title" content="About"><link rel="canonical" href="/widget">` +
+			`<script src="/app.js" async=""></script>`
+		if got := head.InnerHTML(); got != expected {
+			t.Errorf("Head was not correct.\nExpected: %s\nGot:      %s", expected, got)
+		}
+
+		// Removing the sources should restore the static head.
+		h.Remove("page")
+		h.Remove("widget")
+		if err := h.Update(); err != nil {
+			t.Fatalf("Unexpected error in Update: %s", err.Error())
+		}
+		expected = `<meta charset="utf-8"><title>Layout</title><link rel="stylesheet" href="/main.css">` +
+			`<meta name="description" content="layout"><meta name="viewport" content="width=device-width">` +
+			`<script src="/app.js" async=""></script>`
+		if got := head.InnerHTML(); got != expected {
+			t.Errorf("Head was not correct.\nExpected: %s\nGot:      %s", expected, got)
+		}
+		h.Remove("layout")
+		if err := h.Update(); err != nil {
+			t.Fatalf("Unexpected error in Update: %s", err.Error())
+		}
+		expected = `<meta charset="utf-8"><title>Site</title><link rel="stylesheet" href="/main.css">`
+		if got := head.InnerHTML(); got != expected {
+			t.Errorf("Head was not correct.\nExpected: %s\nGot:      %s", expected, got)
+		}
+	})
+}
+
+func TestHeadMinimalPatches(t *testing.T) {
+	head := newMemRoot(`<title>Site</title>`)
+	withMemDocument(head, newMemRoot(""), func() {
+		h, err := NewHead()
+		if err != nil {
+			t.Fatalf("Unexpected error in NewHead: %s", err.Error())
+		}
+		entries := HeadEntries{
+			Meta: []Meta{
+				{Name: "description", Content: "one"},
+			},
+		}
+		h.Set("page", 0, entries)
+		if err := h.Update(); err != nil {
+			t.Fatalf("Unexpected error in Update: %s", err.Error())
+		}
+		prev, err := h.Tree()
+		if err != nil {
+			t.Fatalf("Unexpected error in Tree: %s", err.Error())
+		}
+
+		// Only changing the content of the meta should only change the
+		// attribute.
+		entries.Meta[0].Content = "two"
+		h.Set("page", 0, entries)
+		next, err := h.Tree()
+		if err != nil {
+			t.Fatalf("Unexpected error in Tree: %s", err.Error())
+		}
+		patches, err := diffHead(prev.Children, next.Children)
+		if err != nil {
+			t.Fatalf("Unexpected error in diffHead: %s", err.Error())
+		}
+		if len(patches) != 1 {
+			t.Fatalf("Expected 1 patch but got %d", len(patches))
+		}
+		if _, ok := patches[0].(*SetAttr); !ok {
+			t.Errorf("Expected a SetAttr patch but got %T", patches[0])
+		}
+
+		// Setting the same entries again should not need any patches.
+		if err := h.Update(); err != nil {
+			t.Fatalf("Unexpected error in Update: %s", err.Error())
+		}
+		again, err := h.Tree()
+		if err != nil {
+			t.Fatalf("Unexpected error in Tree: %s", err.Error())
+		}
+		patches, err = diffHead(next.Children, again.Children)
+		if err != nil {
+			t.Fatalf("Unexpected error in diffHead: %s", err.Error())
+		}
+		if len(patches) != 0 {
+			t.Errorf("Expected no patches but got %d", len(patches))
+		}
+		expected := `<title>Site</title><meta name="description" content="two">`
+		if got := head.InnerHTML(); got != expected {
+			t.Errorf("Head was not correct.\nExpected: %s\nGot:      %s", expected, got)
+		}
+	})
+}
+
+func TestHeadKeepsNodes(t *testing.T) {
+	head := newMemRoot(`<title>Site</title><link rel="stylesheet" href="/main.css">`)
+	withMemDocument(head, newMemRoot(""), func() {
+		h, err := NewHead()
+		if err != nil {
+			t.Fatalf("Unexpected error in NewHead: %s", err.Error())
+		}
+		entries := HeadEntries{
+			Links:   []Link{{Rel: "icon", Href: "/icon.png"}},
+			Scripts: []Script{{Src: "/app.js"}},
+		}
+		h.Set("page", 0, entries)
+		if err := h.Update(); err != nil {
+			t.Fatalf("Unexpected error in Update: %s", err.Error())
+		}
+		link, icon, script := memNodeAt(head, 1), memNodeAt(head, 2), memNodeAt(head, 3)
+
+		// Adding a meta comes before the links and scripts, but should not
+		// replace them.
+		prev, err := h.Tree()
+		if err != nil {
+			t.Fatalf("Unexpected error in Tree: %s", err.Error())
+		}
+		entries.Meta = []Meta{{Name: "description", Content: "one"}}
+		h.Set("page", 0, entries)
+		next, err := h.Tree()
+		if err != nil {
+			t.Fatalf("Unexpected error in Tree: %s", err.Error())
+		}
+		patches, err := diffHead(prev.Children, next.Children)
+		if err != nil {
+			t.Fatalf("Unexpected error in diffHead: %s", err.Error())
+		}
+		if len(patches) != 1 {
+			t.Fatalf("Expected 1 patch but got %d: %s", len(patches), patchSetString(patches))
+		}
+		if _, ok := patches[0].(*Insert); !ok {
+			t.Errorf("Expected an Insert patch but got %T", patches[0])
+		}
+		if err := h.Update(); err != nil {
+			t.Fatalf("Unexpected error in Update: %s", err.Error())
+		}
+		expected := `<title>Site</title><link rel="stylesheet" href="/main.css">` +
+			`<meta name="description" content="one"><link rel="icon" href="/icon.png">` +
+			`<script src="/app.js"></script>`
+		if got := head.InnerHTML(); got != expected {
+			t.Errorf("Head was not correct.\nExpected: %s\nGot:      %s", expected, got)
+		}
+		if memNodeAt(head, 1) != link || memNodeAt(head, 3) != icon || memNodeAt(head, 4) != script {
+			t.Error("Expected the existing link and script nodes to be kept")
+		}
+
+		// Removing it again should only remove the meta.
+		entries.Meta = nil
+		h.Set("page", 0, entries)
+		if err := h.Update(); err != nil {
+			t.Fatalf("Unexpected error in Update: %s", err.Error())
+		}
+		expected = `<title>Site</title><link rel="stylesheet" href="/main.css">` +
+			`<link rel="icon" href="/icon.png"><script src="/app.js"></script>`
+		if got := head.InnerHTML(); got != expected {
+			t.Errorf("Head was not correct.\nExpected: %s\nGot:      %s", expected, got)
+		}
+		if memNodeAt(head, 1) != link || memNodeAt(head, 2) != icon || memNodeAt(head, 3) != script {
+			t.Error("Expected the existing link and script nodes to be kept")
+		}
+	})
+}
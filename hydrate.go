@@ -0,0 +1,148 @@
+package vdom
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"honnef.co/go/js/dom"
+)
+
+// Mismatch is a difference between the actual DOM and a virtual tree which
+// was found by Hydrate.
+type Mismatch struct {
+	// Index is the index of the virtual node where the mismatch was found.
+	// It is empty if the mismatch is in the first-level children of the tree.
+	Index   []int
+	Message string
+}
+
+func (m Mismatch) String() string {
+	return fmt.Sprintf("%v: %s", m.Index, m.Message)
+}
+
+// HydrateError is returned by Hydrate when the actual DOM does not match the
+// virtual tree.
+type HydrateError struct {
+	Mismatches []Mismatch
+}
+
+func (e *HydrateError) Error() string {
+	messages := make([]string, len(e.Mismatches))
+	for i, m := range e.Mismatches {
+		messages[i] = m.String()
+	}
+	return fmt.Sprintf("vdom: the actual DOM does not match the virtual tree. Found %d mismatches:\n%s", len(e.Mismatches), strings.Join(messages, "\n"))
+}
+
+// Hydrate adopts the existing DOM inside of root (e.g. html which was rendered
+// on the server with WriteHTML) as the actual DOM for tree, without creating
+// any new nodes. It walks the actual DOM and tree together and checks that the
+// type, tag name, attributes, and value of each node match. If they all match,
+// tree can be used as the starting point for Diff, just as if it had been
+// used to render root. Otherwise, Hydrate returns a *HydrateError which holds
+// all of the mismatches and leaves the actual DOM unchanged.
+func Hydrate(root dom.Element, tree *Tree) error {
+	mismatches := []Mismatch{}
+	hydrateChildren(&mismatches, []int{}, root.ChildNodes(), tree.Children)
+	if len(mismatches) > 0 {
+		return &HydrateError{Mismatches: mismatches}
+	}
+	return nil
+}
+
+// hydrateChildren compares domNodes to the virtual nodes, which are the
+// children of the node with the given index, and adds any mismatches.
+func hydrateChildren(mismatches *[]Mismatch, index []int, domNodes []dom.Node, nodes []Node) {
+	if len(domNodes) != len(nodes) {
+		*mismatches = append(*mismatches, Mismatch{
+			Index:   index,
+			Message: fmt.Sprintf("expected %d children but the actual DOM has %d", len(nodes), len(domNodes)),
+		})
+	}
+	for i := 0; i < len(nodes) && i < len(domNodes); i++ {
+		hydrateNode(mismatches, nodes[i], domNodes[i])
+	}
+}
+
+// hydrateNode compares domNode to node and adds any mismatches.
+func hydrateNode(mismatches *[]Mismatch, node Node, domNode dom.Node) {
+	mismatch := func(format string, args ...interface{}) {
+		*mismatches = append(*mismatches, Mismatch{
+			Index:   node.Index(),
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+	switch n := node.(type) {
+	case *Element:
+		if domNode.NodeType() != elementNode {
+			mismatch("expected <%s> but the actual DOM has a node of type %d", n.Name, domNode.NodeType())
+			return
+		}
+		el := domNode.(dom.Element)
+		// The actual DOM uses upper case tag names for html elements.
+		if !strings.EqualFold(el.TagName(), n.Name) {
+			mismatch("expected <%s> but the actual DOM has <%s>", n.Name, strings.ToLower(el.TagName()))
+			return
+		}
+		hydrateAttributes(mismatch, n, el.Attributes())
+		hydrateChildren(mismatches, n.Index(), domNode.ChildNodes(), n.Children())
+	case *Text:
+		if domNode.NodeType() != textNode {
+			mismatch("expected text %q but the actual DOM has a node of type %d", n.Value, domNode.NodeType())
+		} else if domNode.NodeValue() != string(n.Value) {
+			mismatch("expected text %q but the actual DOM has %q", n.Value, domNode.NodeValue())
+		}
+	case *Comment:
+		if domNode.NodeType() != commentNode {
+			mismatch("expected comment %q but the actual DOM has a node of type %d", n.Value, domNode.NodeType())
+		} else if domNode.NodeValue() != string(n.Value) {
+			mismatch("expected comment %q but the actual DOM has %q", n.Value, domNode.NodeValue())
+		}
+	case *Doctype:
+		if domNode.NodeType() != doctypeNode {
+			mismatch("expected %s but the actual DOM has a node of type %d", n.HTML(), domNode.NodeType())
+		} else if !strings.EqualFold(domNode.NodeName(), n.Name) {
+			mismatch("expected doctype %s but the actual DOM has %s", n.Name, domNode.NodeName())
+		}
+	case *CDATA:
+		// The actual DOM has a text node instead of a CDATA section.
+		if domNode.NodeType() != textNode {
+			mismatch("expected CDATA %q but the actual DOM has a node of type %d", n.Value, domNode.NodeType())
+		} else if domNode.NodeValue() != string(n.Value) {
+			mismatch("expected CDATA %q but the actual DOM has %q", n.Value, domNode.NodeValue())
+		}
+	}
+}
+
+// hydrateAttributes compares the attributes of el to the attributes of the
+// corresponding element in the actual DOM and calls mismatch for each
+// difference.
+func hydrateAttributes(mismatch func(string, ...interface{}), el *Element, domAttrs map[string]string) {
+	attrs := el.AttrMap()
+	for _, attr := range el.Attrs {
+		if domValue, found := domAttrs[attr.Name]; !found {
+			mismatch("expected attribute %s but the actual DOM does not have it", attr.Name)
+		} else if !attrValuesEqual(el.Namespace, attr.Name, domValue, attr.Value) {
+			mismatch("expected attribute %s to be %q but the actual DOM has %q", attr.Name, attr.Value, domValue)
+		}
+	}
+	extra := []string{}
+	for name := range domAttrs {
+		if _, found := attrs[name]; !found {
+			extra = append(extra, name)
+		}
+	}
+	sort.Strings(extra)
+	for _, name := range extra {
+		mismatch("the actual DOM has an unexpected attribute %s", name)
+	}
+}
+
+// The node types used by the actual DOM.
+const (
+	elementNode = 1
+	textNode    = 3
+	commentNode = 8
+	doctypeNode = 10
+)
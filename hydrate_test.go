@@ -0,0 +1,167 @@
+package vdom
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestHydrate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		domHTML  string
+		src      string
+		expected []Mismatch
+	}{
+		{
+			name:    "match",
+			domHTML: `<div class="a"><p>one</p><!--c--></div>`,
+			src:     `<div class="a"><p>one</p><!--c--></div>`,
+		},
+		{
+			name:    "different tag",
+			domHTML: `<div><span>one</span></div>`,
+			src:     `<div><p>one</p></div>`,
+			expected: []Mismatch{
+				{Index: []int{0, 0}, Message: "expected <p> but the actual DOM has <span>"},
+			},
+		},
+		{
+			name:    "different text",
+			domHTML: `<div><p>one</p></div>`,
+			src:     `<div><p>two</p></div>`,
+			expected: []Mismatch{
+				{Index: []int{0, 0, 0}, Message: `expected text "two" but the actual DOM has "one"`},
+			},
+		},
+		{
+			name:    "different attributes",
+			domHTML: `<div class="a" id="extra"><p title="x">one</p></div>`,
+			src:     `<div class="b"><p title="x" lang="en">one</p></div>`,
+			expected: []Mismatch{
+				{Index: []int{0}, Message: `expected attribute class to be "b" but the actual DOM has "a"`},
+				{Index: []int{0}, Message: "the actual DOM has an unexpected attribute id"},
+				{Index: []int{0, 0}, Message: "expected attribute lang but the actual DOM does not have it"},
+			},
+		},
+		{
+			name:    "boolean attributes written differently",
+			domHTML: `<form><input type="checkbox" checked="checked"><button disabled="">Go</button></form>`,
+			src:     `<form><input type="checkbox" checked><button disabled>Go</button></form>`,
+		},
+		{
+			name:    "different number of children",
+			domHTML: `<ul><li>one</li></ul><p>extra</p>`,
+			src:     `<ul><li>one</li><li>two</li></ul>`,
+			expected: []Mismatch{
+				{Index: []int{}, Message: "expected 1 children but the actual DOM has 2"},
+				{Index: []int{0}, Message: "expected 2 children but the actual DOM has 1"},
+			},
+		},
+		{
+			name:    "different node type",
+			domHTML: `<div><!--one--></div>`,
+			src:     `<div>one</div>`,
+			expected: []Mismatch{
+				{Index: []int{0, 0}, Message: `expected text "one" but the actual DOM has a node of type 8`},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		tree, err := Parse([]byte(tc.src))
+		if err != nil {
+			t.Fatalf("%s: Unexpected error in Parse: %s", tc.name, err.Error())
+		}
+		err = Hydrate(newMemRoot(tc.domHTML), tree)
+		if tc.expected == nil {
+			if err != nil {
+				t.Errorf("%s: Unexpected error in Hydrate: %s", tc.name, err.Error())
+			}
+			continue
+		}
+		hydrateErr, ok := err.(*HydrateError)
+		if !ok {
+			t.Errorf("%s: Expected a *HydrateError but got %#v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(hydrateErr.Mismatches, tc.expected) {
+			t.Errorf("%s: Mismatches were not correct.\nExpected: %v\nGot:      %v", tc.name, tc.expected, hydrateErr.Mismatches)
+		}
+	}
+}
+
+func TestHydrateThenPatch(t *testing.T) {
+	// Render on the "server".
+	serverTree, err := Parse([]byte(`<ul><li>one</li><li>two &amp; three</li></ul>`))
+	if err != nil {
+		t.Fatalf("Unexpected error in Parse: %s", err.Error())
+	}
+	buf := bytes.NewBuffer(nil)
+	if err := serverTree.WriteHTML(buf); err != nil {
+		t.Fatalf("Unexpected error in WriteHTML: %s", err.Error())
+	}
+	// Hydrate on the "client" with the same tree, rendered separately.
+	root := newMemRoot(buf.String())
+	servedLi := root.children[0].children[1]
+	tree, err := Parse([]byte(`<ul><li>one</li><li>two &amp; three</li></ul>`))
+	if err != nil {
+		t.Fatalf("Unexpected error in Parse: %s", err.Error())
+	}
+	if err := Hydrate(root, tree); err != nil {
+		t.Fatalf("Unexpected error in Hydrate: %s", err.Error())
+	}
+	// Now diff and patch starting from the hydrated tree.
+	newTree, err := Parse([]byte(`<ul><li>uno</li><li>two &amp; three</li></ul>`))
+	if err != nil {
+		t.Fatalf("Unexpected error in Parse: %s", err.Error())
+	}
+	patches, err := Diff(tree, newTree)
+	if err != nil {
+		t.Fatalf("Unexpected error in Diff: %s", err.Error())
+	}
+	if err := patches.Patch(root); err != nil {
+		t.Fatalf("Unexpected error in Patch: %s", err.Error())
+	}
+	if expected, got := "<ul><li>uno</li><li>two &amp; three</li></ul>", root.InnerHTML(); got != expected {
+		t.Errorf("Expected %s but got %s", expected, got)
+	}
+	if root.children[0].children[1] != servedLi {
+		t.Error("Expected the server-rendered node which did not change to be kept")
+	}
+}
+
+func TestMountHydrated(t *testing.T) {
+	log := []string{}
+	child := &testChild{text: "one", log: &log}
+	app := &testApp{title: "Title", hostTag: "section", child: child, log: &log}
+	src := "<div><h1>Title</h1><section><p>one</p></section></div>"
+	root := newMemRoot(src)
+	served := root.children[0]
+	r, err := MountHydrated(root, app)
+	if err != nil {
+		t.Fatalf("Unexpected error in MountHydrated: %s", err.Error())
+	}
+	if root.children[0] != served {
+		t.Error("Expected MountHydrated to keep the existing nodes")
+	}
+	if expected := []string{"child mounted", "app mounted"}; !reflect.DeepEqual(log, expected) {
+		t.Errorf("Expected lifecycle methods %v but got %v", expected, log)
+	}
+	child.text = "two"
+	if err := r.Render(); err != nil {
+		t.Fatalf("Unexpected error in Render: %s", err.Error())
+	}
+	if expected, got := "<div><h1>Title</h1><section><p>two</p></section></div>", root.InnerHTML(); got != expected {
+		t.Errorf("Expected %s but got %s", expected, got)
+	}
+
+	// If the actual DOM doesn't match, MountHydrated returns an error and
+	// leaves it alone.
+	other := newMemRoot("<div>something else</div>")
+	if _, err := MountHydrated(other, app); err == nil {
+		t.Error("Expected an error from MountHydrated but got none")
+	}
+	if expected, got := "<div>something else</div>", other.InnerHTML(); got != expected {
+		t.Errorf("Expected the actual DOM to be unchanged but got %s", got)
+	}
+}
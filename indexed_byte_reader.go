@@ -3,6 +3,7 @@ package vdom
 import (
 	"fmt"
 	"io"
+	"sort"
 )
 
 // NewIndexedByteReader returns a new IndexedByteReader which will
@@ -11,17 +12,70 @@ func NewIndexedByteReader(buf []byte) *IndexedByteReader {
 	return &IndexedByteReader{buf: buf}
 }
 
+// newIndexedByteReaderFrom returns a new IndexedByteReader which will read
+// from src. The bytes are added to the buffer as they are read, so searching
+// only works on the part of src that has been read so far.
+func newIndexedByteReaderFrom(src io.Reader) *IndexedByteReader {
+	return &IndexedByteReader{src: src}
+}
+
 // IndexedByteReader satisfies io.Reader and io.ByteReader and also
 // adds some additional methods for searching the buffer and returning
 // the current offset.
 type IndexedByteReader struct {
 	buf []byte
-	off int
+	// base is the offset of buf[0]. It is only greater than 0 if some bytes
+	// were discarded.
+	base int
+	off  int
+	src  io.Reader
+	err  error
+	// newlines holds the offset of each newline that has been read so far,
+	// so that we can convert offsets into line and column numbers even
+	// after the bytes are discarded.
+	newlines []int
+}
+
+// readChunkSize is the number of bytes an IndexedByteReader tries to read
+// from its src at a time.
+const readChunkSize = 512
+
+// fill reads more bytes from r.src into r.buf. It returns an error if there
+// are no more bytes to read.
+func (r *IndexedByteReader) fill() error {
+	if r.src == nil {
+		return io.EOF
+	}
+	for r.err == nil {
+		chunk := make([]byte, readChunkSize)
+		n, err := r.src.Read(chunk)
+		r.buf = append(r.buf, chunk[:n]...)
+		r.err = err
+		if n > 0 {
+			return nil
+		}
+	}
+	return r.err
+}
+
+// end returns the offset just after the last byte in r.buf.
+func (r *IndexedByteReader) end() int {
+	return r.base + len(r.buf)
 }
 
 // Read satisfies io.Reader.
 func (r *IndexedByteReader) Read(p []byte) (int, error) {
-	n := copy(p, r.buf[r.off:])
+	if r.off >= r.end() {
+		if err := r.fill(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.buf[r.off-r.base:])
+	for i, c := range p[:n] {
+		if c == '\n' {
+			r.newlines = append(r.newlines, r.off+i)
+		}
+	}
 	r.off += n
 	return n, nil
 }
@@ -30,15 +84,62 @@ func (r *IndexedByteReader) Read(p []byte) (int, error) {
 // upgrade the IndexedByteReader to a io.ByteReader and call this method
 // instead of Read.
 func (r *IndexedByteReader) ReadByte() (byte, error) {
-	if r.off >= len(r.buf) {
-		// Reached the end of the buffer
-		return 0, io.EOF
+	if r.off >= r.end() {
+		// Reached the end of the buffer. Try to read more.
+		if err := r.fill(); err != nil {
+			return 0, err
+		}
+	}
+	c := r.buf[r.off-r.base]
+	if c == '\n' {
+		r.newlines = append(r.newlines, r.off)
 	}
-	c := r.buf[r.off]
 	r.off++
 	return c, nil
 }
 
+// readUntilClosingTag reads bytes until it finds the closing tag for the
+// element with the given name, i.e. "</" and the name, followed by
+// whitespace, '/', or '>'. Like the xml decoder, the name is case sensitive. It returns the bytes before the closing tag and
+// leaves the closing tag itself unread. If there is no closing tag, it reads
+// until the end.
+func (r *IndexedByteReader) readUntilClosingTag(name string) ([]byte, error) {
+	result := []byte{}
+	// The closing tag is only found once we have read the byte after the name.
+	tagLength := len(name) + 3
+	for {
+		c, err := r.ReadByte()
+		if err == io.EOF {
+			return result, nil
+		} else if err != nil {
+			return nil, err
+		}
+		result = append(result, c)
+		if len(result) < tagLength {
+			continue
+		}
+		tag := result[len(result)-tagLength:]
+		switch tag[tagLength-1] {
+		case '>', '/', ' ', '\t', '\n', '\r', '\f':
+		default:
+			continue
+		}
+		if tag[0] == '<' && tag[1] == '/' && string(tag[2:tagLength-1]) == name {
+			r.unread(tagLength)
+			return result[:len(result)-tagLength], nil
+		}
+	}
+}
+
+// unread moves the offset of r back by n bytes, so that they are read again.
+// The bytes must not have been discarded.
+func (r *IndexedByteReader) unread(n int) {
+	r.off -= n
+	for len(r.newlines) > 0 && r.newlines[len(r.newlines)-1] >= r.off {
+		r.newlines = r.newlines[:len(r.newlines)-1]
+	}
+}
+
 // Offset returns the current offset position for r, i.e.,
 // the number of bytes that have been read so far.
 func (r *IndexedByteReader) Offset() int {
@@ -48,17 +149,86 @@ func (r *IndexedByteReader) Offset() int {
 // BackwardsSearch starts at start and iterates backwards through r.buf[min:max]
 // until it finds b. It returns the index of b if b was found within the given interval
 // and -1 if it was not. It returns an error if min or max is outside the bounds of r.buf.
+// Any bytes which were discarded are skipped.
 func (r *IndexedByteReader) BackwardsSearch(min int, max int, b byte) (int, error) {
-	if min >= len(r.buf) || min < 0 {
-		return -1, fmt.Errorf("Error in BackwardsSearch min %d is out of bounds. r has buf of length %d", min, len(r.buf))
+	if min >= r.end() || min < 0 {
+		return -1, fmt.Errorf("Error in BackwardsSearch min %d is out of bounds. r has buf of length %d", min, r.end())
 	}
-	if max >= len(r.buf) || max < min {
-		return -1, fmt.Errorf("Error in BackwardsSearch max %d is out of bounds. r has buf of length %d and min was %d", min, len(r.buf), min)
+	if max >= r.end() || max < min {
+		return -1, fmt.Errorf("Error in BackwardsSearch max %d is out of bounds. r has buf of length %d and min was %d", min, r.end(), min)
+	}
+	if min < r.base {
+		min = r.base
 	}
 	for j := max; j >= min; j-- {
-		if r.buf[j] == b {
+		if r.buf[j-r.base] == b {
 			return j, nil
 		}
 	}
 	return -1, nil
 }
+
+// bytesBetween returns the bytes from start up to (but not including) stop.
+// It returns false if any of them were discarded.
+func (r *IndexedByteReader) bytesBetween(start, stop int) ([]byte, bool) {
+	if start < r.base || stop > r.end() {
+		return nil, false
+	}
+	return r.buf[start-r.base : stop-r.base], true
+}
+
+// discardBefore lets r free the memory for the bytes before offset, which
+// will no longer be needed. To avoid copying the buffer too often, the
+// bytes are only discarded once there are enough of them.
+func (r *IndexedByteReader) discardBefore(offset int) {
+	n := offset - r.base
+	if n < readChunkSize || n < len(r.buf)/2 {
+		return
+	}
+	r.buf = append([]byte{}, r.buf[n:]...)
+	r.base = offset
+}
+
+// position returns the line and column for the given offset, which must not
+// be after the current offset.
+func (r *IndexedByteReader) position(offset int) Position {
+	// line is the number of newlines before offset.
+	line := sort.SearchInts(r.newlines, offset)
+	lineStart := 0
+	if line > 0 {
+		lineStart = r.newlines[line-1] + 1
+	}
+	return Position{
+		Offset: offset,
+		Line:   line + 1,
+		Column: offset - lineStart + 1,
+	}
+}
+
+// span returns the Pos from start to end.
+func (r *IndexedByteReader) span(start, end int) Pos {
+	return Pos{
+		Start: r.position(start),
+		End:   r.position(end),
+	}
+}
+
+// parseError returns a *ParseError for the given offset. The snippet is the
+// line containing offset, without any bytes that were discarded or have not
+// been read yet.
+func (r *IndexedByteReader) parseError(offset int, message string) *ParseError {
+	pos := r.position(offset)
+	start := offset - pos.Column + 1
+	if start < r.base {
+		start = r.base
+	}
+	end := start
+	for end < r.end() && r.buf[end-r.base] != '\n' {
+		end++
+	}
+	return &ParseError{
+		Pos:     pos,
+		Message: message,
+		Snippet: string(r.buf[start-r.base : end-r.base]),
+	}
+}
@@ -12,6 +12,9 @@ import (
 var (
 	document = dom.GetWindow().Document()
 	sandbox  dom.Element
+	// replaceChildrenRatios are the values of DiffOptions.ReplaceChildrenRatio
+	// to compare against each other.
+	replaceChildrenRatios = []float64{0.25, 0.5, 1}
 )
 
 func init() {
@@ -86,6 +89,23 @@ func benchmarkRenderList(root dom.Element, numItems, numChanges int) {
 				panic(err)
 			}
 		})
+
+		for _, ratio := range replaceChildrenRatios {
+			opts := vdom.DiffOptions{ReplaceChildrenRatio: ratio}
+			js.Global.Call("benchmark", fmt.Sprintf("with virtual DOM and ReplaceChildrenRatio %.2f", ratio), func() {
+				newTree, err := vdom.Parse(newHTML)
+				if err != nil {
+					panic(err)
+				}
+				patches, err := vdom.DiffWithOptions(oldTree, newTree, opts)
+				if err != nil {
+					panic(err)
+				}
+				if err := patches.Patch(root); err != nil {
+					panic(err)
+				}
+			})
+		}
 	}, js.MakeWrapper(map[string]interface{}{
 		"setup": func() {
 			root.SetInnerHTML(string(oldHTML))
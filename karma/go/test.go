@@ -96,6 +96,36 @@ func main() {
 			ul := body.ChildNodes()[0].(*dom.HTMLUListElement)
 			jasmine.Expect(ul.InnerHTML()).ToBe("<li>one</li><li>two</li><li>three</li>")
 		})
+
+		jasmine.It("keeps the contents of raw text and rcdata elements", func() {
+			createAndApplyPatcher(body, "<div></div>", func(tree *vdom.Tree) vdom.Patcher {
+				newTree, err := vdom.Parse([]byte(`<div><style>p > b { content: "&lt;"; }</style><textarea>&lt;b&gt;</textarea></div>`))
+				jasmine.Expect(err).ToBe(nil)
+				return &vdom.ReplaceChildren{
+					Parent:   tree.Children[0].(*vdom.Element),
+					Children: newTree.Children[0].Children(),
+				}
+			})
+			div := body.ChildNodes()[0]
+			jasmine.Expect(div.ChildNodes()[0].TextContent()).ToBe(`p > b { content: "&lt;"; }`)
+			jasmine.Expect(div.ChildNodes()[1].TextContent()).ToBe("<b>")
+		})
+
+		jasmine.It("creates svg elements with the svg namespace", func() {
+			createAndApplyPatcher(body, "<div></div>", func(tree *vdom.Tree) vdom.Patcher {
+				newTree, err := vdom.Parse([]byte(`<div><svg><use xlink:href="#icon"></use></svg></div>`))
+				jasmine.Expect(err).ToBe(nil)
+				return &vdom.Append{
+					Child:  newTree.Children[0].Children()[0],
+					Parent: tree.Children[0].(*vdom.Element),
+				}
+			})
+			svg := body.ChildNodes()[0].ChildNodes()[0]
+			jasmine.Expect(svg.Underlying().Get("namespaceURI").String()).ToBe(vdom.SVGNamespace)
+			use := svg.ChildNodes()[0].(dom.Element)
+			jasmine.Expect(use.Underlying().Get("namespaceURI").String()).ToBe(vdom.SVGNamespace)
+			jasmine.Expect(use.GetAttributeNS(vdom.XLinkNamespace, "href")).ToBe("#icon")
+		})
 	})
 
 	// Test the Replace Patcher in the actual DOM with various different html
@@ -161,6 +191,160 @@ func main() {
 		})
 	})
 
+	// Test the Insert Patcher in the actual DOM with various different html
+	// structures.
+	jasmine.Describe("Insert", func() {
+
+		jasmine.It("works with root nodes", func() {
+			newTree, err := vdom.Parse([]byte("<div></div>Text<!--comment-->"))
+			jasmine.Expect(err).ToBe(nil)
+			createAndApplyPatcher(body, "<div></div><!--comment-->", func(tree *vdom.Tree) vdom.Patcher {
+				return &vdom.Insert{
+					Child: newTree.Children[1],
+				}
+			})
+			// Test that the patch was applied
+			jasmine.Expect(body.InnerHTML()).ToBe("<div></div>Text<!--comment-->")
+		})
+
+		jasmine.It("works with nested siblings", func() {
+			newTree, err := vdom.Parse([]byte("<ul><li>one</li><li>two</li><li>three</li></ul>"))
+			jasmine.Expect(err).ToBe(nil)
+			createAndApplyPatcher(body, "<ul><li>one</li><li>three</li></ul>", func(tree *vdom.Tree) vdom.Patcher {
+				return &vdom.Insert{
+					Parent: tree.Children[0].(*vdom.Element),
+					Child:  newTree.Children[0].Children()[1],
+				}
+			})
+			// Test that the patch was applied by checking the innerHTML
+			// property of the ul node.
+			ul := body.ChildNodes()[0].(*dom.HTMLUListElement)
+			jasmine.Expect(ul.InnerHTML()).ToBe("<li>one</li><li>two</li><li>three</li>")
+		})
+	})
+
+	// Test the RemoveRange Patcher in the actual DOM with various different html
+	// structures.
+	jasmine.Describe("RemoveRange", func() {
+
+		jasmine.It("works with root nodes", func() {
+			createAndApplyPatcher(body, "<div></div>Text<!--comment-->", func(tree *vdom.Tree) vdom.Patcher {
+				return &vdom.RemoveRange{
+					Nodes: tree.Children[1:],
+				}
+			})
+			// Test that the patch was applied
+			jasmine.Expect(body.InnerHTML()).ToBe("<div></div>")
+		})
+
+		jasmine.It("works with nested siblings", func() {
+			createAndApplyPatcher(body, "<ul><li>one</li><li>two</li><li>three</li><li>four</li></ul>", func(tree *vdom.Tree) vdom.Patcher {
+				return &vdom.RemoveRange{
+					Nodes: tree.Children[0].Children()[1:3],
+				}
+			})
+			// Test that the patch was applied by checking the innerHTML
+			// property of the ul node.
+			ul := body.ChildNodes()[0].(*dom.HTMLUListElement)
+			jasmine.Expect(ul.InnerHTML()).ToBe("<li>one</li><li>four</li>")
+		})
+	})
+
+	// Test the ReplaceChildren Patcher in the actual DOM with various different
+	// html structures.
+	jasmine.Describe("ReplaceChildren", func() {
+
+		jasmine.It("works with root nodes", func() {
+			createAndApplyPatcher(body, "<div></div>Text", func(tree *vdom.Tree) vdom.Patcher {
+				newTree, err := vdom.Parse([]byte("<span></span><!--comment-->"))
+				jasmine.Expect(err).ToBe(nil)
+				return &vdom.ReplaceChildren{
+					Children: newTree.Children,
+				}
+			})
+			// Test that the patch was applied
+			jasmine.Expect(body.InnerHTML()).ToBe("<span></span><!--comment-->")
+		})
+
+		jasmine.It("works with nested siblings", func() {
+			createAndApplyPatcher(body, "<ul><li>one</li><li>two</li></ul>", func(tree *vdom.Tree) vdom.Patcher {
+				newTree, err := vdom.Parse([]byte("<ul><li>uno</li><li>dos</li><li>tres</li></ul>"))
+				jasmine.Expect(err).ToBe(nil)
+				return &vdom.ReplaceChildren{
+					Parent:   tree.Children[0].(*vdom.Element),
+					Children: newTree.Children[0].Children(),
+				}
+			})
+			// Test that the patch was applied by checking the innerHTML
+			// property of the ul node.
+			ul := body.ChildNodes()[0].(*dom.HTMLUListElement)
+			jasmine.Expect(ul.InnerHTML()).ToBe("<li>uno</li><li>dos</li><li>tres</li>")
+		})
+	})
+
+	// Test the SetText Patcher in the actual DOM with various different html
+	// structures.
+	jasmine.Describe("SetText", func() {
+
+		jasmine.It("works with a root text node", func() {
+			createAndApplyPatcher(body, "Old", func(tree *vdom.Tree) vdom.Patcher {
+				return &vdom.SetText{
+					Node:  tree.Children[0].(*vdom.Text),
+					Value: []byte("New"),
+				}
+			})
+			// Test that the patch was applied
+			jasmine.Expect(body.InnerHTML()).ToBe("New")
+		})
+
+		jasmine.It("keeps the same node in the actual DOM", func() {
+			tree := setUpDOM("<div>Old</div>", body)
+			textNode := body.ChildNodes()[0].ChildNodes()[0]
+			patch := &vdom.SetText{
+				Node:  tree.Children[0].Children()[0].(*vdom.Text),
+				Value: []byte("New"),
+			}
+			err := patch.Patch(body)
+			jasmine.Expect(err).ToBe(nil)
+			// Test that the patch was applied to the same node
+			jasmine.Expect(body.InnerHTML()).ToBe("<div>New</div>")
+			jasmine.Expect(body.ChildNodes()[0].ChildNodes()[0].Underlying() == textNode.Underlying()).ToBe(true)
+		})
+	})
+
+	// Test the SetComment Patcher in the actual DOM with various different html
+	// structures.
+	jasmine.Describe("SetComment", func() {
+
+		jasmine.It("works with a nested comment", func() {
+			createAndApplyPatcher(body, "<div><!--old--></div>", func(tree *vdom.Tree) vdom.Patcher {
+				return &vdom.SetComment{
+					Node:  tree.Children[0].Children()[0].(*vdom.Comment),
+					Value: []byte("new"),
+				}
+			})
+			// Test that the patch was applied
+			jasmine.Expect(body.InnerHTML()).ToBe("<div><!--new--></div>")
+		})
+	})
+
+	// Test the SetProperty Patcher in the actual DOM.
+	jasmine.Describe("SetProperty", func() {
+
+		jasmine.It("sets the value of an input", func() {
+			createAndApplyPatcher(body, `<form><input type="text" value="old"></form>`, func(tree *vdom.Tree) vdom.Patcher {
+				return &vdom.SetProperty{
+					Node:  tree.Children[0].Children()[0],
+					Name:  "value",
+					Value: "new",
+				}
+			})
+			// Test that the patch was applied
+			input := body.QuerySelector("input").(*dom.HTMLInputElement)
+			jasmine.Expect(input.Value).ToBe("new")
+		})
+	})
+
 	// Test the SetAttr Patcher in the actual DOM with various different html
 	// structures.
 	jasmine.Describe("SetAttr", func() {
@@ -224,6 +408,36 @@ func main() {
 
 	})
 
+	// Test the AddClass and RemoveClass Patchers in the actual DOM.
+	jasmine.Describe("AddClass", func() {
+
+		jasmine.It("leaves other classes alone", func() {
+			createAndApplyPatcher(body, `<div class="one two"></div>`, func(tree *vdom.Tree) vdom.Patcher {
+				return vdom.PatchSet{
+					&vdom.AddClass{Node: tree.Children[0], Class: "three"},
+					&vdom.RemoveClass{Node: tree.Children[0], Class: "one"},
+				}
+			})
+			// Test that the patch was applied
+			jasmine.Expect(body.InnerHTML()).ToBe(`<div class="two three"></div>`)
+		})
+	})
+
+	// Test the SetStyle and RemoveStyle Patchers in the actual DOM.
+	jasmine.Describe("SetStyle", func() {
+
+		jasmine.It("leaves other properties alone", func() {
+			createAndApplyPatcher(body, `<div style="color: red; margin: 0px;"></div>`, func(tree *vdom.Tree) vdom.Patcher {
+				return vdom.PatchSet{
+					&vdom.SetStyle{Node: tree.Children[0], Style: &vdom.StyleDeclaration{Property: "color", Value: "blue"}},
+					&vdom.RemoveStyle{Node: tree.Children[0], Property: "margin"},
+				}
+			})
+			// Test that the patch was applied
+			jasmine.Expect(body.InnerHTML()).ToBe(`<div style="color: blue;"></div>`)
+		})
+	})
+
 	// Test the Diff function in the actual DOM with various different html
 	// structures.
 	jasmine.Describe("Diff", func() {
@@ -336,6 +550,57 @@ func main() {
 			testDiff(body, "<ul><li>one</li><li>two</li><li>three</li></ul>", "<ul><li>one</li><li>dos</li><li>three</li></ul>")
 		})
 
+		jasmine.It("removes multiple root nodes when optimized", func() {
+			testOptimizedDiff(body, "<div></div><span></span><p></p>", "<div></div>")
+		})
+
+		jasmine.It("removes multiple nested elements when optimized", func() {
+			testOptimizedDiff(body, "<ul><li>one</li><li>two</li><li>three</li></ul>", "<ul><li>one</li></ul>")
+		})
+
+		jasmine.It("changes the value of an input after the user has typed into it", func() {
+			tree := setUpDOM(`<form><input type="text" value="old"></form>`, body)
+			// Simulate the user typing into the input
+			input := body.QuerySelector("input").(*dom.HTMLInputElement)
+			input.Value = "typed"
+			newTree, err := vdom.Parse([]byte(`<form><input type="text" value="new"></form>`))
+			jasmine.Expect(err).ToBe(nil)
+			patches, err := vdom.Diff(tree, newTree)
+			jasmine.Expect(err).ToBe(nil)
+			err = patches.Patch(body)
+			jasmine.Expect(err).ToBe(nil)
+			jasmine.Expect(input.Value).ToBe("new")
+		})
+
+		jasmine.It("does not change the value of an input if the attribute did not change", func() {
+			tree := setUpDOM(`<form><input type="text" value="old"></form>`, body)
+			// Simulate the user typing into the input
+			input := body.QuerySelector("input").(*dom.HTMLInputElement)
+			input.Value = "typed"
+			newTree, err := vdom.Parse([]byte(`<form class="dirty"><input type="text" value="old"></form>`))
+			jasmine.Expect(err).ToBe(nil)
+			patches, err := vdom.Diff(tree, newTree)
+			jasmine.Expect(err).ToBe(nil)
+			err = patches.Patch(body)
+			jasmine.Expect(err).ToBe(nil)
+			jasmine.Expect(input.Value).ToBe("typed")
+		})
+
+		jasmine.It("checks a checkbox after the user has unchecked it", func() {
+			tree := setUpDOM(`<form><input type="checkbox"></form>`, body)
+			// Simulate the user checking and then unchecking the checkbox
+			input := body.QuerySelector("input").(*dom.HTMLInputElement)
+			input.Checked = true
+			input.Checked = false
+			newTree, err := vdom.Parse([]byte(`<form><input type="checkbox" checked></form>`))
+			jasmine.Expect(err).ToBe(nil)
+			patches, err := vdom.Diff(tree, newTree)
+			jasmine.Expect(err).ToBe(nil)
+			err = patches.Patch(body)
+			jasmine.Expect(err).ToBe(nil)
+			jasmine.Expect(input.Checked).ToBe(true)
+		})
+
 		jasmine.It("adds/replaces multiple attributes", func() {
 			// Since the order of attributes can change, we'll have to do this test
 			// manually
@@ -373,6 +638,144 @@ func main() {
 		})
 
 	})
+
+	// Test that the Dispatcher routes events in the actual DOM to the
+	// listeners in the virtual tree.
+	jasmine.Describe("Dispatcher", func() {
+
+		jasmine.It("calls listeners as the event bubbles", func() {
+			tree := setUpDOM("<div><ul><li><a>one</a></li></ul></div>", body)
+			got := []string{}
+			div := tree.Children[0].(*vdom.Element)
+			div.AddEventListener("click", func(ev *vdom.Event) {
+				got = append(got, ev.CurrentTarget.Name)
+			})
+			li := div.Children()[0].Children()[0].(*vdom.Element)
+			li.AddEventListener("click", func(ev *vdom.Event) {
+				got = append(got, ev.CurrentTarget.Name)
+			})
+			d := vdom.NewDispatcher(body, tree)
+			defer d.Close()
+			body.QuerySelector("a").(*dom.HTMLAnchorElement).Click()
+			jasmine.Expect(got).ToEqual([]string{"li", "div"})
+		})
+
+		jasmine.It("calls listeners added by patches", func() {
+			tree := setUpDOM("<div><p>one</p></div>", body)
+			d := vdom.NewDispatcher(body, tree)
+			defer d.Close()
+			newTree, err := vdom.Parse([]byte("<div><button>one</button></div>"))
+			jasmine.Expect(err).ToBe(nil)
+			clicks := 0
+			newTree.Children[0].Children()[0].(*vdom.Element).AddEventListener("click", func(*vdom.Event) {
+				clicks++
+			})
+			patches, err := vdom.Diff(tree, newTree)
+			jasmine.Expect(err).ToBe(nil)
+			err = patches.Patch(body)
+			jasmine.Expect(err).ToBe(nil)
+			d.SetTree(newTree)
+			body.QuerySelector("button").(*dom.HTMLButtonElement).Click()
+			jasmine.Expect(clicks).ToBe(1)
+		})
+
+		jasmine.It("is found through a different wrapper for the root", func() {
+			tree := setUpDOM("<div>one</div>", body)
+			d := vdom.NewDispatcher(dom.WrapElement(body.Underlying()), tree)
+			defer d.Close()
+			clicks := 0
+			patch := &vdom.SetListener{
+				Node:     tree.Children[0].(*vdom.Element),
+				Listener: vdom.Listener{Type: "click", Handler: func(*vdom.Event) { clicks++ }},
+			}
+			err := patch.Patch(dom.WrapElement(body.Underlying()))
+			jasmine.Expect(err).ToBe(nil)
+			tree.Children[0].(*vdom.Element).AddEventListener("click", func(*vdom.Event) { clicks++ })
+			body.QuerySelector("div").(*dom.HTMLDivElement).Click()
+			jasmine.Expect(clicks).ToBe(1)
+		})
+	})
+
+	// Test that Hydrate adopts existing html in the actual DOM.
+	jasmine.Describe("Hydrate", func() {
+
+		jasmine.It("adopts matching html", func() {
+			body.SetInnerHTML(`<ul class="list"><li>one</li><li>two</li></ul>`)
+			tree, err := vdom.Parse([]byte(`<ul class="list"><li>one</li><li>two</li></ul>`))
+			jasmine.Expect(err).ToBe(nil)
+			err = vdom.Hydrate(body, tree)
+			jasmine.Expect(err).ToBe(nil)
+		})
+
+		jasmine.It("reports mismatches", func() {
+			body.SetInnerHTML(`<ul><li>one</li></ul>`)
+			tree, err := vdom.Parse([]byte(`<ul class="list"><li>uno</li></ul>`))
+			jasmine.Expect(err).ToBe(nil)
+			err = vdom.Hydrate(body, tree)
+			jasmine.Expect(len(err.(*vdom.HydrateError).Mismatches)).ToBe(2)
+		})
+	})
+
+	// Test that ParseFragment makes the same tree as the browser.
+	jasmine.Describe("ParseFragment", func() {
+
+		jasmine.It("wraps table rows in a tbody", func() {
+			src := `<tr><td>one</td></tr><tr><td>two</td></tr>`
+			table := document.CreateElement("table")
+			table.SetInnerHTML(src)
+			tree, err := vdom.ParseFragment([]byte(src), &vdom.Element{Name: "table"})
+			jasmine.Expect(err).ToBe(nil)
+			jasmine.Expect(string(tree.HTML())).ToBe(table.InnerHTML())
+		})
+
+		jasmine.It("drops elements inside of a select", func() {
+			src := `<option>one</option><div>two</div>`
+			sel := document.CreateElement("select")
+			sel.SetInnerHTML(src)
+			tree, err := vdom.ParseFragment([]byte(src), &vdom.Element{Name: "select"})
+			jasmine.Expect(err).ToBe(nil)
+			jasmine.Expect(string(tree.HTML())).ToBe(sel.InnerHTML())
+		})
+	})
+
+	// Test the patchers which target the document instead of a root.
+	jasmine.Describe("Document", func() {
+
+		jasmine.It("sets the title", func() {
+			htmlDoc := document.(dom.HTMLDocument)
+			oldTitle := htmlDoc.Title()
+			defer htmlDoc.SetTitle(oldTitle)
+			err := (&vdom.SetTitle{Title: "vdom test"}).Patch(body)
+			jasmine.Expect(err).ToBe(nil)
+			jasmine.Expect(htmlDoc.Title()).ToBe("vdom test")
+		})
+	})
+
+	// Test that Mount renders components into the actual DOM.
+	jasmine.Describe("Mount", func() {
+
+		jasmine.It("renders and re-renders a component", func() {
+			c := &karmaComponent{text: "one"}
+			r, err := vdom.Mount(body, c)
+			jasmine.Expect(err).ToBe(nil)
+			defer r.Unmount()
+			jasmine.Expect(body.InnerHTML()).ToBe("<div><p>one</p></div>")
+			c.text = "two"
+			err = r.Render()
+			jasmine.Expect(err).ToBe(nil)
+			jasmine.Expect(body.InnerHTML()).ToBe("<div><p>two</p></div>")
+		})
+	})
+}
+
+// karmaComponent is a simple component which renders its text inside of a
+// paragraph.
+type karmaComponent struct {
+	text string
+}
+
+func (c *karmaComponent) Render() (*vdom.Tree, error) {
+	return vdom.Parse([]byte("<div><p>" + c.text + "</p></div>"))
 }
 
 // setUpDOM parses html into a virtual tree, then adds it to the
@@ -527,3 +930,24 @@ func testDiff(root dom.Element, oldHTML string, newHTML string) {
 	// expected
 	jasmine.Expect(root.InnerHTML()).ToBe(newHTML)
 }
+
+// testOptimizedDiff is like testDiff, but it optimizes the patch set returned
+// from Diff before applying it.
+func testOptimizedDiff(root dom.Element, oldHTML string, newHTML string) {
+	// Parse some source oldHTML into a tree and add it
+	// to the actual DOM
+	tree := setUpDOM(oldHTML, root)
+	// Create a virtual tree with the newHTML
+	newTree, err := vdom.Parse([]byte(newHTML))
+	jasmine.Expect(err).ToBe(nil)
+	// Use the diff function to calculate the difference between
+	// the trees and optimize the resulting patch set
+	patches, err := vdom.Diff(tree, newTree)
+	jasmine.Expect(err).ToBe(nil)
+	patches = patches.Optimize()
+	// Apply the patches to the root in the actual DOM
+	err = patches.Patch(root)
+	jasmine.Expect(err).ToBe(nil)
+	// Check that the root now has innerHTML equal to newHTML
+	jasmine.Expect(root.InnerHTML()).ToBe(newHTML)
+}
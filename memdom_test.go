@@ -0,0 +1,488 @@
+package vdom
+
+import (
+	"html"
+	"sort"
+	"strings"
+
+	"github.com/gopherjs/gopherjs/js"
+	"honnef.co/go/js/dom"
+)
+
+func init() {
+	// The go tests don't have access to a browser, so we create nodes in an
+	// in-memory DOM instead.
+	creator = memDocument{}
+	setProperty = func(node dom.Node, name string, value interface{}) {
+		n := node.(*memNode)
+		if n.props == nil {
+			n.props = map[string]interface{}{}
+		}
+		n.props[name] = value
+	}
+	callNodeMethod = func(node dom.Node, object string, method string, args ...interface{}) {
+		node.(*memNode).callMethod(object, method, args...)
+	}
+}
+
+// memDocument is a nodeCreator which creates memNodes.
+type memDocument struct{}
+
+func (memDocument) CreateElement(name string) dom.Element {
+	return &memNode{nodeType: elementNode, name: name}
+}
+
+func (memDocument) CreateElementNS(namespace, name string) dom.Element {
+	return &memNode{nodeType: elementNode, name: name, namespace: namespace}
+}
+
+func (memDocument) CreateTextNode(value string) dom.Node {
+	return &memNode{nodeType: textNode, value: value}
+}
+
+func (memDocument) CreateComment(value string) dom.Node {
+	return &memNode{nodeType: commentNode, value: value}
+}
+
+func (memDocument) CreateDoctype(name, publicID, systemID string) dom.Node {
+	return &memNode{nodeType: doctypeNode, name: name}
+}
+
+// memNode is a minimal in-memory implementation of dom.Element which lets us
+// apply patches in pure go tests. It only implements the methods which are
+// actually used by the patches. Calling any other method will panic.
+type memNode struct {
+	dom.Element
+	nodeType  int
+	name      string
+	namespace string
+	value     string
+	attrs     []Attr
+	// attrNamespaces holds the namespace of each attribute which was set
+	// with SetAttributeNS.
+	attrNamespaces map[string]string
+	props          map[string]interface{}
+	events         map[string][]memListener
+	parent         *memNode
+	children       []*memNode
+}
+
+// newMemRoot returns a new root element for an in-memory DOM with the
+// given inner html.
+func newMemRoot(innerHTML string) *memNode {
+	root := &memNode{nodeType: elementNode, name: "body"}
+	root.SetInnerHTML(innerHTML)
+	return root
+}
+
+// Underlying returns nil, since there is no js object behind a memNode.
+func (n *memNode) Underlying() *js.Object {
+	return nil
+}
+
+func (n *memNode) NodeType() int {
+	return n.nodeType
+}
+
+func (n *memNode) NodeName() string {
+	return n.name
+}
+
+func (n *memNode) TagName() string {
+	return n.name
+}
+
+func (n *memNode) NodeValue() string {
+	return n.value
+}
+
+func (n *memNode) SetNodeValue(value string) {
+	n.value = value
+}
+
+func (n *memNode) ParentNode() dom.Node {
+	if n.parent == nil {
+		return nil
+	}
+	return n.parent
+}
+
+func (n *memNode) ChildNodes() []dom.Node {
+	nodes := make([]dom.Node, len(n.children))
+	for i, child := range n.children {
+		nodes[i] = child
+	}
+	return nodes
+}
+
+func (n *memNode) indexOf(child dom.Node) int {
+	for i, c := range n.children {
+		if c == child {
+			return i
+		}
+	}
+	panic("memNode: node is not a child")
+}
+
+func (n *memNode) detach(child *memNode) {
+	if child.parent != nil {
+		child.parent.RemoveChild(child)
+	}
+}
+
+func (n *memNode) AppendChild(child dom.Node) {
+	c := child.(*memNode)
+	n.detach(c)
+	c.parent = n
+	n.children = append(n.children, c)
+}
+
+func (n *memNode) InsertBefore(which dom.Node, before dom.Node) {
+	if before == nil {
+		n.AppendChild(which)
+		return
+	}
+	c := which.(*memNode)
+	n.detach(c)
+	i := n.indexOf(before)
+	c.parent = n
+	n.children = append(n.children[:i], append([]*memNode{c}, n.children[i:]...)...)
+}
+
+func (n *memNode) RemoveChild(child dom.Node) {
+	i := n.indexOf(child)
+	n.children = append(n.children[:i], n.children[i+1:]...)
+	child.(*memNode).parent = nil
+}
+
+func (n *memNode) ReplaceChild(newChild, oldChild dom.Node) {
+	c := newChild.(*memNode)
+	n.detach(c)
+	i := n.indexOf(oldChild)
+	c.parent = n
+	n.children[i] = c
+	oldChild.(*memNode).parent = nil
+}
+
+func (n *memNode) GetAttribute(name string) string {
+	for _, attr := range n.attrs {
+		if attr.Name == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+func (n *memNode) Attributes() map[string]string {
+	attrs := map[string]string{}
+	for _, attr := range n.attrs {
+		attrs[attr.Name] = attr.Value
+	}
+	return attrs
+}
+
+func (n *memNode) HasAttribute(name string) bool {
+	for _, attr := range n.attrs {
+		if attr.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *memNode) SetAttribute(name, value string) {
+	for i, attr := range n.attrs {
+		if attr.Name == name {
+			n.attrs[i].Value = value
+			return
+		}
+	}
+	n.attrs = append(n.attrs, Attr{Name: name, Value: value})
+}
+
+func (n *memNode) RemoveAttribute(name string) {
+	for i, attr := range n.attrs {
+		if attr.Name == name {
+			n.attrs = append(n.attrs[:i], n.attrs[i+1:]...)
+			delete(n.attrNamespaces, name)
+			return
+		}
+	}
+}
+
+func (n *memNode) SetAttributeNS(namespace, name, value string) {
+	n.SetAttribute(name, value)
+	if n.attrNamespaces == nil {
+		n.attrNamespaces = map[string]string{}
+	}
+	n.attrNamespaces[name] = namespace
+}
+
+// RemoveAttributeNS removes the attribute with the given namespace and local
+// name, i.e. the name without a prefix.
+func (n *memNode) RemoveAttributeNS(namespace, localName string) {
+	for _, attr := range n.attrs {
+		if n.attrNamespaces[attr.Name] != namespace {
+			continue
+		}
+		if name := attr.Name; name == localName || strings.HasSuffix(name, ":"+localName) {
+			n.RemoveAttribute(name)
+			return
+		}
+	}
+}
+
+// callMethod implements the methods of classList and style which are called
+// by patches, by changing the class and style attributes the same way the
+// browser would.
+func (n *memNode) callMethod(object, method string, args ...interface{}) {
+	switch object + "." + method {
+	case "classList.add":
+		classes := parseClasses(n.GetAttribute("class"))
+		for _, class := range classes {
+			if class == args[0].(string) {
+				return
+			}
+		}
+		n.SetAttribute("class", strings.Join(append(classes, args[0].(string)), " "))
+	case "classList.remove":
+		if !n.HasAttribute("class") {
+			return
+		}
+		classes := []string{}
+		for _, class := range parseClasses(n.GetAttribute("class")) {
+			if class != args[0].(string) {
+				classes = append(classes, class)
+			}
+		}
+		n.SetAttribute("class", strings.Join(classes, " "))
+	case "style.setProperty":
+		decl := StyleDeclaration{
+			Property:  args[0].(string),
+			Value:     args[1].(string),
+			Important: args[2].(string) == "important",
+		}
+		decls := parseStyle(n.GetAttribute("style"))
+		found := false
+		for i := range decls {
+			if decls[i].Property == decl.Property {
+				decls[i] = decl
+				found = true
+			}
+		}
+		if !found {
+			decls = append(decls, decl)
+		}
+		n.setStyle(decls)
+	case "style.removeProperty":
+		if !n.HasAttribute("style") {
+			return
+		}
+		decls := []StyleDeclaration{}
+		for _, decl := range parseStyle(n.GetAttribute("style")) {
+			if decl.Property != args[0].(string) {
+				decls = append(decls, decl)
+			}
+		}
+		n.setStyle(decls)
+	default:
+		panic("memNode does not implement " + object + "." + method)
+	}
+}
+
+// setStyle sets the style attribute to the given declarations, in the same
+// format as the browser's cssText.
+func (n *memNode) setStyle(decls []StyleDeclaration) {
+	parts := make([]string, len(decls))
+	for i, decl := range decls {
+		parts[i] = decl.String() + ";"
+	}
+	n.SetAttribute("style", strings.Join(parts, " "))
+}
+
+// SetInnerHTML uses ParseFragment to convert html into memNodes, with n as
+// the context just like the browser.
+func (n *memNode) SetInnerHTML(innerHTML string) {
+	for _, child := range n.children {
+		child.parent = nil
+	}
+	n.children = nil
+	tree, err := ParseFragment([]byte(innerHTML), &Element{Name: n.name, Namespace: n.namespace})
+	if err != nil {
+		panic(err)
+	}
+	for _, child := range tree.Children {
+		n.AppendChild(newMemNode(child))
+	}
+}
+
+// newMemNode recursively converts a virtual node into a memNode.
+func newMemNode(node Node) *memNode {
+	switch vNode := node.(type) {
+	case *Element:
+		n := &memNode{nodeType: elementNode, name: vNode.Name, namespace: vNode.Namespace}
+		for _, attr := range vNode.Attrs {
+			if namespace := attrNamespace(vNode.Namespace, attr.Name); namespace != "" {
+				n.SetAttributeNS(namespace, attr.Name, attr.Value)
+			} else {
+				n.SetAttribute(attr.Name, attr.Value)
+			}
+		}
+		for _, child := range vNode.Children() {
+			n.AppendChild(newMemNode(child))
+		}
+		return n
+	case *Text:
+		return &memNode{nodeType: textNode, value: string(vNode.Value)}
+	case *Comment:
+		return &memNode{nodeType: commentNode, value: string(vNode.Value)}
+	case *Doctype:
+		return &memNode{nodeType: doctypeNode, name: vNode.Name}
+	case *CDATA:
+		// Just like the browser, a CDATA section becomes a text node.
+		return &memNode{nodeType: textNode, value: string(vNode.Value)}
+	}
+	panic("memNode: unexpected node type")
+}
+
+func (n *memNode) InnerHTML() string {
+	return n.innerHTML(false)
+}
+
+func (n *memNode) OuterHTML() string {
+	return n.outerHTML(false)
+}
+
+// CanonicalHTML returns the inner html of n with the attributes of each
+// element sorted by name. Two DOMs with the same CanonicalHTML are
+// equivalent, even if attributes were added in a different order.
+func (n *memNode) CanonicalHTML() string {
+	return n.innerHTML(true)
+}
+
+func (n *memNode) innerHTML(sortAttrs bool) string {
+	result := ""
+	for _, child := range n.children {
+		result += child.outerHTML(sortAttrs)
+	}
+	return result
+}
+
+func (n *memNode) outerHTML(sortAttrs bool) string {
+	switch n.nodeType {
+	case textNode:
+		return html.EscapeString(n.value)
+	case commentNode:
+		return "<!--" + n.value + "-->"
+	case doctypeNode:
+		return "<!DOCTYPE " + n.name + ">"
+	}
+	attrs := append([]Attr{}, n.attrs...)
+	if sortAttrs {
+		sort.Slice(attrs, func(i, j int) bool { return attrs[i].Name < attrs[j].Name })
+	}
+	result := "<" + n.name
+	for _, attr := range attrs {
+		result += " " + attr.Name + `="` + html.EscapeString(attr.Value) + `"`
+	}
+	if voidElements[n.name] {
+		return result + ">"
+	}
+	return result + ">" + n.innerHTML(sortAttrs) + "</" + n.name + ">"
+}
+
+// memListener is an event listener which was added to a memNode.
+type memListener struct {
+	useCapture bool
+	listener   func(dom.Event)
+}
+
+// AddEventListener adds a listener which is called by DispatchEvent.
+func (n *memNode) AddEventListener(typ string, useCapture bool, listener func(dom.Event)) func(*js.Object) {
+	if n.events == nil {
+		n.events = map[string][]memListener{}
+	}
+	n.events[typ] = append(n.events[typ], memListener{useCapture, listener})
+	return nil
+}
+
+// RemoveEventListener removes every listener for the given type and phase.
+// We can't compare functions, but this is enough for the tests.
+func (n *memNode) RemoveEventListener(typ string, useCapture bool, listener func(*js.Object)) {
+	listeners := []memListener{}
+	for _, l := range n.events[typ] {
+		if l.useCapture != useCapture {
+			listeners = append(listeners, l)
+		}
+	}
+	n.events[typ] = listeners
+}
+
+// DispatchEvent dispatches a synthetic event with n as the target. It calls
+// the capturing listeners from the outermost ancestor down to n, then the
+// bubbling listeners from n up to the outermost ancestor, stopping early if
+// the event's propagation is stopped.
+func (n *memNode) DispatchEvent(event dom.Event) bool {
+	ev := event.(*memEvent)
+	ev.target = n
+	path := []*memNode{}
+	for node := n; node != nil; node = node.parent {
+		path = append([]*memNode{node}, path...)
+	}
+	for _, node := range path {
+		node.callListeners(ev, true)
+	}
+	for i := len(path) - 1; i >= 0; i-- {
+		if !ev.bubbles && i != len(path)-1 {
+			break
+		}
+		path[i].callListeners(ev, false)
+	}
+	return !ev.defaultPrevented
+}
+
+func (n *memNode) callListeners(ev *memEvent, useCapture bool) {
+	if ev.stopped {
+		return
+	}
+	for _, l := range n.events[ev.typ] {
+		if l.useCapture == useCapture {
+			l.listener(ev)
+		}
+	}
+}
+
+// memEvent is a synthetic event which can be dispatched with
+// memNode.DispatchEvent.
+type memEvent struct {
+	dom.Event
+	typ              string
+	bubbles          bool
+	target           *memNode
+	stopped          bool
+	defaultPrevented bool
+}
+
+func newMemEvent(typ string) *memEvent {
+	return &memEvent{typ: typ, bubbles: !nonBubblingEvents[typ]}
+}
+
+func (ev *memEvent) Type() string {
+	return ev.typ
+}
+
+func (ev *memEvent) Target() dom.Element {
+	return ev.target
+}
+
+func (ev *memEvent) StopPropagation() {
+	ev.stopped = true
+}
+
+func (ev *memEvent) PreventDefault() {
+	ev.defaultPrevented = true
+}
+
+func (ev *memEvent) DefaultPrevented() bool {
+	return ev.defaultPrevented
+}
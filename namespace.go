@@ -0,0 +1,101 @@
+package vdom
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// The namespaces used for elements and attributes which are not html. An
+// Element with an empty Namespace is an html element.
+const (
+	SVGNamespace    = "http://www.w3.org/2000/svg"
+	MathMLNamespace = "http://www.w3.org/1998/Math/MathML"
+	XLinkNamespace  = "http://www.w3.org/1999/xlink"
+	XMLNamespace    = "http://www.w3.org/XML/1998/namespace"
+	XMLNSNamespace  = "http://www.w3.org/2000/xmlns/"
+)
+
+// attrPrefixes maps the namespaces which can be used for attributes to the
+// prefix that is written in html, e.g. xlink:href.
+var attrPrefixes = map[string]string{
+	XLinkNamespace: "xlink",
+	XMLNamespace:   "xml",
+	XMLNSNamespace: "xmlns",
+}
+
+// parseName converts an xml.Name to a single string name, which is the name
+// as it was written in the html. If the html declares a namespace with an
+// xmlns attribute, the xml decoder replaces any prefix with the namespace
+// itself, so we need to convert it back. Elements don't need a prefix since
+// their namespace is determined by their ancestors (see elementNamespace).
+func parseName(name xml.Name) string {
+	switch {
+	case name.Space == "":
+		return name.Local
+	case name.Space == SVGNamespace || name.Space == MathMLNamespace:
+		return name.Local
+	case attrPrefixes[name.Space] != "":
+		return attrPrefixes[name.Space] + ":" + name.Local
+	}
+	return fmt.Sprintf("%s:%s", name.Space, name.Local)
+}
+
+// elementNamespace returns the namespace for an element with the given name
+// and parent, following the same rules as the browser. An <svg> or <math>
+// element starts a new namespace, which is used by all of its descendants
+// except for the contents of a <foreignObject>, which are html again.
+func elementNamespace(name string, parent *Element) string {
+	switch strings.ToLower(name) {
+	case "svg":
+		return SVGNamespace
+	case "math":
+		return MathMLNamespace
+	}
+	return childNamespace(parent)
+}
+
+// childNamespace returns the namespace for the children of parent. parent
+// may be an element that was not parsed and has no Namespace (e.g.
+// &Element{Name: "svg"}), so the namespace is worked out from its name and
+// ancestors when needed.
+func childNamespace(parent *Element) string {
+	if parent == nil {
+		return ""
+	}
+	switch strings.ToLower(parent.Name) {
+	case "svg":
+		return SVGNamespace
+	case "math":
+		return MathMLNamespace
+	case "foreignobject":
+		return ""
+	}
+	if parent.Namespace != "" {
+		return parent.Namespace
+	}
+	return childNamespace(parent.parent)
+}
+
+// attrNamespace returns the namespace for the attribute with the given name
+// on an element in the given namespace. Only svg and mathml elements have
+// attributes with a namespace, e.g. xlink:href.
+func attrNamespace(elNamespace, name string) string {
+	if elNamespace == "" {
+		return ""
+	}
+	if name == "xmlns" {
+		return XMLNSNamespace
+	}
+	i := strings.Index(name, ":")
+	if i == -1 {
+		return ""
+	}
+	prefix := name[:i]
+	for namespace, p := range attrPrefixes {
+		if p == prefix {
+			return namespace
+		}
+	}
+	return ""
+}
@@ -0,0 +1,215 @@
+package vdom
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseNamespaces(t *testing.T) {
+	src := `<div><svg viewBox="0 0 10 10"><g><circle r="1"></circle></g><foreignObject><p>hi</p></foreignObject></svg><math><mi>x</mi></math></div>`
+	tree, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatalf("Unexpected error in Parse: %s", err.Error())
+	}
+	div := tree.Children[0].(*Element)
+	svg := div.Children()[0].(*Element)
+	math := div.Children()[1].(*Element)
+	testCases := []struct {
+		el       Node
+		expected string
+	}{
+		{div, ""},
+		{svg, SVGNamespace},
+		{svg.Children()[0], SVGNamespace},
+		{svg.Children()[0].Children()[0], SVGNamespace},
+		{svg.Children()[1], SVGNamespace},
+		{svg.Children()[1].Children()[0], ""},
+		{math, MathMLNamespace},
+		{math.Children()[0], MathMLNamespace},
+	}
+	for _, tc := range testCases {
+		el := tc.el.(*Element)
+		if el.Namespace != tc.expected {
+			t.Errorf("Expected namespace of <%s> to be %q but got %q", el.Name, tc.expected, el.Namespace)
+		}
+	}
+}
+
+func TestParseNamespaceDeclarations(t *testing.T) {
+	// If the html declares the namespaces, the names should still be written
+	// the same way as in the source.
+	src := `<div><svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink"><use xlink:href="#a"></use></svg></div>`
+	tree, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatalf("Unexpected error in Parse: %s", err.Error())
+	}
+	svg := tree.Children[0].Children()[0].(*Element)
+	if svg.Name != "svg" {
+		t.Errorf("Expected name to be svg but got %s", svg.Name)
+	}
+	expectedAttrs := []Attr{
+		{Name: "xmlns", Value: SVGNamespace},
+		{Name: "xmlns:xlink", Value: XLinkNamespace},
+	}
+	if match, msg := svg.Compare(&Element{Name: "svg", Namespace: SVGNamespace, Attrs: expectedAttrs}, true); !match {
+		t.Error(msg)
+	}
+	use := svg.Children()[0].(*Element)
+	if use.Name != "use" {
+		t.Errorf("Expected name to be use but got %s", use.Name)
+	}
+	if value := use.AttrMap()["xlink:href"]; value != "#a" {
+		t.Errorf("Expected xlink:href to be #a but got %q", value)
+	}
+	if got := string(tree.HTML()); got != src {
+		t.Errorf("HTML was not correct.\nExpected: %s\nGot:      %s", src, got)
+	}
+}
+
+func TestParseFragmentNamespaces(t *testing.T) {
+	tree, err := ParseFragment([]byte(`<circle r="1"></circle><foreignObject><p>hi</p></foreignObject>`), &Element{Name: "svg"})
+	if err != nil {
+		t.Fatalf("Unexpected error in ParseFragment: %s", err.Error())
+	}
+	circle := tree.Children[0].(*Element)
+	if circle.Namespace != SVGNamespace {
+		t.Errorf("Expected namespace of circle to be %q but got %q", SVGNamespace, circle.Namespace)
+	}
+	p := tree.Children[1].Children()[0].(*Element)
+	if p.Namespace != "" {
+		t.Errorf("Expected namespace of p to be empty but got %q", p.Namespace)
+	}
+}
+
+func TestParseFragmentAttrCase(t *testing.T) {
+	// The names of attributes are only case insensitive on html elements, so
+	// the attributes of svg content in an svg context keep their case.
+	tree, err := ParseFragment([]byte(`<svg viewBox="0 0 1 1"></svg><g preserveAspectRatio="none" CLASS="a"><foreignObject><p CLASS="b"></p></foreignObject></g>`), &Element{Name: "svg"})
+	if err != nil {
+		t.Fatalf("Unexpected error in ParseFragment: %s", err.Error())
+	}
+	expected := []Attr{{Name: "viewBox", Value: "0 0 1 1"}}
+	if got := tree.Children[0].(*Element).Attrs; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Attrs of svg were not correct.\nExpected: %v\nGot:      %v", expected, got)
+	}
+	g := tree.Children[1].(*Element)
+	expected = []Attr{{Name: "preserveAspectRatio", Value: "none"}, {Name: "CLASS", Value: "a"}}
+	if !reflect.DeepEqual(g.Attrs, expected) {
+		t.Errorf("Attrs of g were not correct.\nExpected: %v\nGot:      %v", expected, g.Attrs)
+	}
+	p := g.Children()[0].Children()[0].(*Element)
+	expected = []Attr{{Name: "class", Value: "b"}}
+	if !reflect.DeepEqual(p.Attrs, expected) {
+		t.Errorf("Attrs of p were not correct.\nExpected: %v\nGot:      %v", expected, p.Attrs)
+	}
+}
+
+func TestPatchNamespaces(t *testing.T) {
+	tree, err := Parse([]byte("<div></div>"))
+	if err != nil {
+		t.Fatalf("Unexpected error in Parse: %s", err.Error())
+	}
+	root := newMemRoot("<div></div>")
+	newTree, err := Parse([]byte(`<div><svg><use xlink:href="#a" class="icon"></use></svg></div>`))
+	if err != nil {
+		t.Fatalf("Unexpected error in Parse: %s", err.Error())
+	}
+	patches, err := Diff(tree, newTree)
+	if err != nil {
+		t.Fatalf("Unexpected error in Diff: %s", err.Error())
+	}
+	if err := patches.Patch(root); err != nil {
+		t.Fatalf("Unexpected error in Patch: %s", err.Error())
+	}
+	svg := memNodeAt(root, 0, 0)
+	if svg.namespace != SVGNamespace {
+		t.Errorf("Expected svg to be created with namespace %q but got %q", SVGNamespace, svg.namespace)
+	}
+	use := memNodeAt(root, 0, 0, 0)
+	if use.namespace != SVGNamespace {
+		t.Errorf("Expected use to be created with namespace %q but got %q", SVGNamespace, use.namespace)
+	}
+	if got := use.attrNamespaces["xlink:href"]; got != XLinkNamespace {
+		t.Errorf("Expected xlink:href to be set with namespace %q but got %q", XLinkNamespace, got)
+	}
+	if _, found := use.attrNamespaces["class"]; found {
+		t.Error("Expected class to be set without a namespace")
+	}
+
+	// Change and then remove the xlink:href attribute.
+	for _, src := range []string{
+		`<div><svg><use xlink:href="#b" class="icon"></use></svg></div>`,
+		`<div><svg><use class="icon"></use></svg></div>`,
+	} {
+		latestTree, err := Parse([]byte(src))
+		if err != nil {
+			t.Fatalf("Unexpected error in Parse: %s", err.Error())
+		}
+		patches, err := Diff(newTree, latestTree)
+		if err != nil {
+			t.Fatalf("Unexpected error in Diff: %s", err.Error())
+		}
+		if err := patches.Patch(root); err != nil {
+			t.Fatalf("Unexpected error in Patch: %s", err.Error())
+		}
+		if got := root.InnerHTML(); got != src {
+			t.Errorf("Actual DOM was not correct.\nExpected: %s\nGot:      %s", src, got)
+		}
+		newTree = latestTree
+	}
+	if _, found := use.attrNamespaces["xlink:href"]; found {
+		t.Error("Expected xlink:href to be removed")
+	}
+}
+
+func TestDiffNamespaces(t *testing.T) {
+	// An <a> inside of an svg is a different element than an html <a>, so it
+	// needs to be replaced.
+	tree, err := Parse([]byte("<div><svg><a></a></svg></div>"))
+	if err != nil {
+		t.Fatalf("Unexpected error in Parse: %s", err.Error())
+	}
+	other, err := ParseFragment([]byte("<a></a>"), &Element{Name: "div"})
+	if err != nil {
+		t.Fatalf("Unexpected error in ParseFragment: %s", err.Error())
+	}
+	svgA := tree.Children[0].Children()[0].Children()[0].(*Element)
+	htmlA := other.Children[0].(*Element)
+	if svgA.Hash() == htmlA.Hash() {
+		t.Error("Expected elements with different namespaces to have different hashes")
+	}
+	if match, _ := svgA.Compare(htmlA, true); match {
+		t.Error("Expected elements with different namespaces not to match")
+	}
+}
+
+func TestAppendSelfClosedNamespaces(t *testing.T) {
+	tree, err := Parse([]byte("<div></div>"))
+	if err != nil {
+		t.Fatalf("Unexpected error in Parse: %s", err.Error())
+	}
+	root := newMemRoot("<div></div>")
+	newTree, err := Parse([]byte(`<div><svg><path d="M0 0"/><circle r="1"/></svg></div>`))
+	if err != nil {
+		t.Fatalf("Unexpected error in Parse: %s", err.Error())
+	}
+	patches, err := Diff(tree, newTree)
+	if err != nil {
+		t.Fatalf("Unexpected error in Diff: %s", err.Error())
+	}
+	if err := patches.Patch(root); err != nil {
+		t.Fatalf("Unexpected error in Patch: %s", err.Error())
+	}
+	// The circle should be a sibling of the path, not its child.
+	svg := memNodeAt(root, 0, 0)
+	if len(svg.children) != 2 {
+		t.Fatalf("Expected svg to have 2 children but got %d: %s", len(svg.children), root.InnerHTML())
+	}
+	if got := memNodeAt(root, 0, 0, 1).name; got != "circle" {
+		t.Errorf("Expected the second child of svg to be circle but got %s", got)
+	}
+	expected := `<path d="M0 0"/>`
+	if got := string(newTree.Children[0].Children()[0].Children()[0].HTML()); got != expected {
+		t.Errorf("HTML was not correct.\nExpected: %s\nGot:      %s", expected, got)
+	}
+}
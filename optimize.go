@@ -0,0 +1,581 @@
+package vdom
+
+// Optimize returns a PatchSet which has the same effect on the actual DOM
+// as ps, but which is typically shorter. It merges, reorders and drops
+// patches according to the following rules:
+//
+//   - Patches which only affect a node that is later replaced or removed
+//     (or which is inside a node that is later replaced or removed) are
+//     dropped.
+//   - When there are several patches which change the same attribute,
+//     property or type of listener of the same node (or the value of the
+//     same text or comment node), only the last one is kept.
+//   - SetAttr, RemoveAttr, SetText and SetComment patches which follow a
+//     Replace of the same node are merged into the Replace.
+//   - Remove patches for a run of consecutive siblings are merged into
+//     a single RemoveRange, whether they remove the siblings from first to
+//     last or (like Diff) from last to first.
+//   - When there are several SetTitle patches, only the last one is kept,
+//     unless there is a HeadPatch in between.
+//   - HeadPatch patches which are next to each other are merged into one,
+//     and so are BodyPatch patches. The patches inside of them are
+//     optimized too.
+//
+// Insert does not update the indexes of the siblings after the new node,
+// and neither do Remove and RemoveRange for first-level nodes, so patches
+// are never merged, moved or dropped across one of them which moves their
+// node. Since the root might be inside of document.head or document.body,
+// the same goes for HeadPatch and BodyPatch.
+//
+// Optimize does not modify ps or any of the nodes it refers to. Optimize
+// only knows about the Patchers defined in this package. If ps contains
+// any other kind of Patcher, it is returned unchanged.
+func (ps PatchSet) Optimize() PatchSet {
+	for _, patch := range ps {
+		if !isKnownPatch(patch) {
+			return ps
+		}
+	}
+	patches := mergeDocumentPatches(ps)
+	patches = dropOverwritten(patches)
+	patches = dropSuperseded(patches)
+	patches = mergeIntoReplace(patches)
+	patches = mergeRemoves(patches)
+	return patches
+}
+
+// isKnownPatch returns true iff patch is one of the Patchers that Optimize
+// knows how to reason about.
+func isKnownPatch(patch Patcher) bool {
+	switch patch.(type) {
+	case *Append, *Insert, *Replace, *Remove, *RemoveRange, *ReplaceChildren, *SetAttr, *RemoveAttr, *SetText, *SetComment, *SetProperty, *SetListener, *RemoveListener, *AddClass, *RemoveClass, *SetStyle, *RemoveStyle, *HeadPatch, *BodyPatch, *SetTitle:
+		return true
+	}
+	return false
+}
+
+// patchTarget returns the node that patch needs to find in the actual DOM
+// in order to apply itself. It returns nil if the patch targets the root, or
+// if it does not use the root at all (e.g. a HeadPatch).
+func patchTarget(patch Patcher) Node {
+	switch p := patch.(type) {
+	case *Append:
+		if p.Parent == nil {
+			return nil
+		}
+		return p.Parent
+	case *Insert:
+		if p.Parent == nil {
+			return nil
+		}
+		return p.Parent
+	case *Replace:
+		return p.Old
+	case *Remove:
+		return p.Node
+	case *ReplaceChildren:
+		if p.Parent == nil {
+			return nil
+		}
+		return p.Parent
+	case *SetAttr:
+		return p.Node
+	case *RemoveAttr:
+		return p.Node
+	case *SetText:
+		return p.Node
+	case *SetComment:
+		return p.Node
+	case *SetProperty:
+		return p.Node
+	case *SetListener:
+		return p.Node
+	case *RemoveListener:
+		return p.Node
+	case *AddClass:
+		return p.Node
+	case *RemoveClass:
+		return p.Node
+	case *SetStyle:
+		return p.Node
+	case *RemoveStyle:
+		return p.Node
+	}
+	return nil
+}
+
+// discardedNodes returns the nodes which patch removes from the actual DOM
+// (along with all of their descendants). It returns nil for a
+// ReplaceChildren for the root, since the patch does not know which nodes
+// are in the root. See discardsInside.
+func discardedNodes(patch Patcher) []Node {
+	switch p := patch.(type) {
+	case *Replace:
+		return []Node{p.Old}
+	case *Remove:
+		return []Node{p.Node}
+	case *RemoveRange:
+		return p.Nodes
+	case *ReplaceChildren:
+		if p.Parent == nil {
+			return nil
+		}
+		return p.Parent.Children()
+	}
+	return nil
+}
+
+// isInPlacePatch returns true iff patch changes a single node in place,
+// without changing the structure of the actual DOM.
+func isInPlacePatch(patch Patcher) bool {
+	switch patch.(type) {
+	case *SetAttr, *RemoveAttr, *SetText, *SetComment, *SetProperty, *SetListener, *RemoveListener, *AddClass, *RemoveClass, *SetStyle, *RemoveStyle:
+		return true
+	}
+	return false
+}
+
+// inPlaceKey returns a key for the part of the node which is changed by an
+// in-place patch. Two in-place patches for the same node and with the same
+// key overwrite each other.
+func inPlaceKey(patch Patcher) string {
+	switch p := patch.(type) {
+	case *SetAttr:
+		return "attr:" + p.Attr.Name
+	case *RemoveAttr:
+		return "attr:" + p.AttrName
+	case *SetText, *SetComment:
+		return "value"
+	case *SetProperty:
+		return "prop:" + p.Name
+	case *SetListener:
+		return "listener:" + p.Listener.Type
+	case *RemoveListener:
+		return "listener:" + p.Type
+	case *AddClass:
+		return "class:" + p.Class
+	case *RemoveClass:
+		return "class:" + p.Class
+	case *SetStyle:
+		return "style:" + p.Style.Property
+	case *RemoveStyle:
+		return "style:" + p.Property
+	}
+	return ""
+}
+
+// isInside returns true iff n is a descendant of ancestor. If orSelf is true,
+// it also returns true if n is ancestor.
+func isInside(n Node, ancestor Node, orSelf bool) bool {
+	if n == nil || ancestor == nil {
+		return false
+	}
+	if orSelf && n == ancestor {
+		return true
+	}
+	for parent := n.Parent(); parent != nil; parent = parent.Parent() {
+		if Node(parent) == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+// remapsNode returns true iff, after patch, n might refer to a different
+// node in the actual DOM even though it was not discarded.
+func remapsNode(patch Patcher, n Node) bool {
+	switch p := patch.(type) {
+	case *Insert:
+		// The siblings at and after the new node, and everything inside of
+		// them, are moved along by one.
+		parentIndex := []int{}
+		if p.Parent != nil {
+			parentIndex = p.Parent.Index()
+		}
+		childIndex := p.Child.Index()
+		return isAtOrAfter(n, parentIndex, childIndex[len(childIndex)-1])
+	case *Remove:
+		// Remove only updates the indexes of the siblings if they have a
+		// parent.
+		return p.Node.Parent() == nil && isAtOrAfter(n, nil, p.Node.Index()[0]+1)
+	case *RemoveRange:
+		if len(p.Nodes) == 0 || p.Nodes[0].Parent() != nil {
+			return false
+		}
+		last := p.Nodes[len(p.Nodes)-1]
+		return isAtOrAfter(n, nil, last.Index()[0]+1)
+	case *HeadPatch, *BodyPatch:
+		// The root might be inside of the head or body.
+		return true
+	}
+	return false
+}
+
+// isAtOrAfter returns true iff n is inside of (or is) a child of the node
+// at parentIndex whose index is at least position.
+func isAtOrAfter(n Node, parentIndex []int, position int) bool {
+	if n == nil {
+		return false
+	}
+	index := n.Index()
+	if len(index) <= len(parentIndex) {
+		return false
+	}
+	for i := range parentIndex {
+		if index[i] != parentIndex[i] {
+			return false
+		}
+	}
+	return index[len(parentIndex)] >= position
+}
+
+// remapsBetween returns true iff any of the patches remaps n.
+func remapsBetween(patches []Patcher, n Node) bool {
+	for _, patch := range patches {
+		if remapsNode(patch, n) {
+			return true
+		}
+	}
+	return false
+}
+
+// discardsInside returns true iff patch discards n or one of n's ancestors.
+// A ReplaceChildren for the root discards every node, even though
+// discardedNodes can't list them.
+func discardsInside(patch Patcher, n Node) bool {
+	if replaceChildren, ok := patch.(*ReplaceChildren); ok && replaceChildren.Parent == nil {
+		return n != nil
+	}
+	for _, discarded := range discardedNodes(patch) {
+		if isInside(n, discarded, true) {
+			return true
+		}
+	}
+	return false
+}
+
+// isOverwrittenBy returns true iff the effect of patch is entirely undone
+// when discarded is removed from the actual DOM.
+func isOverwrittenBy(patch Patcher, discarded Node) bool {
+	switch patch.(type) {
+	case *Remove, *RemoveRange:
+		// Removing a node changes the indexes of its siblings, so it is only
+		// safe to drop if the node is strictly inside of discarded.
+		for _, node := range discardedNodes(patch) {
+			if !isInside(node, discarded, false) {
+				return false
+			}
+		}
+		return true
+	}
+	return isInside(patchTarget(patch), discarded, true)
+}
+
+// dropOverwritten returns the patches which are not overwritten by some later
+// Replace, Remove or RemoveRange.
+func dropOverwritten(patches []Patcher) []Patcher {
+	dropped := make([]bool, len(patches))
+	for j, later := range patches {
+		for _, discarded := range discardedNodes(later) {
+			// Dropping patches inside of discarded might change the indexes of
+			// other nodes inside of discarded. That only matters if some patch
+			// after this one still refers to them.
+			stillReferenced := false
+			for _, after := range patches[j+1:] {
+				if isInside(patchTarget(after), discarded, false) {
+					stillReferenced = true
+					break
+				}
+			}
+			if stillReferenced {
+				continue
+			}
+			for i, earlier := range patches[:j] {
+				// If discarded was remapped in between, the later patch
+				// discards a different node than the one earlier changed.
+				if !dropped[i] && isOverwrittenBy(earlier, discarded) && !remapsBetween(patches[i+1:j], discarded) {
+					dropped[i] = true
+				}
+			}
+		}
+	}
+	result := []Patcher{}
+	for i, patch := range patches {
+		if !dropped[i] {
+			result = append(result, patch)
+		}
+	}
+	return result
+}
+
+// dropSuperseded returns the patches without any in-place patch or SetTitle
+// that is followed by another patch which overwrites it.
+func dropSuperseded(patches []Patcher) []Patcher {
+	result := []Patcher{}
+	for i, patch := range patches {
+		if isInPlacePatch(patch) && isSuperseded(patches, i) {
+			continue
+		}
+		if _, ok := patch.(*SetTitle); ok && isTitleSuperseded(patches, i) {
+			continue
+		}
+		result = append(result, patch)
+	}
+	return result
+}
+
+// isTitleSuperseded returns true iff the SetTitle at patches[i] is followed
+// by another SetTitle, without a HeadPatch in between which might depend on
+// the title.
+func isTitleSuperseded(patches []Patcher, i int) bool {
+	for _, later := range patches[i+1:] {
+		switch later.(type) {
+		case *SetTitle:
+			return true
+		case *HeadPatch:
+			return false
+		}
+	}
+	return false
+}
+
+// isSuperseded returns true iff the in-place patch at patches[i] is followed
+// by another in-place patch for the same part of the same node.
+func isSuperseded(patches []Patcher, i int) bool {
+	node := patchTarget(patches[i])
+	key := inPlaceKey(patches[i])
+	for _, later := range patches[i+1:] {
+		if discardsInside(later, node) || remapsNode(later, node) {
+			// From here on, the node refers to a different node in the
+			// actual DOM.
+			return false
+		}
+		if isInPlacePatch(later) && patchTarget(later) == node && inPlaceKey(later) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeDocumentPatches returns the patches with each run of adjacent
+// HeadPatch or BodyPatch patches merged into one, with its patches
+// optimized.
+func mergeDocumentPatches(patches []Patcher) []Patcher {
+	result := []Patcher{}
+	for _, patch := range patches {
+		if len(result) > 0 {
+			switch p := patch.(type) {
+			case *HeadPatch:
+				if last, ok := result[len(result)-1].(*HeadPatch); ok {
+					merged := append(append(PatchSet{}, last.Patches...), p.Patches...)
+					result[len(result)-1] = &HeadPatch{Patches: merged}
+					continue
+				}
+			case *BodyPatch:
+				if last, ok := result[len(result)-1].(*BodyPatch); ok {
+					merged := append(append(PatchSet{}, last.Patches...), p.Patches...)
+					result[len(result)-1] = &BodyPatch{Patches: merged}
+					continue
+				}
+			}
+		}
+		result = append(result, patch)
+	}
+	for i, patch := range result {
+		switch p := patch.(type) {
+		case *HeadPatch:
+			result[i] = &HeadPatch{Patches: p.Patches.Optimize()}
+		case *BodyPatch:
+			result[i] = &BodyPatch{Patches: p.Patches.Optimize()}
+		}
+	}
+	return result
+}
+
+// mergeIntoReplace returns the patches with any in-place patch for a node
+// which was just replaced merged into the corresponding Replace.
+func mergeIntoReplace(patches []Patcher) []Patcher {
+	result := []Patcher{}
+	for _, patch := range patches {
+		if isInPlacePatch(patch) {
+			if i := findReplaceOf(result, patch); i != -1 {
+				result[i] = mergePatchIntoReplace(result[i].(*Replace), patch)
+				continue
+			}
+		}
+		result = append(result, patch)
+	}
+	return result
+}
+
+// findReplaceOf returns the index of the Replace in patches which put the
+// node targeted by patch in the actual DOM. The new node must be of the
+// right type for patch to be merged into the Replace. It returns -1 if there
+// is no such Replace.
+func findReplaceOf(patches []Patcher, patch Patcher) int {
+	node := patchTarget(patch)
+	for i := len(patches) - 1; i >= 0; i-- {
+		if replace, ok := patches[i].(*Replace); ok && (replace.Old == node || replace.New == node) {
+			if canMergeIntoReplace(replace, patch) {
+				return i
+			}
+			return -1
+		}
+		if discardsInside(patches[i], node) || remapsNode(patches[i], node) {
+			return -1
+		}
+	}
+	return -1
+}
+
+// canMergeIntoReplace returns true iff the new node for replace is of the
+// right type to be changed by patch.
+func canMergeIntoReplace(replace *Replace, patch Patcher) bool {
+	switch patch.(type) {
+	case *SetAttr, *RemoveAttr:
+		_, ok := replace.New.(*Element)
+		return ok
+	case *SetText:
+		_, ok := replace.New.(*Text)
+		return ok
+	case *SetComment:
+		_, ok := replace.New.(*Comment)
+		return ok
+	}
+	return false
+}
+
+// mergePatchIntoReplace returns a new Replace which has the same effect as
+// applying replace followed by patch. It does not modify replace.
+func mergePatchIntoReplace(replace *Replace, patch Patcher) *Replace {
+	merged := &Replace{Old: replace.Old}
+	switch p := patch.(type) {
+	case *SetAttr, *RemoveAttr:
+		merged.New = mergeAttrIntoElement(replace.New.(*Element), patch)
+	case *SetText:
+		newText := *replace.New.(*Text)
+		newText.Value = p.Value
+		merged.New = &newText
+	case *SetComment:
+		newComment := *replace.New.(*Comment)
+		newComment.Value = p.Value
+		merged.New = &newComment
+	}
+	return merged
+}
+
+// mergeAttrIntoElement returns a copy of el with the change from attrPatch
+// applied to its attributes. It does not modify el.
+func mergeAttrIntoElement(el *Element, attrPatch Patcher) *Element {
+	newEl := *el
+	newEl.Attrs = nil
+	newEl.hashed = false
+	// The source of el no longer matches the attributes, so the html needs
+	// to be built from the attributes and children.
+	newEl.modified = true
+	var name string
+	set, isSet := attrPatch.(*SetAttr)
+	if isSet {
+		name = set.Attr.Name
+	} else {
+		name = attrPatch.(*RemoveAttr).AttrName
+	}
+	found := false
+	for _, attr := range el.Attrs {
+		if attr.Name == name {
+			found = true
+			if !isSet {
+				continue
+			}
+			attr.Value = set.Attr.Value
+		}
+		newEl.Attrs = append(newEl.Attrs, attr)
+	}
+	if isSet && !found {
+		newEl.Attrs = append(newEl.Attrs, *set.Attr)
+	}
+	return &newEl
+}
+
+// mergeRemoves returns the patches with Remove patches for consecutive
+// siblings merged into a single RemoveRange. The siblings may be removed in
+// either order, but the nodes in the RemoveRange are always in order. In-place
+// patches in between the Remove patches are moved after the RemoveRange.
+func mergeRemoves(patches []Patcher) []Patcher {
+	result := []Patcher{}
+	for i := 0; i < len(patches); i++ {
+		remove, ok := patches[i].(*Remove)
+		if !ok {
+			result = append(result, patches[i])
+			continue
+		}
+		nodes := []Node{remove.Node}
+		moved := []Patcher{}
+		pending := []Patcher{}
+		for j := i + 1; j < len(patches); j++ {
+			next, ok := patches[j].(*Remove)
+			// The patches which are moved after the RemoveRange must still
+			// find the same nodes, and so must next.
+			if ok && !targetsInside(pending, next.Node) && !remapsAny(next, pending) && !remapsBetween(patches[i:j], next.Node) {
+				merged := false
+				if isNextSibling(nodes[len(nodes)-1], next.Node) {
+					nodes = append(nodes, next.Node)
+					merged = true
+				} else if isNextSibling(next.Node, nodes[0]) {
+					nodes = append([]Node{next.Node}, nodes...)
+					merged = true
+				}
+				if merged {
+					moved = append(moved, pending...)
+					pending = nil
+					i = j
+					continue
+				}
+			}
+			if !isInPlacePatch(patches[j]) {
+				break
+			}
+			pending = append(pending, patches[j])
+		}
+		if len(nodes) == 1 {
+			result = append(result, remove)
+		} else {
+			result = append(result, &RemoveRange{Nodes: nodes})
+		}
+		result = append(result, moved...)
+	}
+	return result
+}
+
+// remapsAny returns true iff patch remaps the target of any of the patches.
+func remapsAny(patch Patcher, patches []Patcher) bool {
+	for _, other := range patches {
+		if remapsNode(patch, patchTarget(other)) {
+			return true
+		}
+	}
+	return false
+}
+
+// targetsInside returns true iff any of the patches targets n or one of its
+// descendants.
+func targetsInside(patches []Patcher, n Node) bool {
+	for _, patch := range patches {
+		if isInside(patchTarget(patch), n, true) {
+			return true
+		}
+	}
+	return false
+}
+
+// isNextSibling returns true iff next is the sibling directly after node.
+func isNextSibling(node, next Node) bool {
+	if node.Parent() != next.Parent() {
+		return false
+	}
+	index, nextIndex := node.Index(), next.Index()
+	if len(index) != len(nextIndex) {
+		return false
+	}
+	return index[len(index)-1]+1 == nextIndex[len(nextIndex)-1]
+}
@@ -0,0 +1,673 @@
+package vdom
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+)
+
+// TestOptimizeProperties checks that applying an optimized PatchSet to an
+// in-memory DOM has the same result as applying the original PatchSet for
+// randomly generated pairs of trees.
+func TestOptimizeProperties(t *testing.T) {
+	property := func(c optimizeCase) bool {
+		// Each PatchSet changes the indexes of the tree it was created from
+		// when it is applied, so we need to create it twice from scratch.
+		patches := c.patches()
+		optimized := c.patches().Optimize()
+		if len(optimized) > len(patches) {
+			t.Logf("Optimized PatchSet has %d patches but original had %d", len(optimized), len(patches))
+			return false
+		}
+		expectedRoot := newMemRoot(c.oldHTML)
+		if err := patches.Patch(expectedRoot); err != nil {
+			t.Log(err)
+			return false
+		}
+		gotRoot := newMemRoot(c.oldHTML)
+		if err := optimized.Patch(gotRoot); err != nil {
+			t.Log(err)
+			return false
+		}
+		// Optimize might change the order in which attributes are added, so we
+		// need to compare the canonical html.
+		if expectedRoot.CanonicalHTML() != gotRoot.CanonicalHTML() {
+			t.Logf("Optimized patches resulted in\n%s\nbut expected\n%s\nfor %s", gotRoot.CanonicalHTML(), expectedRoot.CanonicalHTML(), c)
+			return false
+		}
+		return true
+	}
+	if err := quick.Check(property, &quick.Config{MaxCount: 500}); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestOptimize tests the Optimize method for some PatchSets where we know
+// exactly which patches should be merged or dropped.
+func TestOptimize(t *testing.T) {
+	tree, err := Parse([]byte(`<ul><li class="one">one</li><li>two</li><li>three</li><li>four</li></ul>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ul := tree.Children[0].(*Element)
+	lis := ul.Children()
+	newTree, err := Parse([]byte(`<li id="uno">uno</li>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newLi := newTree.Children[0].(*Element)
+
+	testCases := []struct {
+		name     string
+		patches  PatchSet
+		expected PatchSet
+	}{
+		{
+			name: "SetAttr followed by RemoveAttr",
+			patches: PatchSet{
+				&SetAttr{Node: lis[0], Attr: &Attr{Name: "class", Value: "foo"}},
+				&SetAttr{Node: lis[1], Attr: &Attr{Name: "class", Value: "bar"}},
+				&RemoveAttr{Node: lis[0], AttrName: "class"},
+			},
+			expected: PatchSet{
+				&SetAttr{Node: lis[1], Attr: &Attr{Name: "class", Value: "bar"}},
+				&RemoveAttr{Node: lis[0], AttrName: "class"},
+			},
+		},
+		{
+			name: "SetAttr before Replace",
+			patches: PatchSet{
+				&SetAttr{Node: lis[0], Attr: &Attr{Name: "class", Value: "foo"}},
+				&Replace{Old: lis[0], New: newLi},
+			},
+			expected: PatchSet{
+				&Replace{Old: lis[0], New: newLi},
+			},
+		},
+		{
+			name: "SetAttr after Replace",
+			patches: PatchSet{
+				&Replace{Old: lis[0], New: newLi},
+				&SetAttr{Node: lis[0], Attr: &Attr{Name: "class", Value: "foo"}},
+				&RemoveAttr{Node: lis[0], AttrName: "id"},
+			},
+			expected: PatchSet{
+				&Replace{Old: lis[0], New: &Element{Name: "li", Attrs: []Attr{{Name: "class", Value: "foo"}}}},
+			},
+		},
+		{
+			name: "SetAttr after Replace and ReplaceChildren for the root",
+			patches: PatchSet{
+				&Replace{Old: lis[0], New: newLi},
+				&ReplaceChildren{Children: tree.Children},
+				&SetAttr{Node: lis[0], Attr: &Attr{Name: "class", Value: "foo"}},
+			},
+			expected: PatchSet{
+				&Replace{Old: lis[0], New: newLi},
+				&ReplaceChildren{Children: tree.Children},
+				&SetAttr{Node: lis[0], Attr: &Attr{Name: "class", Value: "foo"}},
+			},
+		},
+		{
+			name: "SetText after SetText",
+			patches: PatchSet{
+				&SetText{Node: lis[1].Children()[0].(*Text), Value: []byte("dos")},
+				&SetText{Node: lis[1].Children()[0].(*Text), Value: []byte("deux")},
+			},
+			expected: PatchSet{
+				&SetText{Node: lis[1].Children()[0].(*Text), Value: []byte("deux")},
+			},
+		},
+		{
+			name: "SetText after Replace",
+			patches: PatchSet{
+				&Replace{Old: lis[0].Children()[0], New: newLi.Children()[0]},
+				&SetText{Node: newLi.Children()[0].(*Text), Value: []byte("un")},
+			},
+			expected: PatchSet{
+				&Replace{Old: lis[0].Children()[0], New: &Text{Value: []byte("un")}},
+			},
+		},
+		{
+			name: "Removes of trailing siblings",
+			patches: PatchSet{
+				&Remove{Node: lis[1]},
+				&SetAttr{Node: lis[0], Attr: &Attr{Name: "class", Value: "foo"}},
+				&Remove{Node: lis[2]},
+				&Remove{Node: lis[3]},
+			},
+			expected: PatchSet{
+				&RemoveRange{Nodes: []Node{lis[1], lis[2], lis[3]}},
+				&SetAttr{Node: lis[0], Attr: &Attr{Name: "class", Value: "foo"}},
+			},
+		},
+		{
+			name: "Removes of trailing siblings from last to first",
+			patches: PatchSet{
+				&Remove{Node: lis[3]},
+				&Remove{Node: lis[2]},
+				&SetAttr{Node: lis[0], Attr: &Attr{Name: "class", Value: "foo"}},
+				&Remove{Node: lis[1]},
+			},
+			expected: PatchSet{
+				&RemoveRange{Nodes: []Node{lis[1], lis[2], lis[3]}},
+				&SetAttr{Node: lis[0], Attr: &Attr{Name: "class", Value: "foo"}},
+			},
+		},
+		{
+			name: "Patches inside a removed node",
+			patches: PatchSet{
+				&Replace{Old: lis[3].Children()[0], New: newLi.Children()[0]},
+				&SetAttr{Node: lis[3], Attr: &Attr{Name: "class", Value: "foo"}},
+				&Remove{Node: lis[3]},
+			},
+			expected: PatchSet{
+				&Remove{Node: lis[3]},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		got := tc.patches.Optimize()
+		if len(got) != len(tc.expected) {
+			t.Errorf("%s: Expected %d patches but got %d: %v", tc.name, len(tc.expected), len(got), got)
+			continue
+		}
+		for i, patch := range got {
+			if err := expectPatchEquals(tc.expected[i], patch); err != nil {
+				t.Errorf("%s: patch %d: %s", tc.name, i, err)
+			}
+		}
+	}
+}
+
+// TestOptimizeReplaceHTML tests that the html of a Replace's New element
+// includes the attribute patches which were merged into it.
+func TestOptimizeReplaceHTML(t *testing.T) {
+	src := `<ul><li class="one">one</li><li>two</li></ul>`
+	tree, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	li := tree.Children[0].Children()[0]
+	newTree, err := Parse([]byte(`<li id="uno">uno</li>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	patches := PatchSet{
+		&Replace{Old: li, New: newTree.Children[0]},
+		&SetAttr{Node: li, Attr: &Attr{Name: "class", Value: "foo"}},
+		&RemoveAttr{Node: li, AttrName: "id"},
+	}
+	optimized := patches.Optimize()
+	if len(optimized) != 1 {
+		t.Fatalf("Expected 1 patch but got %d: %s", len(optimized), patchSetString(optimized))
+	}
+	replace, ok := optimized[0].(*Replace)
+	if !ok {
+		t.Fatalf("Expected a Replace but got %T", optimized[0])
+	}
+	expected := `<li class="foo">uno</li>`
+	if got := string(replace.New.HTML()); got != expected {
+		t.Errorf("Replace.New.HTML() was not correct.\nExpected: %s\nGot:      %s", expected, got)
+	}
+	root := newMemRoot(src)
+	if err := optimized.Patch(root); err != nil {
+		t.Fatalf("Unexpected error in Patch: %s", err.Error())
+	}
+	if expected := `<ul><li class="foo">uno</li><li>two</li></ul>`; root.InnerHTML() != expected {
+		t.Errorf("Actual DOM was not correct.\nExpected: %s\nGot:      %s", expected, root.InnerHTML())
+	}
+}
+
+// TestOptimizeDiffRemoves tests that the Remove patches from Diff, which
+// removes extra nodes starting from the last one, are merged.
+func TestOptimizeDiffRemoves(t *testing.T) {
+	for _, src := range []string{
+		"<ul><li>one</li><li>two</li><li>three</li><li>four</li></ul>",
+		"<li>one</li><li>two</li><li>three</li><li>four</li>",
+	} {
+		tree, err := Parse([]byte(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		other, err := Parse([]byte(strings.Replace(src, "<li>two</li><li>three</li><li>four</li>", "", 1)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		patches, err := Diff(tree, other)
+		if err != nil {
+			t.Fatal(err)
+		}
+		optimized := patches.Optimize()
+		if len(optimized) != 1 {
+			t.Errorf("Expected 1 patch for %s but got %d: %s", src, len(optimized), patchSetString(optimized))
+			continue
+		}
+		removeRange, ok := optimized[0].(*RemoveRange)
+		if !ok {
+			t.Errorf("Expected a RemoveRange for %s but got %T", src, optimized[0])
+			continue
+		}
+		if len(removeRange.Nodes) != 3 {
+			t.Errorf("Expected RemoveRange to have 3 nodes for %s but got %d", src, len(removeRange.Nodes))
+		}
+		root := newMemRoot(src)
+		if err := optimized.Patch(root); err != nil {
+			t.Errorf("Unexpected error in Patch for %s: %s", src, err.Error())
+			continue
+		}
+		if expected := string(other.HTML()); root.InnerHTML() != expected {
+			t.Errorf("Actual DOM was not correct.\nExpected: %s\nGot:      %s", expected, root.InnerHTML())
+		}
+	}
+}
+
+// TestOptimizeDocumentProperties checks that applying an optimized PatchSet
+// with HeadPatch, BodyPatch, SetTitle and Insert patches to an in-memory
+// document has the same result as applying the original PatchSet.
+func TestOptimizeDocumentProperties(t *testing.T) {
+	oldSetTitle := setDocumentTitle
+	defer func() {
+		setDocumentTitle = oldSetTitle
+	}()
+	title := ""
+	setDocumentTitle = func(newTitle string) {
+		title = newTitle
+	}
+	property := func(c optimizeDocumentCase) bool {
+		patches := c.patches()
+		optimized := c.patches().Optimize()
+		if len(optimized) > len(patches) {
+			t.Logf("Optimized PatchSet has %d patches but original had %d", len(optimized), len(patches))
+			return false
+		}
+		apply := func(patches PatchSet) (head, body, gotTitle string, err error) {
+			headRoot, bodyRoot := newMemRoot(c.oldHead), newMemRoot(c.body.oldHTML)
+			title = ""
+			withMemDocument(headRoot, bodyRoot, func() {
+				err = patches.Patch(nil)
+			})
+			return headRoot.CanonicalHTML(), bodyRoot.CanonicalHTML(), title, err
+		}
+		expectedHead, expectedBody, expectedTitle, err := apply(patches)
+		if err != nil {
+			t.Log(err)
+			return false
+		}
+		gotHead, gotBody, gotTitle, err := apply(optimized)
+		if err != nil {
+			t.Log(err)
+			return false
+		}
+		if gotHead != expectedHead || gotBody != expectedBody || gotTitle != expectedTitle {
+			t.Logf("Optimized patches resulted in\n%s\n%s\n%q\nbut expected\n%s\n%s\n%q\nfor %s", gotHead, gotBody, gotTitle, expectedHead, expectedBody, expectedTitle, c)
+			return false
+		}
+		return true
+	}
+	if err := quick.Check(property, &quick.Config{MaxCount: 500}); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestOptimizeInsert tests that patches for a node are not merged across an
+// Insert which moves the node.
+func TestOptimizeInsert(t *testing.T) {
+	src := "<p>one</p><p>two</p>"
+	tree, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newTree, err := Parse([]byte("<p>zero</p><p>one</p><p>two</p>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := tree.Children[0]
+	patches := PatchSet{
+		&SetAttr{Node: p, Attr: &Attr{Name: "class", Value: "a"}},
+		&Insert{Child: newTree.Children[0]},
+		// Insert does not update the indexes, so this changes the new node.
+		&SetAttr{Node: p, Attr: &Attr{Name: "class", Value: "b"}},
+		&Insert{Child: newTree.Children[2]},
+		&SetAttr{Node: p, Attr: &Attr{Name: "class", Value: "c"}},
+	}
+	optimized := patches.Optimize()
+	if len(optimized) != 4 {
+		t.Errorf("Expected 4 patches but got %d: %s", len(optimized), patchSetString(optimized))
+	}
+	expectedRoot := newMemRoot(src)
+	if err := patches.Patch(expectedRoot); err != nil {
+		t.Fatalf("Unexpected error in Patch: %s", err.Error())
+	}
+	gotRoot := newMemRoot(src)
+	if err := optimized.Patch(gotRoot); err != nil {
+		t.Fatalf("Unexpected error in Patch: %s", err.Error())
+	}
+	if gotRoot.InnerHTML() != expectedRoot.InnerHTML() {
+		t.Errorf("Actual DOM was not correct.\nExpected: %s\nGot:      %s", expectedRoot.InnerHTML(), gotRoot.InnerHTML())
+	}
+}
+
+// expectPatchEquals returns an error if got is not equal to expected. Nodes in
+// the patches are compared by identity, except for the New node of a Replace,
+// which is compared with CompareNodes.
+func expectPatchEquals(expected, got Patcher) error {
+	if reflect.TypeOf(expected) != reflect.TypeOf(got) {
+		return fmt.Errorf("Expected patch of type %T but got %T", expected, got)
+	}
+	if expectedReplace, ok := expected.(*Replace); ok {
+		gotReplace := got.(*Replace)
+		if expectedReplace.Old != gotReplace.Old {
+			return fmt.Errorf("Expected Replace of %v but got Replace of %v", expectedReplace.Old, gotReplace.Old)
+		}
+		if match, msg := CompareNodes(expectedReplace.New, gotReplace.New, true); !match {
+			return fmt.Errorf("Replace.New was not correct: %s", msg)
+		}
+		return nil
+	}
+	if !reflect.DeepEqual(expected, got) {
+		return fmt.Errorf("Expected %#v but got %#v", expected, got)
+	}
+	return nil
+}
+
+// optimizeCase is a randomly generated test case for Optimize. It satisfies
+// quick.Generator.
+type optimizeCase struct {
+	oldHTML string
+	newHTML string
+	seed    int64
+}
+
+func (c optimizeCase) String() string {
+	return fmt.Sprintf("old: %s new: %s seed: %d", c.oldHTML, c.newHTML, c.seed)
+}
+
+func (optimizeCase) Generate(r *rand.Rand, size int) reflect.Value {
+	oldHTML := randomHTML(r, 3)
+	// Sometimes derive the new html from the old html so that the trees share
+	// most of their structure.
+	newHTML := randomHTML(r, 3)
+	if r.Intn(2) == 0 {
+		newHTML = oldHTML
+	}
+	return reflect.ValueOf(optimizeCase{
+		oldHTML: "<div>" + oldHTML + "</div>",
+		newHTML: "<div>" + newHTML + "</div>",
+		seed:    r.Int63(),
+	})
+}
+
+var (
+	randomTags       = []string{"div", "ul", "li", "span", "p"}
+	randomAttrNames  = []string{"class", "id", "title"}
+	randomAttrValues = []string{"a", "b", "c"}
+	randomTexts      = []string{"one", "two", "three"}
+)
+
+// randomHTML generates random html with elements nested up to depth levels
+// deep.
+func randomHTML(r *rand.Rand, depth int) string {
+	result := ""
+	lastWasText := false
+	for i := r.Intn(4); i > 0; i-- {
+		switch n := r.Intn(10); {
+		case n < 6 && depth > 0:
+			tag := randomTags[r.Intn(len(randomTags))]
+			result += "<" + tag
+			for _, j := range r.Perm(len(randomAttrNames))[:r.Intn(3)] {
+				result += fmt.Sprintf(` %s="%s"`, randomAttrNames[j], randomAttrValues[r.Intn(len(randomAttrValues))])
+			}
+			result += ">" + randomHTML(r, depth-1) + "</" + tag + ">"
+			lastWasText = false
+		case n < 9 && !lastWasText:
+			// Adjacent text nodes would be merged by the parser, so don't
+			// generate them.
+			result += randomTexts[r.Intn(len(randomTexts))]
+			lastWasText = true
+		default:
+			result += "<!--" + randomTexts[r.Intn(len(randomTexts))] + "-->"
+			lastWasText = false
+		}
+	}
+	return result
+}
+
+// patches returns the result of diffing the old and new trees for c with
+// some additional redundant patches mixed in.
+func (c optimizeCase) patches() PatchSet {
+	r := rand.New(rand.NewSource(c.seed))
+	oldTree, err := Parse([]byte(c.oldHTML))
+	if err != nil {
+		panic(err)
+	}
+	newTree, err := Parse([]byte(c.newHTML))
+	if err != nil {
+		panic(err)
+	}
+	opts := DiffOptions{}
+	if r.Intn(3) == 0 {
+		opts.ReplaceChildrenRatio = 0.5
+	}
+	diff, err := DiffWithOptions(oldTree, newTree, opts)
+	if err != nil {
+		panic(err)
+	}
+	oldElements := elementsIn(oldTree.Children)
+
+	// Change some attributes and values before any of the patches from Diff.
+	// Some of these will be overwritten by later patches.
+	patches := PatchSet{}
+	for _, el := range oldElements {
+		patches = append(patches, randomAttrPatches(r, el)...)
+		for _, child := range el.Children() {
+			patches = append(patches, randomValuePatches(r, child)...)
+		}
+	}
+	for _, patch := range diff {
+		patches = append(patches, patch)
+		// Change some attributes or values of the nodes that were just
+		// replaced.
+		if replace, ok := patch.(*Replace); ok {
+			switch newNode := replace.New.(type) {
+			case *Element:
+				patches = append(patches, randomAttrPatches(r, replace.Old)...)
+			case *Text:
+				patches = append(patches, randomValuePatches(r, newNode)...)
+			case *Comment:
+				patches = append(patches, randomValuePatches(r, newNode)...)
+			}
+		}
+	}
+	// Change some attributes after all the patches from Diff, but only for
+	// the elements that are still in the actual DOM. After a ReplaceChildren
+	// for the root, the old elements find the new nodes at the same indexes,
+	// so they are only changed if those nodes are elements too.
+	for _, el := range oldElements {
+		alive := true
+		for _, patch := range diff {
+			if replaceChildren, ok := patch.(*ReplaceChildren); ok && replaceChildren.Parent == nil {
+				_, isElement := newTree.nodeAt(el.Index()).(*Element)
+				alive = alive && isElement
+			} else if discardsInside(patch, el) {
+				alive = false
+			}
+		}
+		if alive {
+			patches = append(patches, randomAttrPatches(r, el)...)
+		}
+	}
+	return patches
+}
+
+// optimizeDocumentCase is a randomly generated test case for Optimize with
+// patches for a whole document. It satisfies quick.Generator.
+type optimizeDocumentCase struct {
+	oldHead string
+	newHead string
+	body    optimizeCase
+	seed    int64
+}
+
+func (c optimizeDocumentCase) String() string {
+	return fmt.Sprintf("old head: %s new head: %s body: %s seed: %d", c.oldHead, c.newHead, c.body, c.seed)
+}
+
+func (optimizeDocumentCase) Generate(r *rand.Rand, size int) reflect.Value {
+	return reflect.ValueOf(optimizeDocumentCase{
+		oldHead: randomHeadHTML(r),
+		newHead: randomHeadHTML(r),
+		body:    optimizeCase{}.Generate(r, size).Interface().(optimizeCase),
+		seed:    r.Int63(),
+	})
+}
+
+var randomHeadNodes = []string{
+	"<title>one</title>",
+	`<meta charset="utf-8">`,
+	`<meta name="description" content="a">`,
+	`<meta name="description" content="b">`,
+	`<meta property="og:title" content="c">`,
+	`<link rel="canonical" href="/a">`,
+	`<link rel="icon" href="/b.png">`,
+	"<!--one-->",
+	"\n",
+}
+
+// randomHeadHTML generates random html for the children of the head.
+func randomHeadHTML(r *rand.Rand) string {
+	result := ""
+	for i := r.Intn(6); i > 0; i-- {
+		result += randomHeadNodes[r.Intn(len(randomHeadNodes))]
+	}
+	return result
+}
+
+// patches returns a HeadPatch with the result of diffing the old and new
+// heads for c, split into one or two HeadPatch patches and mixed in with some
+// other patches, followed by the patches for the body split the same way.
+func (c optimizeDocumentCase) patches() PatchSet {
+	r := rand.New(rand.NewSource(c.seed))
+	oldHead, err := Parse([]byte(c.oldHead))
+	if err != nil {
+		panic(err)
+	}
+	newHead, err := Parse([]byte(c.newHead))
+	if err != nil {
+		panic(err)
+	}
+	diff, err := diffHead(oldHead.Children, newHead.Children)
+	if err != nil {
+		panic(err)
+	}
+	oldElements := elementsIn(oldHead.Children)
+	headPatches := PatchSet{}
+	for _, el := range oldElements {
+		headPatches = append(headPatches, randomAttrPatches(r, el)...)
+	}
+	for _, patch := range diff {
+		headPatches = append(headPatches, patch)
+		// Change some attributes of the nodes that were just inserted.
+		if insert, ok := patch.(*Insert); ok {
+			if _, ok := insert.Child.(*Element); ok {
+				headPatches = append(headPatches, randomAttrPatches(r, insert.Child)...)
+			}
+		}
+	}
+	// Change some attributes of the nodes at the indexes of the old elements
+	// after all the patches from diffHead. Insert does not update the
+	// indexes, so these might not be the same nodes.
+	for _, el := range oldElements {
+		if index := el.Index()[0]; index < len(newHead.Children) && !discardsInsideAny(diff, el) {
+			headPatches = append(headPatches, randomAttrPatches(r, el)...)
+		}
+	}
+	bodyPatches := c.body.patches()
+
+	patches := PatchSet{}
+	for _, part := range splitPatches(r, headPatches) {
+		patches = append(patches, randomTitlePatches(r)...)
+		patches = append(patches, &HeadPatch{Patches: part})
+	}
+	for _, part := range splitPatches(r, bodyPatches) {
+		patches = append(patches, randomTitlePatches(r)...)
+		patches = append(patches, &BodyPatch{Patches: part})
+	}
+	return append(patches, randomTitlePatches(r)...)
+}
+
+// splitPatches splits patches into one or two parts at a random index.
+func splitPatches(r *rand.Rand, patches PatchSet) []PatchSet {
+	if len(patches) < 2 || r.Intn(2) == 0 {
+		return []PatchSet{patches}
+	}
+	i := 1 + r.Intn(len(patches)-1)
+	return []PatchSet{patches[:i], patches[i:]}
+}
+
+// randomTitlePatches returns zero or more random SetTitle patches.
+func randomTitlePatches(r *rand.Rand) []Patcher {
+	patches := []Patcher{}
+	for i := r.Intn(3); i > 0; i-- {
+		patches = append(patches, &SetTitle{Title: randomTexts[r.Intn(len(randomTexts))]})
+	}
+	return patches
+}
+
+// discardsInsideAny returns true iff any of the patches discards n or one
+// of its ancestors.
+func discardsInsideAny(patches []Patcher, n Node) bool {
+	for _, patch := range patches {
+		if discardsInside(patch, n) {
+			return true
+		}
+	}
+	return false
+}
+
+// randomAttrPatches returns zero or more random SetAttr and RemoveAttr
+// patches for node.
+func randomAttrPatches(r *rand.Rand, node Node) []Patcher {
+	patches := []Patcher{}
+	for i := r.Intn(3); i > 0; i-- {
+		name := randomAttrNames[r.Intn(len(randomAttrNames))]
+		if r.Intn(2) == 0 {
+			patches = append(patches, &RemoveAttr{Node: node, AttrName: name})
+		} else {
+			value := randomAttrValues[r.Intn(len(randomAttrValues))]
+			patches = append(patches, &SetAttr{Node: node, Attr: &Attr{Name: name, Value: value}})
+		}
+	}
+	return patches
+}
+
+// randomValuePatches returns zero or more random SetText or SetComment
+// patches for node, depending on its type.
+func randomValuePatches(r *rand.Rand, node Node) []Patcher {
+	patches := []Patcher{}
+	for i := r.Intn(3); i > 0; i-- {
+		value := []byte(randomTexts[r.Intn(len(randomTexts))])
+		switch n := node.(type) {
+		case *Text:
+			patches = append(patches, &SetText{Node: n, Value: value})
+		case *Comment:
+			patches = append(patches, &SetComment{Node: n, Value: value})
+		}
+	}
+	return patches
+}
+
+// elementsIn recursively finds all the elements in nodes.
+func elementsIn(nodes []Node) []*Element {
+	elements := []*Element{}
+	for _, node := range nodes {
+		if el, ok := node.(*Element); ok {
+			elements = append(elements, el)
+			elements = append(elements, elementsIn(el.Children())...)
+		}
+	}
+	return elements
+}
@@ -3,53 +3,159 @@ package vdom
 import (
 	"encoding/xml"
 	"fmt"
+	"html"
 	"io"
+	"strings"
 )
 
 // Parse reads escaped html from src and returns a virtual tree structure
 // representing it. It returns an error if there was a problem parsing the html.
 func Parse(src []byte) (*Tree, error) {
-	// Create a xml.Decoder to read from an IndexedByteReader
-	r := NewIndexedByteReader(src)
+	return parse(NewIndexedByteReader(src), true, nil)
+}
+
+// ParseError is returned by Parse and ParseReader when the html is malformed.
+type ParseError struct {
+	// Pos is the position in the html where the error was found.
+	Pos Position
+	// Message describes what went wrong.
+	Message string
+	// Snippet is the line of html where the error was found. It may be
+	// incomplete if the html was read by ParseReader.
+	Snippet string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("vdom: parse error at line %d, column %d: %s\n\t%s", e.Pos.Line, e.Pos.Column, e.Message, e.Snippet)
+}
+
+// ParseReader reads escaped html from r and returns a virtual tree structure
+// representing it. Unlike Parse, it does not need the entire document in
+// memory at once. The tree is built as the html is read, and the html that
+// has already been parsed is thrown away. Since the tree does not keep the
+// original html, the HTML methods of the nodes construct the html from the
+// nodes themselves. ParseReader returns an error if there was a problem
+// parsing the html or reading from r.
+func ParseReader(r io.Reader) (*Tree, error) {
+	return parse(newIndexedByteReaderFrom(r), false, nil)
+}
+
+// parse parses html from r into a virtual tree. If keepSource is true, the
+// src for the tree is everything that was read from r. Otherwise, the bytes
+// are discarded from r as soon as they are no longer needed. context is the
+// element that the html is inside of (see ParseFragment), or nil. It is only
+// used to work out the namespace of the first-level nodes.
+func parse(r *IndexedByteReader, keepSource bool, context *Element) (*Tree, error) {
+	// Create a xml.Decoder to read from the IndexedByteReader
 	dec := xml.NewDecoder(r)
 	dec.Entity = xml.HTMLEntity
 	dec.Strict = false
 	dec.AutoClose = xml.HTMLAutoClose
 
 	// Iterate through each token and construct the tree
-	tree := &Tree{src: src, reader: r}
+	tree := &Tree{reader: r}
 	var currentParent *Element = nil
-	for token, err := dec.Token(); ; token, err = dec.Token() {
+	// skipped is the number of bytes which were read as raw text without going
+	// through the decoder, so they are not included in its input offset.
+	skipped := 0
+	// lookahead is the start of the next token if the decoder already read it
+	// while autoclosing an element, or -1 if it did not.
+	lookahead := -1
+	for {
+		// The input offset of the decoder is the start of the next token,
+		// unless it already read that token ahead of time.
+		start := int(dec.InputOffset()) + skipped
+		if lookahead != -1 {
+			start = lookahead
+			lookahead = -1
+		}
+		token, err := dec.Token()
 		if err != nil {
 			if err == io.EOF {
 				// We reached the end of the document we were parsing
 				break
+			} else if syntaxErr, ok := err.(*xml.SyntaxError); ok {
+				if syntaxErr.Msg == "unexpected EOF" && closeVoidElement(tree, currentParent) {
+					// The decoder only autocloses an element when it finds the next
+					// token, so a void element at the very end looks unclosed.
+					break
+				}
+				offset := int(dec.InputOffset()) + skipped
+				if isEndTagError(syntaxErr) {
+					// The decoder only finds these errors after reading the whole
+					// end tag (or reading past it), so point to the start instead.
+					offset = start
+				}
+				return nil, r.parseError(offset, syntaxErr.Msg)
 			} else {
-				// There was some unexpected error
+				// There was some unexpected error, e.g. from the underlying reader
 				return nil, err
 			}
 		}
-		if nextParent, err := parseToken(tree, token, currentParent); err != nil {
-			return nil, err
+		end := int(dec.InputOffset()) + skipped
+		closed := currentParent
+		if nextParent, err := parseToken(tree, token, currentParent, context, start, end); err != nil {
+			return nil, r.parseError(start, err.Error())
 		} else {
 			currentParent = nextParent
 		}
+		if _, ok := token.(xml.EndElement); ok && closed.autoClosed && end > start {
+			// The decoder only autocloses an element when it reads the next
+			// token, which it returns next time. That token starts where this
+			// one did.
+			lookahead = start
+		}
+		if _, ok := token.(xml.StartElement); ok && hasRawText(tree, currentParent) {
+			// The contents of the element are not html, so they need to be read
+			// directly instead of being tokenized by the decoder. The decoder
+			// will then find the closing tag as usual.
+			textStart := r.Offset()
+			if err := parseRawText(tree, currentParent); err != nil {
+				return nil, err
+			}
+			skipped += r.Offset() - textStart
+		}
+		if !keepSource {
+			// The xml.Decoder may have read one byte past the end of the token, so
+			// it needs to be kept around for the next token.
+			// If it already read the next token, that needs to be kept as well.
+			keep := r.Offset() - 1
+			if lookahead != -1 && lookahead < keep {
+				keep = lookahead
+			}
+			r.discardBefore(keep)
+		}
+	}
+	if keepSource {
+		tree.src = r.buf
 	}
+	tree.reader = nil
 	return tree, nil
 }
 
 // parseToken parses a single token and adds the appropriate node(s) to the tree. When calling
 // parseToken iteratively, you should always capture the nextParent return and use it as the
-// currentParent argument in the next iteration.
-func parseToken(tree *Tree, token xml.Token, currentParent *Element) (nextParent *Element, err error) {
+// currentParent argument in the next iteration. context is the element that the
+// html is inside of, or nil. start and end are the offsets of the token in the source.
+func parseToken(tree *Tree, token xml.Token, currentParent, context *Element, start, end int) (nextParent *Element, err error) {
+	// namespaceParent is the element which decides the namespace of a new node.
+	namespaceParent := currentParent
+	if namespaceParent == nil {
+		namespaceParent = context
+	}
 	var resultingNode Node
 	switch token.(type) {
 	case xml.StartElement:
 		// Parse the name and attrs directly from the xml.StartElement
 		startEl := token.(xml.StartElement)
+		name := parseName(startEl.Name)
 		el := &Element{
-			Name: parseName(startEl.Name),
-			tree: tree,
+			Name:      name,
+			Namespace: elementNamespace(name, namespaceParent),
+			tree:      tree,
+			pos: Pos{
+				Start: tree.reader.position(start),
+			},
 		}
 		for _, attr := range startEl.Attr {
 			el.Attrs = append(el.Attrs, Attr{
@@ -57,6 +163,15 @@ func parseToken(tree *Tree, token xml.Token, currentParent *Element) (nextParent
 				Value: attr.Value,
 			})
 		}
+		el.Attrs = normalizeAttrs(el.Attrs, el.Namespace)
+		for i, attr := range el.Attrs {
+			// The xml decoder gives an attribute without a value (e.g. <input
+			// checked>) its own name as the value. The browser gives it an
+			// empty value, which means the same thing for boolean attributes.
+			if isBooleanAttr(el.Namespace, attr.Name) && strings.EqualFold(attr.Value, attr.Name) {
+				el.Attrs[i].Value = ""
+			}
+		}
 		if currentParent != nil {
 			// Set the index based on how many children we've seen so far
 			el.index = make([]int, len(currentParent.index)+1)
@@ -76,11 +191,11 @@ func parseToken(tree *Tree, token xml.Token, currentParent *Element) (nextParent
 		// starts. Since we don't know the exact length of the starting tag (might be extra whitespace
 		// in between attributes), we can't just do arithmetic here. Instead, start from the current
 		// offset and find the first preceding tag open (the '<' character)
-		start, err := tree.reader.BackwardsSearch(0, tree.reader.Offset()-1, '<')
+		srcStart, err := tree.reader.BackwardsSearch(0, tree.reader.Offset()-1, '<')
 		if err != nil {
 			return nil, err
 		}
-		el.srcStart = start
+		el.srcStart = srcStart
 		// The innerHTML start is just the current offset
 		el.srcInnerStart = tree.reader.Offset()
 		// Set this element to the nextParent. The next node(s) we find
@@ -101,7 +216,7 @@ func parseToken(tree *Tree, token xml.Token, currentParent *Element) (nextParent
 		}
 		// The currentParent has been closed
 		// Check whether it was autoclosed
-		if wasAutoClosed(tree, currentParent.Name) {
+		if closingStart, found := closingTagStart(tree, currentParent.Name); !found {
 			// There was not a corresponding closing tag, so the currentParent was
 			// autoclosed and therefore can have no children. Don't worry about the
 			// ending index, as our HTML method will do something different in this case.
@@ -113,10 +228,14 @@ func parseToken(tree *Tree, token xml.Token, currentParent *Element) (nextParent
 			// index is the current offset.
 			currentParent.srcEnd = tree.reader.Offset()
 			// The innerHTML ends at the start of the closing tag
-			// The closing tag has length of len(currentParent.Name) + 3
-			// for the <, /, and > characters.
-			closingTagLength := len(currentParent.Name) + 3
-			currentParent.srcInnerEnd = tree.reader.Offset() - closingTagLength
+			currentParent.srcInnerEnd = closingStart
+		}
+		if currentParent.autoClosed {
+			// The currentParent ends with its start tag. The decoder may have read
+			// ahead before deciding to autoclose it, so we can't use end.
+			currentParent.pos.End = tree.reader.position(currentParent.srcInnerStart)
+		} else {
+			currentParent.pos.End = tree.reader.position(end)
 		}
 		// The currentParent has no more children.
 		// The next node(s) we find must be children of currentParent.parent.
@@ -127,9 +246,32 @@ func parseToken(tree *Tree, token xml.Token, currentParent *Element) (nextParent
 		}
 	case xml.CharData:
 		charData := token.(xml.CharData)
+		if isCDATA(tree, start) {
+			// The decoder returns CDATA sections as plain text, so we need to check
+			// the source to tell them apart.
+			var node Node
+			if childNamespace(namespaceParent) != "" {
+				node = &CDATA{
+					Value: []byte(charData.Copy()),
+					pos:   tree.reader.span(start, end),
+				}
+			} else {
+				// Outside of svg and mathml, the browser treats a CDATA section as
+				// a comment.
+				node = &Comment{
+					Value: []byte("[CDATA[" + string(charData) + "]]"),
+					pos:   tree.reader.span(start, end),
+				}
+			}
+			addToParent(tree, currentParent, node)
+			resultingNode = node
+			nextParent = currentParent
+			break
+		}
 		// Parse the value from the xml.CharData
 		text := &Text{
 			Value: []byte(charData.Copy()),
+			pos:   tree.reader.span(start, end),
 		}
 		if currentParent != nil {
 			// Set the index based on how many children we've seen so far
@@ -153,6 +295,7 @@ func parseToken(tree *Tree, token xml.Token, currentParent *Element) (nextParent
 		// Parse the value from the xml.Comment
 		comment := &Comment{
 			Value: []byte(xmlComment.Copy()),
+			pos:   tree.reader.span(start, end),
 		}
 		if currentParent != nil {
 			// Set the index based on how many children we've seen so far
@@ -172,9 +315,37 @@ func parseToken(tree *Tree, token xml.Token, currentParent *Element) (nextParent
 		resultingNode = comment
 		nextParent = currentParent
 	case xml.ProcInst:
-		return nil, fmt.Errorf("parse error: found token of type xml.ProcInst, which is not allowed in html")
+		// html does not have processing instructions, so the browser treats them
+		// as comments, e.g. <?xml version="1.0"?> is a comment with the value
+		// ?xml version="1.0"?.
+		procInst := token.(xml.ProcInst)
+		comment := &Comment{
+			Value: bogusCommentValue(tree, start+1, end, "?"+procInst.Target+" "+string(procInst.Inst)+"?"),
+			pos:   tree.reader.span(start, end),
+		}
+		addToParent(tree, currentParent, comment)
+		resultingNode = comment
+		nextParent = currentParent
 	case xml.Directive:
-		return nil, fmt.Errorf("parse error: found token of type xml.Directive, which is not allowed in html")
+		directive := string(token.(xml.Directive))
+		nextParent = currentParent
+		if doctype, ok := parseDoctype(directive); ok {
+			// Like the browser, ignore any doctype which is inside of an element.
+			if currentParent == nil {
+				doctype.pos = tree.reader.span(start, end)
+				addToParent(tree, currentParent, doctype)
+				resultingNode = doctype
+			}
+			break
+		}
+		// Any other directive, e.g. <!ELEMENT br EMPTY>, is treated as a
+		// comment by the browser.
+		comment := &Comment{
+			Value: bogusCommentValue(tree, start+2, end, directive),
+			pos:   tree.reader.span(start, end),
+		}
+		addToParent(tree, currentParent, comment)
+		resultingNode = comment
 	}
 	if resultingNode != nil && currentParent == nil {
 		// If this node has no parents, it is one of the first-level children
@@ -184,30 +355,178 @@ func parseToken(tree *Tree, token xml.Token, currentParent *Element) (nextParent
 	return nextParent, nil
 }
 
-// parseName converts an xml.Name to a single string name. For our
-// purposes we are not interested in the different namespaces, and
-// just need to treat the name as a single string.
-func parseName(name xml.Name) string {
-	if name.Space != "" {
-		return fmt.Sprintf("%s:%s", name.Space, name.Local)
+// closeVoidElement closes el if it is a void element (e.g. <br>) which was
+// left open at the end of the html, and there are no other open elements.
+// It returns true if el was closed.
+func closeVoidElement(tree *Tree, el *Element) bool {
+	if el == nil || el.parent != nil || !voidElements[strings.ToLower(el.Name)] {
+		return false
+	}
+	el.autoClosed = true
+	el.pos.End = tree.reader.position(el.srcInnerStart)
+	return true
+}
+
+// isEndTagError returns true iff err is about an end tag which does not
+// match any open element.
+func isEndTagError(err *xml.SyntaxError) bool {
+	return strings.HasPrefix(err.Msg, "unexpected end element") || strings.Contains(err.Msg, " closed by </")
+}
+
+// addToParent sets the index and parent of node, which can't have any
+// children, and adds it to the children of parent. If parent is nil, the
+// caller is responsible for adding node to the first-level children of the
+// tree.
+func addToParent(tree *Tree, parent *Element, node Node) {
+	if parent != nil {
+		setPosition(node, parent, childIndex(parent.index, len(parent.children)))
+		parent.children = append(parent.children, node)
+	} else {
+		setPosition(node, nil, []int{len(tree.Children)})
+	}
+}
+
+// cdataStart is the start of a CDATA section.
+const cdataStart = "<![CDATA["
+
+// isCDATA returns true iff the token which starts at the given offset is a
+// CDATA section.
+func isCDATA(tree *Tree, start int) bool {
+	source, found := tree.reader.bytesBetween(start, start+len(cdataStart))
+	return found && string(source) == cdataStart
+}
+
+// bogusCommentValue returns the value of the comment that the browser creates
+// for markup which is not allowed in html. The value is everything from start
+// up to the closing '>' just before end. If the source was discarded, it
+// returns fallback instead.
+func bogusCommentValue(tree *Tree, start, end int, fallback string) []byte {
+	source, found := tree.reader.bytesBetween(start, end-1)
+	if !found || start > end-1 {
+		return []byte(fallback)
 	}
-	return name.Local
+	return append([]byte{}, source...)
 }
 
-// wasAutoClosed returns true if the tagName was autoclosed. It does
-// this by reading the bytes backwards from the current offset of the
-// tree's reader and comparing them to the expected closing tag.
-func wasAutoClosed(tree *Tree, tagName string) bool {
-	closingTag := fmt.Sprintf("</%s>", tagName)
+// parseDoctype parses a directive like DOCTYPE html into a Doctype. It
+// returns false if the directive is not a doctype.
+func parseDoctype(directive string) (*Doctype, bool) {
+	fields := strings.Fields(directive)
+	if len(fields) == 0 || !strings.EqualFold(fields[0], "DOCTYPE") {
+		return nil, false
+	}
+	doctype := &Doctype{}
+	if len(fields) > 1 {
+		doctype.Name = strings.ToLower(fields[1])
+	}
+	if len(fields) > 2 {
+		ids := quotedStrings(directive)
+		switch strings.ToUpper(fields[2]) {
+		case "PUBLIC":
+			if len(ids) > 0 {
+				doctype.PublicID = ids[0]
+			}
+			if len(ids) > 1 {
+				doctype.SystemID = ids[1]
+			}
+		case "SYSTEM":
+			if len(ids) > 0 {
+				doctype.SystemID = ids[0]
+			}
+		}
+	}
+	return doctype, true
+}
+
+// quotedStrings returns the contents of each string in s which is surrounded
+// by single or double quotes.
+func quotedStrings(s string) []string {
+	result := []string{}
+	for {
+		start := strings.IndexAny(s, `"'`)
+		if start == -1 {
+			return result
+		}
+		end := strings.IndexByte(s[start+1:], s[start])
+		if end == -1 {
+			return result
+		}
+		result = append(result, s[start+1:start+1+end])
+		s = s[start+1+end+1:]
+	}
+}
+
+// hasRawText returns true iff el, which was just opened, is a raw text or
+// rcdata element (e.g. <script> or <textarea>) in the html namespace. The
+// contents of these elements are always a single text node. An element
+// which closes itself, like <script/>, has no contents.
+func hasRawText(tree *Tree, el *Element) bool {
+	if el == nil || el.Namespace != "" {
+		return false
+	}
+	name := strings.ToLower(el.Name)
+	if !rawTextElements[name] && !rcdataElements[name] {
+		return false
+	}
+	offset := tree.reader.Offset()
+	lastBytes, found := tree.reader.bytesBetween(offset-2, offset)
+	return found && string(lastBytes) != "/>"
+}
+
+// parseRawText reads the contents of the raw text or rcdata element el
+// exactly as they were written, and adds them to el as a single text node.
+// Any character references in rcdata are decoded.
+func parseRawText(tree *Tree, el *Element) error {
+	start := tree.reader.Offset()
+	value, err := tree.reader.readUntilClosingTag(el.Name)
+	if err != nil {
+		return err
+	}
+	if len(value) == 0 {
+		return nil
+	}
+	if rcdataElements[strings.ToLower(el.Name)] {
+		value = []byte(html.UnescapeString(string(value)))
+	} else {
+		for ancestor := el; ancestor != nil; ancestor = ancestor.parent {
+			ancestor.hasRawText = true
+		}
+		tree.hasRawText = true
+	}
+	el.children = append(el.children, &Text{
+		Value:  value,
+		parent: el,
+		index:  childIndex(el.index, len(el.children)),
+		pos:    tree.reader.span(start, tree.reader.Offset()),
+	})
+	return nil
+}
+
+// closingTagStart returns the offset of the closing tag for tagName, which
+// must be the last thing the tree's reader read, e.g. </div> or </div >. It
+// returns false if the last bytes to be read were not the closing tag, which
+// means that the element was autoclosed. If the bytes were discarded, they
+// belonged to an earlier token and can't be the closing tag.
+func closingTagStart(tree *Tree, tagName string) (int, bool) {
 	stop := tree.reader.Offset()
-	start := stop - len(closingTag)
-	if start < 0 {
-		// The tag must have been autoclosed becuase there's
-		// not enough space in the buffer before this point
-		// to contain the entire closingTag.
-		return true
-	}
-	// The tag was autoclosed iff the last bytes to be read
-	// were not the closing tag.
-	return string(tree.reader.buf[start:stop]) != closingTag
+	// The shortest closing tag has length of len(tagName) + 3 for the <, /,
+	// and > characters.
+	if stop-len(tagName)-3 < 0 {
+		// The tag must have been autoclosed because there's not enough space
+		// in the buffer before this point to contain the entire closing tag.
+		return -1, false
+	}
+	start, err := tree.reader.BackwardsSearch(0, stop-1, '<')
+	if err != nil || start == -1 {
+		return -1, false
+	}
+	lastBytes, found := tree.reader.bytesBetween(start, stop)
+	if !found {
+		return -1, false
+	}
+	closingTag := strings.TrimRight(string(lastBytes[:len(lastBytes)-1]), " \t\n\r\f") + ">"
+	if closingTag != fmt.Sprintf("</%s>", tagName) {
+		return -1, false
+	}
+	return start, true
 }
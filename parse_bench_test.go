@@ -28,3 +28,40 @@ func BenchmarkDiff(b *testing.B) {
 		Diff(oldTree, newTree)
 	}
 }
+
+func BenchmarkDiffStaticSubtree(b *testing.B) {
+	// A large list which does not change, next to a small one which does.
+	sidebar := "<ul>"
+	for i := 0; i < 1000; i++ {
+		sidebar += "<li><a href=\"#\">link</a></li>"
+	}
+	sidebar += "</ul>"
+	oldTree, _ := Parse([]byte("<div>" + sidebar + "<p>one</p></div>"))
+	for i := 0; i < b.N; i++ {
+		newTree, _ := Parse([]byte("<div>" + sidebar + "<p>two</p></div>"))
+		Diff(oldTree, newTree)
+		oldTree = newTree
+	}
+}
+
+func BenchmarkExecuteTemplate(b *testing.B) {
+	todos := benchTemplateTodos()
+	for i := 0; i < b.N; i++ {
+		ExecuteTemplate(todoListTmpl, todos)
+	}
+}
+
+func BenchmarkExecuteTemplateStream(b *testing.B) {
+	todos := benchTemplateTodos()
+	for i := 0; i < b.N; i++ {
+		ExecuteTemplateStream(todoListTmpl, todos)
+	}
+}
+
+func benchTemplateTodos() []templateTodo {
+	todos := make([]templateTodo, 100)
+	for i := range todos {
+		todos[i] = templateTodo{Title: "Todo", Completed: i%2 == 0}
+	}
+	return todos
+}
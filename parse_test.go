@@ -1,8 +1,13 @@
 package vdom
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"reflect"
+	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 // TestParse tests the tree returned from the Parse function for various different
@@ -104,7 +109,7 @@ func TestParse(t *testing.T) {
 			},
 		},
 		{
-			name: "Script tag with escaped characters",
+			name: "Script tag with character references",
 			src:  []byte(`<script type="text/javascript">function((){console.log("&lt;Hello brackets&gt;")})()</script>`),
 			expectedTree: &Tree{
 				Children: []Node{
@@ -115,7 +120,7 @@ func TestParse(t *testing.T) {
 						},
 						children: []Node{
 							&Text{
-								Value: []byte(`function((){console.log("<Hello brackets>")})()`),
+								Value: []byte(`function((){console.log("&lt;Hello brackets&gt;")})()`),
 							},
 						},
 					},
@@ -172,18 +177,34 @@ func TestParse(t *testing.T) {
 	}
 	// Iterate through each test case
 	for i, tc := range testCases {
-		// Parse the input from tc.src
-		gotTree, err := Parse(tc.src)
-		if err != nil {
-			t.Errorf("Unexpected error in Parse: %s", err.Error())
-		}
-		// Check that the resulting tree matches what we expect
-		if match, msg := tc.expectedTree.Compare(gotTree, true); !match {
-			t.Errorf("Error in test case %d (%s): HTML was not parsed correctly.\n%s", i, tc.name, msg)
+		for _, pf := range parseFuncs {
+			// Parse the input from tc.src
+			gotTree, err := pf.parse(tc.src)
+			if err != nil {
+				t.Errorf("Unexpected error in %s: %s", pf.name, err.Error())
+			}
+			// Check that the resulting tree matches what we expect
+			if match, msg := tc.expectedTree.Compare(gotTree, true); !match {
+				t.Errorf("Error in test case %d (%s) with %s: HTML was not parsed correctly.\n%s", i, tc.name, pf.name, msg)
+			}
 		}
 	}
 }
 
+// parseFuncs are the different ways of parsing html which should all give
+// the same results.
+var parseFuncs = []struct {
+	name  string
+	parse func([]byte) (*Tree, error)
+}{
+	{"Parse", Parse},
+	{"ParseReader", func(src []byte) (*Tree, error) {
+		// Read one byte at a time to make sure nothing depends on how the
+		// html is split up.
+		return ParseReader(iotest.OneByteReader(bytes.NewReader(src)))
+	}},
+}
+
 // TestHTML tests the HTML method for each node in a parsed tree for various different
 // inputs.
 func TestHTML(t *testing.T) {
@@ -274,19 +295,19 @@ func TestHTML(t *testing.T) {
 			},
 		},
 		{
-			name: "Script tag with escaped characters",
+			name: "Script tag with character references",
 			src:  []byte(`<script type="text/javascript">function((){console.log("&lt;Hello brackets&gt;")})()</script>`),
 			testFunc: func(tree *Tree) error {
 				{
 					// Test the root element
-					expectedHTML := []byte(`<script type="text/javascript">function((){console.log("<Hello brackets>")})()</script>`)
+					expectedHTML := []byte(`<script type="text/javascript">function((){console.log("&lt;Hello brackets&gt;")})()</script>`)
 					if err := expectHTMLEquals(expectedHTML, tree.Children[0].HTML(), "root script element"); err != nil {
 						return err
 					}
 				}
 				{
 					// Test the text node inside the root element
-					expectedHTML := []byte(`function((){console.log("<Hello brackets>")})()`)
+					expectedHTML := []byte(`function((){console.log("&lt;Hello brackets&gt;")})()`)
 					if err := expectHTMLEquals(expectedHTML, tree.Children[0].Children()[0].HTML(), "text node inside script element"); err != nil {
 						return err
 					}
@@ -343,14 +364,16 @@ func TestHTML(t *testing.T) {
 	}
 	// Iterate through each test case
 	for i, tc := range testCases {
-		// Parse the input from tc.src
-		gotTree, err := Parse(tc.src)
-		if err != nil {
-			t.Errorf("Unexpected error in Parse: %s", err.Error())
-		}
-		// Use the testFunc to test for certain conditions
-		if err := tc.testFunc(gotTree); err != nil {
-			t.Errorf("Error in test case %d (%s):\n%s", i, tc.name, err.Error())
+		for _, pf := range parseFuncs {
+			// Parse the input from tc.src
+			gotTree, err := pf.parse(tc.src)
+			if err != nil {
+				t.Errorf("Unexpected error in %s: %s", pf.name, err.Error())
+			}
+			// Use the testFunc to test for certain conditions
+			if err := tc.testFunc(gotTree); err != nil {
+				t.Errorf("Error in test case %d (%s) with %s:\n%s", i, tc.name, pf.name, err.Error())
+			}
 		}
 	}
 }
@@ -427,10 +450,10 @@ func TestInnerHTML(t *testing.T) {
 			},
 		},
 		{
-			name: "Script tag with escaped characters",
+			name: "Script tag with character references",
 			src:  []byte(`<script type="text/javascript">function((){console.log("&lt;Hello brackets&gt;")})()</script>`),
 			testFunc: func(tree *Tree) error {
-				expectedInner := []byte(`function((){console.log("<Hello brackets>")})()`)
+				expectedInner := []byte(`function((){console.log("&lt;Hello brackets&gt;")})()`)
 				el := tree.Children[0].(*Element)
 				if err := expectInnerHTMLEquals(expectedInner, el.InnerHTML(), "root script element"); err != nil {
 					return err
@@ -467,14 +490,16 @@ func TestInnerHTML(t *testing.T) {
 	}
 	// Iterate through each test case
 	for i, tc := range testCases {
-		// Parse the input from tc.src
-		gotTree, err := Parse(tc.src)
-		if err != nil {
-			t.Errorf("Unexpected error in Parse: %s", err.Error())
-		}
-		// Use the testFunc to test for certain conditions
-		if err := tc.testFunc(gotTree); err != nil {
-			t.Errorf("Error in test case %d (%s):\n%s", i, tc.name, err.Error())
+		for _, pf := range parseFuncs {
+			// Parse the input from tc.src
+			gotTree, err := pf.parse(tc.src)
+			if err != nil {
+				t.Errorf("Unexpected error in %s: %s", pf.name, err.Error())
+			}
+			// Use the testFunc to test for certain conditions
+			if err := tc.testFunc(gotTree); err != nil {
+				t.Errorf("Error in test case %d (%s) with %s:\n%s", i, tc.name, pf.name, err.Error())
+			}
 		}
 	}
 }
@@ -564,14 +589,16 @@ func TestSelector(t *testing.T) {
 	}
 	// Iterate through each test case
 	for i, tc := range testCases {
-		// Parse the input from tc.src
-		gotTree, err := Parse(tc.src)
-		if err != nil {
-			t.Errorf("Unexpected error in Parse: %s", err.Error())
-		}
-		// Use the testFunc to test for certain conditions
-		if err := tc.testFunc(gotTree); err != nil {
-			t.Errorf("Error in test case %d (%s):\n%s", i, tc.name, err.Error())
+		for _, pf := range parseFuncs {
+			// Parse the input from tc.src
+			gotTree, err := pf.parse(tc.src)
+			if err != nil {
+				t.Errorf("Unexpected error in %s: %s", pf.name, err.Error())
+			}
+			// Use the testFunc to test for certain conditions
+			if err := tc.testFunc(gotTree); err != nil {
+				t.Errorf("Error in test case %d (%s) with %s:\n%s", i, tc.name, pf.name, err.Error())
+			}
 		}
 	}
 }
@@ -585,3 +612,713 @@ func expectSelectorEquals(el *Element, expected, description string) error {
 	}
 	return nil
 }
+
+// TestHash tests that the Hash method of the root element is the same for
+// trees with the same contents and different for trees with different contents.
+func TestHash(t *testing.T) {
+	// We'll use table-driven testing here.
+	testCases := []struct {
+		// A human-readable name describing this test case
+		name string
+		// The src html to be parsed for each of the two trees
+		src      []byte
+		otherSrc []byte
+		// Whether or not we expect the root elements to have the same hash
+		expectEqual bool
+	}{
+		{
+			name:        "Identical nested elements",
+			src:         []byte("<ul><li>one</li><li>two</li></ul>"),
+			otherSrc:    []byte("<ul><li>one</li><li>two</li></ul>"),
+			expectEqual: true,
+		},
+		{
+			name:        "Same contents with different whitespace inside tags",
+			src:         []byte(`<div id="foo"><input type="text"></div>`),
+			otherSrc:    []byte(`<div  id="foo" ><input type="text" ></div>`),
+			expectEqual: true,
+		},
+		{
+			name:        "Different nested text",
+			src:         []byte("<ul><li>one</li><li>two</li></ul>"),
+			otherSrc:    []byte("<ul><li>one</li><li>dos</li></ul>"),
+			expectEqual: false,
+		},
+		{
+			name:        "Different nested attribute",
+			src:         []byte(`<div><div class="foo"></div></div>`),
+			otherSrc:    []byte(`<div><div class="bar"></div></div>`),
+			expectEqual: false,
+		},
+		{
+			name:        "Text vs comment",
+			src:         []byte("<div>foo</div>"),
+			otherSrc:    []byte("<div><!--foo--></div>"),
+			expectEqual: false,
+		},
+		{
+			name:        "Values that run together",
+			src:         []byte(`<div class="ab" id="c"></div>`),
+			otherSrc:    []byte(`<div class="a" id="bc"></div>`),
+			expectEqual: false,
+		},
+		{
+			name:        "Attributes in a different order",
+			src:         []byte(`<div class="a" id="b"></div>`),
+			otherSrc:    []byte(`<div id="b" class="a"></div>`),
+			expectEqual: true,
+		},
+		{
+			name:        "Attribute names with different case",
+			src:         []byte(`<div class="a"></div>`),
+			otherSrc:    []byte(`<div CLASS="a"></div>`),
+			expectEqual: true,
+		},
+	}
+	for i, tc := range testCases {
+		tree, err := Parse(tc.src)
+		if err != nil {
+			t.Errorf("Unexpected error in Parse: %s", err.Error())
+		}
+		otherTree, err := Parse(tc.otherSrc)
+		if err != nil {
+			t.Errorf("Unexpected error in Parse: %s", err.Error())
+		}
+		el := tree.Children[0].(*Element)
+		otherEl := otherTree.Children[0].(*Element)
+		if gotEqual := el.Hash() == otherEl.Hash(); gotEqual != tc.expectEqual {
+			t.Errorf("Error in test case %d (%s): Expected hashes to be equal to be %v but got %v", i, tc.name, tc.expectEqual, gotEqual)
+		}
+		if gotSame := el.sameContents(otherEl); gotSame != tc.expectEqual {
+			t.Errorf("Error in test case %d (%s): Expected sameContents to be %v but got %v", i, tc.name, tc.expectEqual, gotSame)
+		}
+	}
+}
+
+func TestParseReader(t *testing.T) {
+	// Build a document which is much bigger than the chunks that are read at
+	// a time, with some long tags that span chunks.
+	buf := bytes.NewBuffer(nil)
+	buf.WriteString("<ul>")
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(buf, `<li class="item" data-long="%s"><input type="checkbox"><span>item %d</span><!-- %d --></li>`, bytes.Repeat([]byte("x"), i%700), i, i)
+	}
+	buf.WriteString("</ul>")
+	src := buf.Bytes()
+	expected, err := Parse(src)
+	if err != nil {
+		t.Fatalf("Unexpected error in Parse: %s", err.Error())
+	}
+	got, err := ParseReader(bytes.NewReader(src))
+	if err != nil {
+		t.Fatalf("Unexpected error in ParseReader: %s", err.Error())
+	}
+	if match, msg := expected.Compare(got, true); !match {
+		t.Errorf("ParseReader gave a different tree than Parse.\n%s", msg)
+	}
+	if string(got.HTML()) != string(expected.HTML()) {
+		t.Error("ParseReader gave a tree with different html than Parse")
+	}
+
+	// Errors from the reader should be returned.
+	errRead := fmt.Errorf("read failed")
+	if _, err := ParseReader(iotest.TimeoutReader(bytes.NewReader(src))); err != iotest.ErrTimeout {
+		t.Errorf("Expected error %v from the reader but got %v", iotest.ErrTimeout, err)
+	}
+	if _, err := ParseReader(&errReader{err: errRead}); err != errRead {
+		t.Errorf("Expected error %v from the reader but got %v", errRead, err)
+	}
+}
+
+// errReader is an io.Reader which always returns err.
+type errReader struct {
+	err error
+}
+
+func (r *errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+func TestIndexedByteReaderDiscard(t *testing.T) {
+	src := bytes.Repeat([]byte("0123456789"), 10000)
+	r := newIndexedByteReaderFrom(bytes.NewReader(src))
+	for i := 0; i < len(src); i++ {
+		c, err := r.ReadByte()
+		if err != nil {
+			t.Fatalf("Unexpected error in ReadByte: %s", err.Error())
+		}
+		if c != src[i] {
+			t.Fatalf("Expected byte %d to be %c but got %c", i, src[i], c)
+		}
+		// Searching backwards still works for the bytes which have not been
+		// discarded, and the byte before the current one is always kept.
+		if i >= 1 {
+			if j, err := r.BackwardsSearch(0, r.Offset()-1, src[i-1]); err != nil {
+				t.Fatalf("Unexpected error in BackwardsSearch: %s", err.Error())
+			} else if j != i-1 {
+				t.Fatalf("Expected BackwardsSearch to return %d but got %d", i-1, j)
+			}
+		}
+		r.discardBefore(r.Offset() - 1)
+		if len(r.buf) > 2*readChunkSize {
+			t.Fatalf("Expected bytes to be discarded, but the buffer has %d bytes", len(r.buf))
+		}
+	}
+	if _, err := r.ReadByte(); err != io.EOF {
+		t.Errorf("Expected io.EOF but got %v", err)
+	}
+}
+
+func TestPos(t *testing.T) {
+	pos := func(startOffset, startLine, startColumn, endOffset, endLine, endColumn int) Pos {
+		return Pos{
+			Start: Position{Offset: startOffset, Line: startLine, Column: startColumn},
+			End:   Position{Offset: endOffset, Line: endLine, Column: endColumn},
+		}
+	}
+	testCases := []struct {
+		name     string
+		src      string
+		index    []int
+		expected Pos
+	}{
+		{
+			name:     "element spanning lines",
+			src:      "<div>\n  <p>one</p>\n</div>",
+			index:    []int{0},
+			expected: pos(0, 1, 1, 25, 3, 7),
+		},
+		{
+			name:     "nested element",
+			src:      "<div>\n  <p>one</p>\n</div>",
+			index:    []int{0, 1},
+			expected: pos(8, 2, 3, 18, 2, 13),
+		},
+		{
+			name:     "text",
+			src:      "<div>\n  <p>one</p>\n</div>",
+			index:    []int{0, 1, 0},
+			expected: pos(11, 2, 6, 14, 2, 9),
+		},
+		{
+			name:     "whitespace text",
+			src:      "<div>\n  <p>one</p>\n</div>",
+			index:    []int{0, 2},
+			expected: pos(18, 2, 13, 19, 3, 1),
+		},
+		{
+			name:     "autoclosed element",
+			src:      "<div><br></div>",
+			index:    []int{0, 0},
+			expected: pos(5, 1, 6, 9, 1, 10),
+		},
+		{
+			name:     "text after autoclosed element",
+			src:      "<input disabled>\n<p></p>",
+			index:    []int{1},
+			expected: pos(16, 1, 17, 17, 2, 1),
+		},
+		{
+			name:     "element after autoclosed element",
+			src:      "<div><br><p>one</p></div>",
+			index:    []int{0, 1},
+			expected: pos(9, 1, 10, 19, 1, 20),
+		},
+		{
+			name:     "comment",
+			src:      "<div></div>\n<!-- c -->",
+			index:    []int{2},
+			expected: pos(12, 2, 1, 22, 2, 11),
+		},
+	}
+	for _, tc := range testCases {
+		for _, pf := range parseFuncs {
+			tree, err := pf.parse([]byte(tc.src))
+			if err != nil {
+				t.Errorf("%s: Unexpected error in %s: %s", tc.name, pf.name, err.Error())
+				continue
+			}
+			node := tree.nodeAt(tc.index)
+			if got := node.Pos(); got != tc.expected {
+				t.Errorf("%s: Pos was not correct with %s.\nExpected: %+v\nGot:      %+v", tc.name, pf.name, tc.expected, got)
+			}
+		}
+	}
+}
+
+func TestParseError(t *testing.T) {
+	testCases := []struct {
+		name     string
+		src      string
+		expected ParseError
+	}{
+		{
+			name: "wrong closing tag",
+			src:  "<div>\n  <p>one</span>\n</div>",
+			expected: ParseError{
+				Pos:     Position{Offset: 14, Line: 2, Column: 9},
+				Message: "unexpected end element </span>",
+				Snippet: "  <p>one</span>",
+			},
+		},
+		{
+			name: "wrong closing tag after autoclosed element",
+			src:  "<div>\n<br></span>\n</div>",
+			expected: ParseError{
+				Pos:     Position{Offset: 10, Line: 2, Column: 5},
+				Message: "unexpected end element </span>",
+				Snippet: "<br></span>",
+			},
+		},
+		{
+			name: "closing tag without opening tag",
+			src:  "<div></div>\n</p>",
+			expected: ParseError{
+				Pos:     Position{Offset: 12, Line: 2, Column: 1},
+				Message: "unexpected end element </p>",
+				Snippet: "</p>",
+			},
+		},
+		{
+			name: "unterminated attribute",
+			src:  "<ul>\n<li>\n <p a=\"b></p></li></ul>",
+			expected: ParseError{
+				Pos:     Position{Offset: 20, Line: 3, Column: 11},
+				Message: "unescaped < inside quoted string",
+				Snippet: ` <p a="b></p></li></ul>`,
+			},
+		},
+	}
+	for _, tc := range testCases {
+		for _, pf := range parseFuncs {
+			_, err := pf.parse([]byte(tc.src))
+			parseErr, ok := err.(*ParseError)
+			if !ok {
+				t.Errorf("%s: Expected a *ParseError from %s but got %#v", tc.name, pf.name, err)
+				continue
+			}
+			got := *parseErr
+			if pf.name == "ParseReader" && strings.HasPrefix(tc.expected.Snippet, got.Snippet) {
+				// The snippet only includes what was read before the error.
+				got.Snippet = tc.expected.Snippet
+			}
+			if got != tc.expected {
+				t.Errorf("%s: ParseError from %s was not correct.\nExpected: %#v\nGot:      %#v", tc.name, pf.name, tc.expected, *parseErr)
+			}
+		}
+	}
+}
+
+func TestParseRawText(t *testing.T) {
+	testCases := []struct {
+		name string
+		src  string
+		// expected is the value of the text node inside of the first child of
+		// the root div, or an empty string if there should be no text node.
+		expected string
+	}{
+		{
+			name:     "script with markup",
+			src:      `<div><script>if (a<b && c) { x = "</div>" }</script></div>`,
+			expected: `if (a<b && c) { x = "</div>" }`,
+		},
+		{
+			name:     "script with character references",
+			src:      `<div><script>x = "&lt;p&gt;"</script></div>`,
+			expected: `x = "&lt;p&gt;"`,
+		},
+		{
+			name:     "style",
+			src:      `<div><style>a > b { content: "<"; }</style></div>`,
+			expected: `a > b { content: "<"; }`,
+		},
+		{
+			name:     "textarea",
+			src:      `<div><textarea><b>bold</b> &amp;amp; <!-- not a comment --></textarea></div>`,
+			expected: `<b>bold</b> &amp; <!-- not a comment -->`,
+		},
+		{
+			name:     "title",
+			src:      `<div><title>a &lt; b</title></div>`,
+			expected: `a < b`,
+		},
+		{
+			name:     "closing tag with whitespace",
+			src:      "<div><script>1 < 2</script\n></div>",
+			expected: "1 < 2",
+		},
+		{
+			name:     "closing tag for a different element",
+			src:      `<div><style>p {}</styles></style></div>`,
+			expected: `p {}</styles>`,
+		},
+		{
+			name:     "empty",
+			src:      `<div><script></script></div>`,
+			expected: "",
+		},
+	}
+	for _, parseFunc := range parseFuncs {
+		for _, tc := range testCases {
+			tree, err := parseFunc.parse([]byte(tc.src))
+			if err != nil {
+				t.Errorf("%s with %s: Unexpected error: %s", tc.name, parseFunc.name, err.Error())
+				continue
+			}
+			el := tree.Children[0].Children()[0].(*Element)
+			if tc.expected == "" {
+				if len(el.Children()) != 0 {
+					t.Errorf("%s with %s: Expected no children but got %d", tc.name, parseFunc.name, len(el.Children()))
+				}
+				continue
+			}
+			if len(el.Children()) != 1 {
+				t.Errorf("%s with %s: Expected 1 child but got %d", tc.name, parseFunc.name, len(el.Children()))
+				continue
+			}
+			text, ok := el.Children()[0].(*Text)
+			if !ok {
+				t.Errorf("%s with %s: Expected a text node but got %T", tc.name, parseFunc.name, el.Children()[0])
+				continue
+			}
+			if string(text.Value) != tc.expected {
+				t.Errorf("%s with %s: Text was not correct.\nExpected: %s\nGot:      %s", tc.name, parseFunc.name, tc.expected, text.Value)
+			}
+			if el.autoClosed {
+				t.Errorf("%s with %s: Expected <%s> not to be autoclosed", tc.name, parseFunc.name, el.Name)
+			}
+		}
+	}
+}
+
+func TestPatchRawText(t *testing.T) {
+	// Creating a raw text element in the actual DOM should not change its
+	// contents.
+	tree, err := Parse([]byte("<div></div>"))
+	if err != nil {
+		t.Fatalf("Unexpected error in Parse: %s", err.Error())
+	}
+	root := newMemRoot("<div></div>")
+	src := `<div><script>x = "&lt;p&gt;" && a < b</script><textarea>&lt;b&gt;</textarea><p>&lt;i&gt;</p></div>`
+	newTree, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatalf("Unexpected error in Parse: %s", err.Error())
+	}
+	patches, err := Diff(tree, newTree)
+	if err != nil {
+		t.Fatalf("Unexpected error in Diff: %s", err.Error())
+	}
+	if err := patches.Patch(root); err != nil {
+		t.Fatalf("Unexpected error in Patch: %s", err.Error())
+	}
+	expected := []string{`x = "&lt;p&gt;" && a < b`, `<b>`, `<i>`}
+	for i, value := range expected {
+		children := memNodeAt(root, 0, i).children
+		if len(children) != 1 || children[0].nodeType != textNode {
+			t.Errorf("Expected child %d to have a single text node", i)
+		} else if children[0].value != value {
+			t.Errorf("Expected text of child %d to be %q but got %q", i, value, children[0].value)
+		}
+	}
+}
+
+func TestParseDocument(t *testing.T) {
+	src := `<!DOCTYPE html>
+<html><head><title>Page</title></head><body><svg><style><![CDATA[a > b {}]]></style></svg><p><![CDATA[x]]></p></body></html>`
+	for _, parseFunc := range parseFuncs {
+		tree, err := parseFunc.parse([]byte(src))
+		if err != nil {
+			t.Errorf("%s: Unexpected error: %s", parseFunc.name, err.Error())
+			continue
+		}
+		if len(tree.Children) != 3 {
+			t.Errorf("%s: Expected 3 children but got %d", parseFunc.name, len(tree.Children))
+			continue
+		}
+		doctype, ok := tree.Children[0].(*Doctype)
+		if !ok {
+			t.Errorf("%s: Expected first child to be a doctype but got %T", parseFunc.name, tree.Children[0])
+		} else if match, msg := doctype.Compare(&Doctype{Name: "html"}); !match {
+			t.Errorf("%s: %s", parseFunc.name, msg)
+		}
+		body := tree.Children[2].Children()[1]
+		// Inside of svg, a CDATA section is kept as is.
+		style := body.Children()[0].Children()[0]
+		if cdata, ok := style.Children()[0].(*CDATA); !ok {
+			t.Errorf("%s: Expected a CDATA section inside of svg but got %T", parseFunc.name, style.Children()[0])
+		} else if string(cdata.Value) != "a > b {}" {
+			t.Errorf("%s: Expected CDATA to be %q but got %q", parseFunc.name, "a > b {}", cdata.Value)
+		}
+		// Inside of html, the browser treats it as a comment.
+		p := body.Children()[1]
+		if comment, ok := p.Children()[0].(*Comment); !ok {
+			t.Errorf("%s: Expected a comment inside of html but got %T", parseFunc.name, p.Children()[0])
+		} else if string(comment.Value) != "[CDATA[x]]" {
+			t.Errorf("%s: Expected comment to be %q but got %q", parseFunc.name, "[CDATA[x]]", comment.Value)
+		}
+		expectedHTML := src
+		if parseFunc.name == "ParseReader" {
+			// The html is built from the nodes, so the CDATA section in the p is
+			// written as the comment that it became.
+			expectedHTML = strings.Replace(src, "<![CDATA[x]]>", "<!--[CDATA[x]]-->", 1)
+		}
+		if got := string(tree.HTML()); got != expectedHTML {
+			t.Errorf("%s: HTML was not correct.\nExpected: %s\nGot:      %s", parseFunc.name, expectedHTML, got)
+		}
+	}
+}
+
+func TestParseDoctype(t *testing.T) {
+	testCases := []struct {
+		src      string
+		expected *Doctype
+	}{
+		{
+			src:      `<!doctype HTML>`,
+			expected: &Doctype{Name: "html"},
+		},
+		{
+			src: `<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Strict//EN" "http://www.w3.org/TR/xhtml1/DTD/xhtml1-strict.dtd">`,
+			expected: &Doctype{
+				Name:     "html",
+				PublicID: "-//W3C//DTD XHTML 1.0 Strict//EN",
+				SystemID: "http://www.w3.org/TR/xhtml1/DTD/xhtml1-strict.dtd",
+			},
+		},
+		{
+			src:      `<!DOCTYPE svg SYSTEM 'about:legacy-compat'>`,
+			expected: &Doctype{Name: "svg", SystemID: "about:legacy-compat"},
+		},
+	}
+	for _, tc := range testCases {
+		tree, err := Parse([]byte(tc.src))
+		if err != nil {
+			t.Errorf("Unexpected error parsing %s: %s", tc.src, err.Error())
+			continue
+		}
+		expectedTree := &Tree{Children: []Node{tc.expected}}
+		if match, msg := expectedTree.Compare(tree, true); !match {
+			t.Errorf("Tree for %s was not correct.\n%s", tc.src, msg)
+		}
+	}
+}
+
+func TestParseBogusComments(t *testing.T) {
+	// Processing instructions and directives other than doctypes are not
+	// allowed in html, so the browser treats them as comments.
+	tree, err := Parse([]byte(`<?xml version="1.0"?><div><!ELEMENT br EMPTY><!DOCTYPE html></div>`))
+	if err != nil {
+		t.Fatalf("Unexpected error in Parse: %s", err.Error())
+	}
+	expectedTree := &Tree{
+		Children: []Node{
+			&Comment{Value: []byte(`?xml version="1.0"?`)},
+			&Element{
+				Name: "div",
+				children: []Node{
+					// The doctype inside of the div is ignored.
+					&Comment{Value: []byte("ELEMENT br EMPTY")},
+				},
+			},
+		},
+	}
+	if match, msg := expectedTree.Compare(tree, true); !match {
+		t.Errorf("Tree was not correct.\n%s", msg)
+	}
+}
+
+func TestPatchCDATA(t *testing.T) {
+	tree, err := Parse([]byte("<svg><style><![CDATA[a {}]]></style></svg>"))
+	if err != nil {
+		t.Fatalf("Unexpected error in Parse: %s", err.Error())
+	}
+	root := newMemRoot("<svg><style><![CDATA[a {}]]></style></svg>")
+	newTree, err := Parse([]byte("<svg><style><![CDATA[a > b {}]]></style></svg>"))
+	if err != nil {
+		t.Fatalf("Unexpected error in Parse: %s", err.Error())
+	}
+	patches, err := Diff(tree, newTree)
+	if err != nil {
+		t.Fatalf("Unexpected error in Diff: %s", err.Error())
+	}
+	if err := patches.Patch(root); err != nil {
+		t.Fatalf("Unexpected error in Patch: %s", err.Error())
+	}
+	// The actual DOM has a text node instead of a CDATA section.
+	text := memNodeAt(root, 0, 0, 0)
+	if text.nodeType != textNode || text.value != "a > b {}" {
+		t.Errorf("Expected a text node with value %q but got node of type %d with value %q", "a > b {}", text.nodeType, text.value)
+	}
+}
+
+func TestParseVoidElementAtEnd(t *testing.T) {
+	for _, parseFunc := range parseFuncs {
+		tree, err := parseFunc.parse([]byte(`<p>one</p><meta name="description" content="two">`))
+		if err != nil {
+			t.Errorf("%s: Unexpected error: %s", parseFunc.name, err.Error())
+			continue
+		}
+		expectedTree := &Tree{
+			Children: []Node{
+				&Element{
+					Name: "p",
+					children: []Node{
+						&Text{Value: []byte("one")},
+					},
+				},
+				&Element{
+					Name: "meta",
+					Attrs: []Attr{
+						{Name: "name", Value: "description"},
+						{Name: "content", Value: "two"},
+					},
+				},
+			},
+		}
+		if match, msg := expectedTree.Compare(tree, true); !match {
+			t.Errorf("%s: Tree was not correct.\n%s", parseFunc.name, msg)
+		}
+		if got := string(tree.Children[1].HTML()); got != `<meta name="description" content="two">` {
+			t.Errorf("%s: HTML was not correct. Got %s", parseFunc.name, got)
+		}
+		// An element which is not void is still an error.
+		if _, err := parseFunc.parse([]byte(`<div><br>`)); err == nil {
+			t.Errorf("%s: Expected an error for an unclosed div but got none", parseFunc.name)
+		}
+	}
+}
+
+func TestParseAttrNormalization(t *testing.T) {
+	for _, parseFunc := range parseFuncs {
+		tree, err := parseFunc.parse([]byte(`<div CLASS="a" Id="b" class="c"><svg viewBox="0 0 1 1"></svg></div>`))
+		if err != nil {
+			t.Errorf("%s: Unexpected error: %s", parseFunc.name, err.Error())
+			continue
+		}
+		div := tree.Children[0].(*Element)
+		// Just like the browser, html attribute names are lowercased and the
+		// first duplicate wins.
+		expectedAttrs := []Attr{
+			{Name: "class", Value: "a"},
+			{Name: "id", Value: "b"},
+		}
+		if !reflect.DeepEqual(div.Attrs, expectedAttrs) {
+			t.Errorf("%s: Expected attrs to be %v but got %v", parseFunc.name, expectedAttrs, div.Attrs)
+		}
+		// Attribute names in svg are case sensitive.
+		svg := div.Children()[0].(*Element)
+		if _, found := svg.AttrMap()["viewBox"]; !found {
+			t.Errorf("%s: Expected svg to have a viewBox attr but got %v", parseFunc.name, svg.Attrs)
+		}
+	}
+}
+
+func TestCompareAttrs(t *testing.T) {
+	testCases := []struct {
+		name        string
+		attrs       []Attr
+		otherAttrs  []Attr
+		expectMatch bool
+	}{
+		{
+			name:        "Different order",
+			attrs:       []Attr{{Name: "class", Value: "a"}, {Name: "id", Value: "b"}},
+			otherAttrs:  []Attr{{Name: "id", Value: "b"}, {Name: "class", Value: "a"}},
+			expectMatch: true,
+		},
+		{
+			name:        "Different case",
+			attrs:       []Attr{{Name: "CLASS", Value: "a"}},
+			otherAttrs:  []Attr{{Name: "class", Value: "a"}},
+			expectMatch: true,
+		},
+		{
+			name:        "First duplicate wins",
+			attrs:       []Attr{{Name: "id", Value: "a"}, {Name: "id", Value: "b"}},
+			otherAttrs:  []Attr{{Name: "id", Value: "a"}},
+			expectMatch: true,
+		},
+		{
+			name:        "Different values",
+			attrs:       []Attr{{Name: "class", Value: "a"}, {Name: "id", Value: "b"}},
+			otherAttrs:  []Attr{{Name: "id", Value: "c"}, {Name: "class", Value: "a"}},
+			expectMatch: false,
+		},
+		{
+			name:        "Different names",
+			attrs:       []Attr{{Name: "class", Value: "a"}},
+			otherAttrs:  []Attr{{Name: "id", Value: "a"}},
+			expectMatch: false,
+		},
+	}
+	for _, tc := range testCases {
+		el := &Element{Name: "div", Attrs: tc.attrs}
+		other := &Element{Name: "div", Attrs: tc.otherAttrs}
+		if match, msg := el.Compare(other, true); match != tc.expectMatch {
+			t.Errorf("%s: Expected match to be %v but got %v %s", tc.name, tc.expectMatch, match, msg)
+		}
+		if match, msg := CompareNodes(el, other, true); match != tc.expectMatch {
+			t.Errorf("%s: Expected CompareNodes match to be %v but got %v %s", tc.name, tc.expectMatch, match, msg)
+		}
+		if gotEqual := el.Hash() == other.Hash(); gotEqual != tc.expectMatch {
+			t.Errorf("%s: Expected hashes to be equal to be %v but got %v", tc.name, tc.expectMatch, gotEqual)
+		}
+	}
+	// Attribute names in svg are case sensitive.
+	el := &Element{Name: "svg", Namespace: SVGNamespace, Attrs: []Attr{{Name: "viewBox", Value: "0 0 1 1"}}}
+	other := &Element{Name: "svg", Namespace: SVGNamespace, Attrs: []Attr{{Name: "viewbox", Value: "0 0 1 1"}}}
+	if match, _ := el.Compare(other, true); match {
+		t.Error("Expected svg attribute names to be compared case sensitively")
+	}
+}
+
+func TestParseBooleanAttrs(t *testing.T) {
+	for _, parseFunc := range parseFuncs {
+		tree, err := parseFunc.parse([]byte(`<div><input type="checkbox" checked><input checked="checked" disabled=""><option selected="yes"></option></div>`))
+		if err != nil {
+			t.Errorf("%s: Unexpected error: %s", parseFunc.name, err.Error())
+			continue
+		}
+		div := tree.Children[0].(*Element)
+		expectedTree := &Tree{
+			Children: []Node{
+				&Element{
+					Name: "div",
+					children: []Node{
+						&Element{
+							Name:  "input",
+							Attrs: []Attr{{Name: "type", Value: "checkbox"}, {Name: "checked", Value: ""}},
+						},
+						&Element{
+							Name:  "input",
+							Attrs: []Attr{{Name: "checked", Value: ""}, {Name: "disabled", Value: ""}},
+						},
+						&Element{
+							Name:  "option",
+							Attrs: []Attr{{Name: "selected", Value: "yes"}},
+						},
+					},
+				},
+			},
+		}
+		if match, msg := expectedTree.Compare(tree, true); !match {
+			t.Errorf("%s: Tree was not correct.\n%s", parseFunc.name, msg)
+		}
+		if value := div.Children()[0].(*Element).AttrMap()["checked"]; value != "" {
+			t.Errorf("%s: Expected checked to have an empty value but got %q", parseFunc.name, value)
+		}
+		// Boolean attributes are written without a value.
+		expectedHTML := `<input type="checkbox" checked>`
+		if got := string(div.Children()[0].HTML()); got != expectedHTML {
+			t.Errorf("%s: HTML was not correct.\nExpected: %s\nGot:      %s", parseFunc.name, expectedHTML, got)
+		}
+		buf := bytes.NewBuffer(nil)
+		if err := tree.WriteHTML(buf); err != nil {
+			t.Errorf("%s: Unexpected error in WriteHTML: %s", parseFunc.name, err.Error())
+		}
+		expectedHTML = `<div><input type="checkbox" checked><input checked disabled><option selected></option></div>`
+		if got := buf.String(); got != expectedHTML {
+			t.Errorf("%s: WriteHTML was not correct.\nExpected: %s\nGot:      %s", parseFunc.name, expectedHTML, got)
+		}
+	}
+}
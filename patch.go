@@ -2,6 +2,8 @@ package vdom
 
 import (
 	"fmt"
+	"strings"
+
 	"github.com/gopherjs/gopherjs/js"
 	"honnef.co/go/js/dom"
 )
@@ -63,7 +65,38 @@ func (p *Append) Patch(root dom.Element) error {
 	// fmt.Println("Created child: ", child)
 	parent.AppendChild(child)
 	// fmt.Println("Successfully appended")
-	return nil
+	return listenForSubtree(root, p.Child)
+}
+
+// Insert is a Patcher which will insert a child Node into a parent Node at
+// the position given by the last number in the child's index, i.e. before
+// the sibling which is currently at that position. If Parent is nil, the
+// child is inserted into the root. Unlike Remove, Insert does not update the
+// indexes of any siblings, so Child should come from the new tree, and
+// several Insert patches for the same parent should be in order of
+// increasing index.
+type Insert struct {
+	Child  Node
+	Parent *Element
+}
+
+// Patch satisfies the Patcher interface and applies the change to the
+// actual DOM.
+func (p *Insert) Patch(root dom.Element) error {
+	var parent dom.Node
+	if p.Parent != nil {
+		parent = findInDOM(p.Parent, root)
+	} else {
+		parent = root
+	}
+	child := createForDOM(p.Child)
+	index := p.Child.Index()
+	if siblings := parent.ChildNodes(); index[len(index)-1] < len(siblings) {
+		parent.InsertBefore(child, siblings[index[len(index)-1]])
+	} else {
+		parent.AppendChild(child)
+	}
+	return listenForSubtree(root, p.Child)
 }
 
 // Replace is a Patcher will will replace an old Node with a new Node.
@@ -84,7 +117,7 @@ func (p *Replace) Patch(root dom.Element) error {
 	oldChild := findInDOM(p.Old, root)
 	newChild := createForDOM(p.New)
 	parent.ReplaceChild(newChild, oldChild)
-	return nil
+	return listenForSubtree(root, p.New)
 }
 
 // Remove is a Patcher which will remove the given Node.
@@ -116,6 +149,10 @@ func (p *Remove) Patch(root dom.Element) error {
 				t.index[len(t.index)-1] = t.index[len(t.index)-1] - 1
 			case *Comment:
 				t.index[len(t.index)-1] = t.index[len(t.index)-1] - 1
+			case *Doctype:
+				t.index[len(t.index)-1] = t.index[len(t.index)-1] - 1
+			case *CDATA:
+				t.index[len(t.index)-1] = t.index[len(t.index)-1] - 1
 			default:
 				panic("unreachable")
 			}
@@ -125,6 +162,80 @@ func (p *Remove) Patch(root dom.Element) error {
 	return nil
 }
 
+// RemoveRange is a Patcher which will remove a run of consecutive
+// sibling Nodes. It has the same effect as a Remove for each of the
+// Nodes, but only needs to find their parent in the actual DOM once.
+type RemoveRange struct {
+	Nodes []Node
+}
+
+// Patch satisfies the Patcher interface and applies the change to the
+// actual DOM.
+func (p *RemoveRange) Patch(root dom.Element) error {
+	if len(p.Nodes) == 0 {
+		return nil
+	}
+	first := p.Nodes[0]
+	var parent dom.Node
+	if first.Parent() != nil {
+		parent = findInDOM(first.Parent(), root)
+	} else {
+		parent = root
+	}
+	// Every node in the range is at the same index in the actual DOM by the
+	// time we get to it, because the ones before it have been removed.
+	start := first.Index()[len(first.Index())-1]
+	for range p.Nodes {
+		parent.RemoveChild(parent.ChildNodes()[start])
+	}
+
+	// All the siblings that come after the range have moved back by the
+	// number of nodes that were removed.
+	if first.Parent() != nil {
+		siblings := first.Parent().Children()
+		last := p.Nodes[len(p.Nodes)-1]
+		for i, sibling := range siblings {
+			if sibling != last {
+				continue
+			}
+			for _, after := range siblings[i+1:] {
+				index := after.Index()
+				index[len(index)-1] -= len(p.Nodes)
+			}
+			break
+		}
+	}
+
+	return nil
+}
+
+// ReplaceChildren is a Patcher which will replace all the children of
+// Parent with Children. If Parent is nil, it replaces all the children of
+// the root. It does this by setting the inner html, which is faster than
+// patching the children one by one when most of them have changed.
+type ReplaceChildren struct {
+	Parent   *Element
+	Children []Node
+}
+
+// Patch satisfies the Patcher interface and applies the change to the
+// actual DOM.
+func (p *ReplaceChildren) Patch(root dom.Element) error {
+	var parent dom.Element
+	if p.Parent != nil {
+		parent = findInDOM(p.Parent, root).(dom.Element)
+	} else {
+		parent = root
+	}
+	parent.SetInnerHTML(htmlForDOM(p.Parent, p.Children))
+	for _, child := range p.Children {
+		if err := listenForSubtree(root, child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // SettAttr is a Patcher which will set the attribute of the given Node to
 // the given Attr. It will overwrite any previous values for the given Attr.
 type SetAttr struct {
@@ -136,7 +247,7 @@ type SetAttr struct {
 // actual DOM.
 func (p *SetAttr) Patch(root dom.Element) error {
 	self := findInDOM(p.Node, root).(dom.Element)
-	self.SetAttribute(p.Attr.Name, p.Attr.Value)
+	setAttribute(self, nodeNamespace(p.Node), p.Attr.Name, p.Attr.Value)
 	return nil
 }
 
@@ -151,10 +262,141 @@ type RemoveAttr struct {
 // actual DOM.
 func (p *RemoveAttr) Patch(root dom.Element) error {
 	self := findInDOM(p.Node, root).(dom.Element)
-	self.RemoveAttribute(p.AttrName)
+	removeAttribute(self, nodeNamespace(p.Node), p.AttrName)
+	return nil
+}
+
+// nodeNamespace returns the namespace of node if it is an Element, or an
+// empty string otherwise.
+func nodeNamespace(node Node) string {
+	if el, ok := node.(*Element); ok {
+		return el.Namespace
+	}
+	return ""
+}
+
+// setAttribute sets the attribute with the given name on el, which is an
+// element in the given namespace. Attributes with a namespace, e.g.
+// xlink:href on an svg element, are set with setAttributeNS so that the
+// browser understands them.
+func setAttribute(el dom.Element, elNamespace, name, value string) {
+	if namespace := attrNamespace(elNamespace, name); namespace != "" {
+		el.SetAttributeNS(namespace, name, value)
+		return
+	}
+	el.SetAttribute(name, value)
+}
+
+// removeAttribute removes the attribute with the given name from el, which
+// is an element in the given namespace.
+func removeAttribute(el dom.Element, elNamespace, name string) {
+	if namespace := attrNamespace(elNamespace, name); namespace != "" {
+		// removeAttributeNS expects the local name, without the prefix.
+		el.RemoveAttributeNS(namespace, name[strings.Index(name, ":")+1:])
+		return
+	}
+	el.RemoveAttribute(name)
+}
+
+// SetText is a Patcher which will change the value of the given Text node
+// in place. Unlike Replace, it keeps the same node in the actual DOM, so
+// things like the current text selection are preserved.
+type SetText struct {
+	Node  *Text
+	Value []byte
+}
+
+// Patch satisfies the Patcher interface and applies the change to the
+// actual DOM.
+func (p *SetText) Patch(root dom.Element) error {
+	self := findInDOM(p.Node, root)
+	self.SetNodeValue(string(p.Value))
+	return nil
+}
+
+// SetComment is a Patcher which will change the value of the given Comment
+// node in place.
+type SetComment struct {
+	Node  *Comment
+	Value []byte
+}
+
+// Patch satisfies the Patcher interface and applies the change to the
+// actual DOM.
+func (p *SetComment) Patch(root dom.Element) error {
+	self := findInDOM(p.Node, root)
+	self.SetNodeValue(string(p.Value))
+	return nil
+}
+
+// SetProperty is a Patcher which will set a property of the given Node in
+// the actual DOM. For some elements, a property holds the current state, e.g.
+// the value of an input after the user has typed into it. Changing the
+// corresponding attribute does not affect what the user sees, so Diff adds
+// a SetProperty along with the SetAttr or RemoveAttr for those attributes.
+type SetProperty struct {
+	Node  Node
+	Name  string
+	Value interface{}
+}
+
+// Patch satisfies the Patcher interface and applies the change to the
+// actual DOM.
+func (p *SetProperty) Patch(root dom.Element) error {
+	self := findInDOM(p.Node, root)
+	setProperty(self, p.Name, p.Value)
+	return nil
+}
+
+// SetListener is a Patcher which will add a Listener to the given Element.
+// Since the actual DOM only has listeners on the root (see Dispatcher), this
+// just makes sure that the Dispatcher for the root is listening for events
+// of the right type. It returns an error if there is no Dispatcher.
+type SetListener struct {
+	Node     *Element
+	Listener Listener
+}
+
+// Patch satisfies the Patcher interface and applies the change to the
+// actual DOM.
+func (p *SetListener) Patch(root dom.Element) error {
+	d, found := dispatchers[dispatcherKey(root)]
+	if !found {
+		return fmt.Errorf("vdom: cannot add a listener for %s events because there is no Dispatcher for the root. Use NewDispatcher to create one.", p.Listener.Type)
+	}
+	d.listen(p.Listener.Type)
+	return nil
+}
+
+// RemoveListener is a Patcher which will remove all the Listeners of the
+// given type from the given Element. The actual DOM does not need to change,
+// since the Dispatcher will no longer find a Listener in the new tree.
+type RemoveListener struct {
+	Node *Element
+	Type string
+}
+
+// Patch satisfies the Patcher interface and applies the change to the
+// actual DOM.
+func (p *RemoveListener) Patch(root dom.Element) error {
 	return nil
 }
 
+// setProperty sets a property of a node in the actual DOM. It is a variable
+// so that it can be swapped out for an in-memory implementation when running
+// pure go tests.
+var setProperty = func(node dom.Node, name string, value interface{}) {
+	node.Underlying().Set(name, value)
+}
+
+// callNodeMethod calls a method of an object which is a property of a node in
+// the actual DOM, e.g. node.classList.add(class). It is a variable so that it
+// can be swapped out for an in-memory implementation when running pure go
+// tests.
+var callNodeMethod = func(node dom.Node, object string, method string, args ...interface{}) {
+	node.Underlying().Get(object).Call(method, args...)
+}
+
 // findInDOM finds the node in the actual DOM corresponding
 // to the given virtual node, using the given root as a relative
 // starting point.
@@ -166,26 +408,86 @@ func findInDOM(node Node, root dom.Element) dom.Node {
 	return el
 }
 
+// nodeCreator creates new nodes which can be inserted into the
+// actual DOM.
+type nodeCreator interface {
+	CreateElement(name string) dom.Element
+	CreateElementNS(namespace, name string) dom.Element
+	CreateTextNode(value string) dom.Node
+	CreateComment(value string) dom.Node
+	CreateDoctype(name, publicID, systemID string) dom.Node
+}
+
+// creator is the nodeCreator used by createForDOM. It uses the
+// document from the browser, but can be swapped out for an in-memory
+// implementation when running pure go tests.
+var creator nodeCreator = documentCreator{}
+
+// documentCreator is a nodeCreator which creates nodes with document.
+type documentCreator struct{}
+
+func (documentCreator) CreateElement(name string) dom.Element {
+	return document.CreateElement(name)
+}
+
+func (documentCreator) CreateElementNS(namespace, name string) dom.Element {
+	return document.CreateElementNS(namespace, name)
+}
+
+func (documentCreator) CreateTextNode(value string) dom.Node {
+	return document.CreateTextNode(value)
+}
+
+func (documentCreator) CreateComment(value string) dom.Node {
+	return dom.WrapNode(document.Underlying().Call("createComment", value))
+}
+
+func (documentCreator) CreateDoctype(name, publicID, systemID string) dom.Node {
+	return dom.WrapNode(document.Underlying().Get("implementation").Call("createDocumentType", name, publicID, systemID))
+}
+
 // createForDOM creates a real node corresponding to the given
 // virtual node. It does not insert it into the actual DOM.
 func createForDOM(node Node) dom.Node {
 	switch node.(type) {
 	case *Element:
 		vEl := node.(*Element)
-		el := document.CreateElement(vEl.Name)
+		var el dom.Element
+		if vEl.Namespace != "" {
+			// An svg or mathml element needs to be created with its namespace.
+			// Otherwise the browser creates an unknown html element which is
+			// not rendered.
+			el = creator.CreateElementNS(vEl.Namespace, vEl.Name)
+		} else {
+			el = creator.CreateElement(vEl.Name)
+		}
 		for _, attr := range vEl.Attrs {
-			el.SetAttribute(attr.Name, attr.Value)
+			setAttribute(el, vEl.Namespace, attr.Name, attr.Value)
+		}
+		// The browser parses the inner html in the context of el, so the
+		// children of an svg or mathml element get the right namespace too.
+		// The html is escaped so that text which looks like html (or the
+		// contents of a script) stays exactly the same.
+		if !vEl.autoClosed {
+			el.SetInnerHTML(htmlForDOM(vEl, vEl.children))
 		}
-		el.SetInnerHTML(string(vEl.InnerHTML()))
 		return el
 	case *Text:
 		vText := node.(*Text)
-		textNode := document.CreateTextNode(string(vText.Value))
-		return textNode
+		return creator.CreateTextNode(string(vText.Value))
 	case *Comment:
 		vComment := node.(*Comment)
-		commentNode := document.Underlying().Call("createComment", string(vComment.Value))
-		return dom.WrapNode(commentNode)
+		return creator.CreateComment(string(vComment.Value))
+	case *Doctype:
+		// NOTE: The actual DOM only allows a doctype as a child of the document
+		// itself, so inserting it anywhere else will fail.
+		vDoctype := node.(*Doctype)
+		return creator.CreateDoctype(vDoctype.Name, vDoctype.PublicID, vDoctype.SystemID)
+	case *CDATA:
+		// html documents don't have CDATA sections, so the browser would
+		// create a text node if it parsed one.
+		vCDATA := node.(*CDATA)
+		return creator.CreateTextNode(string(vCDATA.Value))
 	default:
 		msg := fmt.Sprintf("Don't know how to create node for type %T", node)
 		panic(msg)
@@ -0,0 +1,110 @@
+package vdom
+
+import (
+	"fmt"
+	"strings"
+)
+
+// propertyAttrs maps element names to the attributes which are reflected by
+// a property holding the current state of the element. Once the user has
+// interacted with one of these elements (e.g. by typing into an input),
+// changing the attribute no longer changes what they see, so the property
+// needs to be set as well. The indeterminate property of a checkbox is not
+// included, since it has no attribute. Use a SetProperty with a bool value
+// to set it instead.
+var propertyAttrs = map[string][]string{
+	"audio":  {"muted"},
+	"input":  {"value", "checked"},
+	"option": {"value", "selected"},
+	"video":  {"muted"},
+}
+
+// booleanAttrs is the set of html attributes which are true iff they are
+// present, no matter what their value is. So <input checked>,
+// <input checked=""> and <input checked="checked"> are all the same.
+// hidden is not included, since hidden="until-found" means something
+// different from hidden.
+var booleanAttrs = map[string]bool{
+	"allowfullscreen": true,
+	"async":           true,
+	"autofocus":       true,
+	"autoplay":        true,
+	"checked":         true,
+	"controls":        true,
+	"default":         true,
+	"defer":           true,
+	"disabled":        true,
+	"formnovalidate":  true,
+	"inert":           true,
+	"ismap":           true,
+	"itemscope":       true,
+	"loop":            true,
+	"multiple":        true,
+	"muted":           true,
+	"nomodule":        true,
+	"novalidate":      true,
+	"open":            true,
+	"playsinline":     true,
+	"readonly":        true,
+	"required":        true,
+	"reversed":        true,
+	"selected":        true,
+}
+
+// isBooleanAttr returns true iff the attribute with the given name is a
+// boolean attribute for an element in the given namespace. Only html
+// elements have boolean attributes.
+func isBooleanAttr(namespace string, name string) bool {
+	return namespace == "" && booleanAttrs[strings.ToLower(name)]
+}
+
+// attrValuesEqual returns true iff value and otherValue mean the same thing
+// for the attribute with the given name on an element in the given
+// namespace. The values of boolean attributes do not matter.
+func attrValuesEqual(namespace string, name string, value string, otherValue string) bool {
+	return value == otherValue || isBooleanAttr(namespace, name)
+}
+
+// attrHTML returns the html for attr, including a leading space. Boolean
+// attributes are written without a value. The value is not escaped.
+func attrHTML(namespace string, attr Attr) string {
+	if isBooleanAttr(namespace, attr.Name) {
+		return " " + attr.Name
+	}
+	return fmt.Sprintf(` %s="%s"`, attr.Name, attr.Value)
+}
+
+// isPropertyAttr returns true iff the attribute with the given name is
+// reflected by a property of el which holds its current state.
+func isPropertyAttr(el *Element, name string) bool {
+	for _, propertyName := range propertyAttrs[el.Name] {
+		if name == propertyName {
+			return true
+		}
+	}
+	return false
+}
+
+// propertyValue returns the value that the property with the given name
+// should have if the corresponding attribute has the given value. found
+// should be false if the attribute is not present. The value property is a
+// string, and the rest are booleans which are true iff the attribute is
+// present.
+func propertyValue(name string, value string, found bool) interface{} {
+	if name == "value" {
+		return value
+	}
+	return found
+}
+
+// textContent returns the concatenated values of all the text nodes which
+// are direct children of el.
+func textContent(el *Element) string {
+	content := ""
+	for _, child := range el.Children() {
+		if text, ok := child.(*Text); ok {
+			content += string(text.Value)
+		}
+	}
+	return content
+}
@@ -0,0 +1,199 @@
+package vdom
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// DifferenceKind is the kind of a Difference in a DiffReport.
+type DifferenceKind string
+
+const (
+	// NodeAdded means there is a node in the other tree which is not in the
+	// first tree.
+	NodeAdded DifferenceKind = "added"
+	// NodeRemoved means there is a node in the first tree which is not in the
+	// other tree.
+	NodeRemoved DifferenceKind = "removed"
+	// NodeChanged means the nodes have different types, or are elements with
+	// different names or namespaces, or have different values. The children
+	// of nodes which changed are not compared.
+	NodeChanged DifferenceKind = "changed"
+	// AttrAdded means the element in the other tree has an attribute which
+	// the element in the first tree does not.
+	AttrAdded DifferenceKind = "attr-added"
+	// AttrRemoved means the element in the first tree has an attribute which
+	// the element in the other tree does not.
+	AttrRemoved DifferenceKind = "attr-removed"
+	// AttrChanged means the attribute has different values.
+	AttrChanged DifferenceKind = "attr-changed"
+)
+
+// Difference is a single difference between two trees.
+type Difference struct {
+	Kind DifferenceKind `json:"kind"`
+	// Index is the index of the node in the first tree, or in the other tree
+	// if the node was added. See Node.Index.
+	Index []int `json:"index"`
+	// Node is the kind of node, i.e. element, text, comment, doctype, or
+	// cdata. If the kind of node changed, it is the kind of node in the first
+	// tree.
+	Node string `json:"node"`
+	// Attr is the name of the attribute for the attr-added, attr-removed,
+	// and attr-changed kinds.
+	Attr string `json:"attr,omitempty"`
+	// Before and After are the html of the node in the first tree and in the
+	// other tree, or the values of the attribute. Before is empty if the node
+	// or attribute was added, and After is empty if it was removed.
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// DiffReport lists every difference between two trees. Unlike Tree.Compare,
+// which stops at the first difference, it keeps going, so it is useful for
+// test failures and for debugging what changed between two renders.
+type DiffReport struct {
+	Differences []Difference `json:"differences"`
+}
+
+// NewDiffReport returns a report of every difference between t and other.
+// Nodes are matched up by their position, the same way Diff matches them,
+// and attributes are compared the same way as Element.Compare. Event
+// listeners are not compared.
+func NewDiffReport(t, other *Tree) *DiffReport {
+	report := &DiffReport{Differences: []Difference{}}
+	report.addChildren([]int{}, t.Children, other.Children)
+	return report
+}
+
+// Empty returns true iff the trees did not have any differences.
+func (r *DiffReport) Empty() bool {
+	return len(r.Differences) == 0
+}
+
+// String returns the differences in a format similar to a unified diff. Each
+// difference has a header line with the index, kind, and node, followed by
+// the lines which were removed (starting with "-") and added (starting with
+// "+"). It returns an empty string if there are no differences.
+func (r *DiffReport) String() string {
+	buf := bytes.NewBuffer(nil)
+	for _, diff := range r.Differences {
+		fmt.Fprintf(buf, "@@ %v %s %s", diff.Index, diff.Kind, diff.Node)
+		if diff.Attr != "" {
+			fmt.Fprintf(buf, " %s", diff.Attr)
+		}
+		buf.WriteString(" @@\n")
+		if diff.Kind != NodeAdded && diff.Kind != AttrAdded {
+			writePrefixedLines(buf, "-", diff.Before)
+		}
+		if diff.Kind != NodeRemoved && diff.Kind != AttrRemoved {
+			writePrefixedLines(buf, "+", diff.After)
+		}
+	}
+	return buf.String()
+}
+
+// JSON returns the report encoded as indented JSON.
+func (r *DiffReport) JSON() ([]byte, error) {
+	return json.MarshalIndent(r, "", "\t")
+}
+
+// writePrefixedLines writes each line of s to buf with the given prefix.
+func writePrefixedLines(buf *bytes.Buffer, prefix string, s string) {
+	for _, line := range strings.Split(s, "\n") {
+		buf.WriteString(prefix + line + "\n")
+	}
+}
+
+// addChildren adds the differences between nodes and otherNodes, which are
+// the children of the node at the given index in each tree.
+func (r *DiffReport) addChildren(index []int, nodes, otherNodes []Node) {
+	for i := 0; i < len(nodes) || i < len(otherNodes); i++ {
+		switch {
+		case i >= len(otherNodes):
+			r.add(NodeRemoved, childIndex(index, i), nodes[i], "", string(nodes[i].HTML()), "")
+		case i >= len(nodes):
+			r.add(NodeAdded, childIndex(index, i), otherNodes[i], "", "", string(otherNodes[i].HTML()))
+		default:
+			r.addNode(childIndex(index, i), nodes[i], otherNodes[i])
+		}
+	}
+}
+
+// addNode adds the differences between node and otherNode, including any
+// differences between their attributes and children.
+func (r *DiffReport) addNode(index []int, node, otherNode Node) {
+	el, isElement := node.(*Element)
+	otherEl, otherIsElement := otherNode.(*Element)
+	if !isElement || !otherIsElement {
+		if match, _ := CompareNodes(node, otherNode, false); !match {
+			r.add(NodeChanged, index, node, "", string(node.HTML()), string(otherNode.HTML()))
+		}
+		return
+	}
+	if match, _ := el.Compare(otherEl, false); !match {
+		r.add(NodeChanged, index, el, "", string(el.HTML()), string(otherEl.HTML()))
+		return
+	}
+	r.addAttrs(index, el, otherEl)
+	r.addChildren(index, el.children, otherEl.children)
+}
+
+// addAttrs adds the differences between the attributes of el and otherEl.
+// Just like diffAttributes, the attributes which were added or changed come
+// first, in the order they appear in otherEl, followed by the attributes
+// which were removed, in the order they appear in el.
+func (r *DiffReport) addAttrs(index []int, el, otherEl *Element) {
+	attrs := normalizeAttrs(el.Attrs, el.Namespace)
+	otherAttrs := normalizeAttrs(otherEl.Attrs, otherEl.Namespace)
+	values := map[string]string{}
+	for _, attr := range attrs {
+		values[attr.Name] = attr.Value
+	}
+	otherValues := map[string]string{}
+	for _, otherAttr := range otherAttrs {
+		otherValues[otherAttr.Name] = otherAttr.Value
+		value, found := values[otherAttr.Name]
+		if !found {
+			r.add(AttrAdded, index, el, otherAttr.Name, "", otherAttr.Value)
+		} else if !attrValuesEqual(el.Namespace, otherAttr.Name, value, otherAttr.Value) {
+			r.add(AttrChanged, index, el, otherAttr.Name, value, otherAttr.Value)
+		}
+	}
+	for _, attr := range attrs {
+		if _, found := otherValues[attr.Name]; !found {
+			r.add(AttrRemoved, index, el, attr.Name, attr.Value, "")
+		}
+	}
+}
+
+// add adds a single difference to the report.
+func (r *DiffReport) add(kind DifferenceKind, index []int, node Node, attr, before, after string) {
+	r.Differences = append(r.Differences, Difference{
+		Kind:   kind,
+		Index:  index,
+		Node:   nodeKind(node),
+		Attr:   attr,
+		Before: before,
+		After:  after,
+	})
+}
+
+// nodeKind returns a human-readable name for the type of node.
+func nodeKind(node Node) string {
+	switch node.(type) {
+	case *Element:
+		return "element"
+	case *Text:
+		return "text"
+	case *Comment:
+		return "comment"
+	case *Doctype:
+		return "doctype"
+	case *CDATA:
+		return "cdata"
+	}
+	return fmt.Sprintf("%T", node)
+}
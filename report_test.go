@@ -0,0 +1,93 @@
+package vdom
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDiffReport(t *testing.T) {
+	tree, err := Parse([]byte(`<ul class="todos" id="list"><li>one</li><li checked>two</li><li>three</li></ul><p>hi</p><!--c-->`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := Parse([]byte(`<ul title="t" class="done"><li>one</li><li checked="checked">dos</li><li>three</li><li>four</li></ul><div>hi</div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := NewDiffReport(tree, other)
+	expected := []Difference{
+		{Kind: AttrAdded, Index: []int{0}, Node: "element", Attr: "title", After: "t"},
+		{Kind: AttrChanged, Index: []int{0}, Node: "element", Attr: "class", Before: "todos", After: "done"},
+		{Kind: AttrRemoved, Index: []int{0}, Node: "element", Attr: "id", Before: "list"},
+		{Kind: NodeChanged, Index: []int{0, 1, 0}, Node: "text", Before: "two", After: "dos"},
+		{Kind: NodeAdded, Index: []int{0, 3}, Node: "element", After: "<li>four</li>"},
+		{Kind: NodeChanged, Index: []int{1}, Node: "element", Before: "<p>hi</p>", After: "<div>hi</div>"},
+		{Kind: NodeRemoved, Index: []int{2}, Node: "comment", Before: "<!--c-->"},
+	}
+	if !reflect.DeepEqual(report.Differences, expected) {
+		t.Errorf("Differences were not correct.\nExpected: %v\nGot:      %v", expected, report.Differences)
+	}
+	if report.Empty() {
+		t.Error("Expected report not to be empty")
+	}
+
+	expectedText := `@@ [0] attr-added element title @@
++t
+@@ [0] attr-changed element class @@
+-todos
++done
+@@ [0] attr-removed element id @@
+-list
+@@ [0 1 0] changed text @@
+-two
++dos
+@@ [0 3] added element @@
++<li>four</li>
+@@ [1] changed element @@
+-<p>hi</p>
++<div>hi</div>
+@@ [2] removed comment @@
+-<!--c-->
+`
+	if got := report.String(); got != expectedText {
+		t.Errorf("String was not correct.\nExpected:\n%s\nGot:\n%s", expectedText, got)
+	}
+
+	data, err := report.JSON()
+	if err != nil {
+		t.Fatalf("Unexpected error in JSON: %s", err.Error())
+	}
+	decoded := &DiffReport{}
+	if err := json.Unmarshal(data, decoded); err != nil {
+		t.Fatalf("Unexpected error decoding JSON: %s", err.Error())
+	}
+	if !reflect.DeepEqual(decoded, report) {
+		t.Errorf("JSON did not round trip.\nExpected: %v\nGot:      %v", report, decoded)
+	}
+}
+
+func TestDiffReportEmpty(t *testing.T) {
+	tree, err := Parse([]byte(`<div id="a" class="b"><input disabled></div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := Parse([]byte(`<div class="b" id="a"><input disabled="disabled"></div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := NewDiffReport(tree, other)
+	if !report.Empty() {
+		t.Errorf("Expected report to be empty but got:\n%s", report)
+	}
+	if got := report.String(); got != "" {
+		t.Errorf("Expected String to be empty but got %q", got)
+	}
+	data, err := report.JSON()
+	if err != nil {
+		t.Fatalf("Unexpected error in JSON: %s", err.Error())
+	}
+	if got := string(data); got != "{\n\t\"differences\": []\n}" {
+		t.Errorf("JSON was not correct. Got %s", got)
+	}
+}
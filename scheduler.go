@@ -0,0 +1,131 @@
+package vdom
+
+import (
+	"github.com/gopherjs/gopherjs/js"
+)
+
+// FrameRequester requests that a function be called once before the next
+// frame is drawn.
+type FrameRequester interface {
+	RequestFrame(f func())
+}
+
+// animationFrames is a FrameRequester which uses requestAnimationFrame, or
+// setTimeout in browsers which do not support it.
+type animationFrames struct{}
+
+func (animationFrames) RequestFrame(f func()) {
+	if raf := js.Global.Get("requestAnimationFrame"); raf != js.Undefined {
+		js.Global.Call("requestAnimationFrame", f)
+	} else {
+		js.Global.Call("setTimeout", f, 16)
+	}
+}
+
+// AnimationFrames is a FrameRequester which calls functions before the next
+// frame is drawn in the browser. It uses requestAnimationFrame if available,
+// and falls back to setTimeout otherwise.
+var AnimationFrames FrameRequester = animationFrames{}
+
+// ManualFrames is a FrameRequester which only calls functions when Tick is
+// called. It is useful for testing, since you have complete control over
+// when frames happen.
+type ManualFrames struct {
+	pending []func()
+}
+
+// RequestFrame satisfies the FrameRequester interface. f will be called on
+// the next call to Tick.
+func (m *ManualFrames) RequestFrame(f func()) {
+	m.pending = append(m.pending, f)
+}
+
+// Tick calls every function that was requested before Tick was called, in
+// the order they were requested. Any functions requested during the tick are
+// called on the next tick.
+func (m *ManualFrames) Tick() {
+	pending := m.pending
+	m.pending = nil
+	for _, f := range pending {
+		f()
+	}
+}
+
+// Pending returns the number of functions waiting for the next tick.
+func (m *ManualFrames) Pending() int {
+	return len(m.pending)
+}
+
+// Scheduler batches renders for mounted components. Instead of rendering
+// right away, a Root which is invalidated is marked as dirty, and all dirty
+// Roots are rendered together once per frame. Each Root is only rendered
+// once per frame no matter how many times it was invalidated.
+type Scheduler struct {
+	frames    FrameRequester
+	dirty     []*Root
+	requested bool
+}
+
+// NewScheduler returns a Scheduler which uses frames to decide when to
+// render.
+func NewScheduler(frames FrameRequester) *Scheduler {
+	return &Scheduler{
+		frames: frames,
+	}
+}
+
+// DefaultScheduler is the Scheduler used by any Root which does not have a
+// Scheduler of its own. It renders once per animation frame.
+var DefaultScheduler = NewScheduler(AnimationFrames)
+
+// Invalidate marks r as dirty so that it is rendered on the next frame. If
+// r is already dirty, Invalidate does nothing.
+func (s *Scheduler) Invalidate(r *Root) {
+	if s.isDirty(r) {
+		return
+	}
+	s.dirty = append(s.dirty, r)
+	if !s.requested {
+		s.requested = true
+		s.frames.RequestFrame(s.Flush)
+	}
+}
+
+// Flush immediately renders every dirty Root in the order they were first
+// invalidated. Any Root which is invalidated during the flush (e.g. from one
+// of the lifecycle methods) is rendered on the next frame instead. Errors are
+// passed to the OnError function of the corresponding Root, or cause a panic
+// if it is nil.
+func (s *Scheduler) Flush() {
+	dirty := s.dirty
+	s.dirty = nil
+	s.requested = false
+	for _, r := range dirty {
+		if err := r.Render(); err != nil {
+			if r.OnError == nil {
+				panic(err)
+			}
+			r.OnError(err)
+		}
+	}
+}
+
+// cancel removes r from the dirty Roots, if it is there.
+func (s *Scheduler) cancel(r *Root) {
+	for i, dirty := range s.dirty {
+		if dirty == r {
+			s.dirty = append(s.dirty[:i], s.dirty[i+1:]...)
+			return
+		}
+	}
+}
+
+// isDirty returns true iff r is waiting to be rendered.
+func (s *Scheduler) isDirty(r *Root) bool {
+	for _, dirty := range s.dirty {
+		if dirty == r {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+package vdom
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// countingComponent records each time it is rendered in a shared log. If
+// onUpdate is not nil, it is called from Updated.
+type countingComponent struct {
+	name     string
+	text     string
+	err      error
+	log      *[]string
+	onUpdate func()
+}
+
+func (c *countingComponent) Render() (*Tree, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	*c.log = append(*c.log, c.name)
+	return Parse([]byte("<p>" + c.text + "</p>"))
+}
+
+func (c *countingComponent) Updated() {
+	if c.onUpdate != nil {
+		c.onUpdate()
+	}
+}
+
+// mountCounting mounts a countingComponent with the given name and returns
+// the component and its Root, which uses s.
+func mountCounting(t *testing.T, s *Scheduler, name string, log *[]string) (*countingComponent, *Root) {
+	c := &countingComponent{name: name, text: name, log: log}
+	r, err := Mount(newMemRoot(""), c)
+	if err != nil {
+		t.Fatalf("Unexpected error in Mount: %s", err.Error())
+	}
+	r.Scheduler = s
+	return c, r
+}
+
+func TestSchedulerFlushOrder(t *testing.T) {
+	frames := &ManualFrames{}
+	s := NewScheduler(frames)
+	log := []string{}
+	_, a := mountCounting(t, s, "a", &log)
+	_, b := mountCounting(t, s, "b", &log)
+	_, c := mountCounting(t, s, "c", &log)
+	log = []string{}
+	b.Invalidate()
+	a.Invalidate()
+	b.Invalidate()
+	c.Invalidate()
+	a.Invalidate()
+	if frames.Pending() != 1 {
+		t.Errorf("Expected 1 requested frame but got %d", frames.Pending())
+	}
+	if len(log) != 0 {
+		t.Errorf("Expected nothing to be rendered before the frame but got %v", log)
+	}
+	frames.Tick()
+	if expected := []string{"b", "a", "c"}; !reflect.DeepEqual(log, expected) {
+		t.Errorf("Expected each root to be rendered once in the order it was invalidated. Expected %v but got %v", expected, log)
+	}
+	if frames.Pending() != 0 {
+		t.Errorf("Expected no more requested frames but got %d", frames.Pending())
+	}
+}
+
+func TestSchedulerInvalidateDuringFlush(t *testing.T) {
+	frames := &ManualFrames{}
+	s := NewScheduler(frames)
+	log := []string{}
+	ac, a := mountCounting(t, s, "a", &log)
+	_, b := mountCounting(t, s, "b", &log)
+	log = []string{}
+	// When a is updated, it invalidates b and itself. Both of those should
+	// wait for the next frame.
+	ac.onUpdate = func() {
+		b.Invalidate()
+		a.Invalidate()
+	}
+	ac.text = "changed"
+	a.Invalidate()
+	frames.Tick()
+	if expected := []string{"a"}; !reflect.DeepEqual(log, expected) {
+		t.Errorf("Expected %v but got %v", expected, log)
+	}
+	if frames.Pending() != 1 {
+		t.Fatalf("Expected 1 requested frame but got %d", frames.Pending())
+	}
+	ac.onUpdate = nil
+	frames.Tick()
+	if expected := []string{"a", "b", "a"}; !reflect.DeepEqual(log, expected) {
+		t.Errorf("Expected %v but got %v", expected, log)
+	}
+}
+
+func TestSchedulerUnmount(t *testing.T) {
+	frames := &ManualFrames{}
+	s := NewScheduler(frames)
+	log := []string{}
+	_, a := mountCounting(t, s, "a", &log)
+	_, b := mountCounting(t, s, "b", &log)
+	log = []string{}
+	a.Invalidate()
+	b.Invalidate()
+	a.Unmount()
+	frames.Tick()
+	if expected := []string{"b"}; !reflect.DeepEqual(log, expected) {
+		t.Errorf("Expected unmounted root not to be rendered. Expected %v but got %v", expected, log)
+	}
+}
+
+func TestSchedulerError(t *testing.T) {
+	frames := &ManualFrames{}
+	s := NewScheduler(frames)
+	log := []string{}
+	ac, a := mountCounting(t, s, "a", &log)
+	_, b := mountCounting(t, s, "b", &log)
+	log = []string{}
+	var got error
+	a.OnError = func(err error) {
+		got = err
+	}
+	ac.err = errors.New("render failed")
+	a.Invalidate()
+	b.Invalidate()
+	frames.Tick()
+	if got != ac.err {
+		t.Errorf("Expected OnError to be called with %v but got %v", ac.err, got)
+	}
+	if expected := []string{"b"}; !reflect.DeepEqual(log, expected) {
+		t.Errorf("Expected other roots to be rendered after an error. Expected %v but got %v", expected, log)
+	}
+}
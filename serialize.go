@@ -0,0 +1,174 @@
+package vdom
+
+import (
+	"bytes"
+	"html"
+	"io"
+)
+
+// voidElements is the set of elements which can't have any children. They
+// are written without a closing tag.
+var voidElements = map[string]bool{
+	"area":   true,
+	"base":   true,
+	"br":     true,
+	"col":    true,
+	"embed":  true,
+	"hr":     true,
+	"img":    true,
+	"input":  true,
+	"link":   true,
+	"meta":   true,
+	"param":  true,
+	"source": true,
+	"track":  true,
+	"wbr":    true,
+}
+
+// rawTextElements is the set of elements whose contents are always a single
+// text node, exactly as written. Their text is not escaped when written as
+// html.
+var rawTextElements = map[string]bool{
+	"iframe":   true,
+	"noembed":  true,
+	"noframes": true,
+	"script":   true,
+	"style":    true,
+	"xmp":      true,
+}
+
+// rcdataElements is the set of elements whose contents are always a single
+// text node, with any character references decoded. Unlike raw text, their
+// text is escaped when written as html.
+var rcdataElements = map[string]bool{
+	"textarea": true,
+	"title":    true,
+}
+
+// WriteHTML writes the html for t to w. Unlike HTML, which returns the
+// unescaped source, WriteHTML builds the html from the nodes themselves and
+// escapes text and attribute values. This makes it safe to send the result
+// to a browser, e.g. when rendering on the server, and it works for trees
+// which were changed after parsing.
+func (t *Tree) WriteHTML(w io.Writer) error {
+	hw := &htmlWriter{w: w}
+	hw.writeChildren(nil, t.Children)
+	return hw.err
+}
+
+// htmlWriter writes html to w and remembers the first error that occurs, so
+// that we don't need to check for errors after every write.
+type htmlWriter struct {
+	w   io.Writer
+	err error
+	// If format is true, the writer is writing indented html. See
+	// WriteIndentedHTML.
+	format bool
+	// indenting is true while children can be written on their own lines,
+	// and depth is the number of times to repeat indent.
+	indenting bool
+	indent    string
+	depth     int
+	// atLineStart is true if the last thing written was a newline.
+	atLineStart bool
+}
+
+// write writes s to hw.w, unless there has already been an error.
+func (hw *htmlWriter) write(s string) {
+	if hw.err != nil {
+		return
+	}
+	_, hw.err = io.WriteString(hw.w, s)
+	if s != "" {
+		hw.atLineStart = s[len(s)-1] == '\n'
+	}
+}
+
+// writeChildren writes the html for nodes, which are the children of parent.
+// parent may be nil if the nodes are the first-level children of a tree.
+func (hw *htmlWriter) writeChildren(parent *Element, nodes []Node) {
+	if hw.indenting {
+		if formatsAsBlock(parent, nodes) {
+			hw.writeBlock(parent, nodes)
+			return
+		}
+		// Anything inside of inline content is written exactly as it is.
+		hw.indenting = false
+		defer func() { hw.indenting = true }()
+	}
+	raw := parent != nil && parent.Namespace == "" && rawTextElements[parent.Name]
+	for _, child := range nodes {
+		if text, ok := child.(*Text); ok && raw {
+			hw.write(string(text.Value))
+			continue
+		}
+		hw.writeNode(child)
+	}
+}
+
+// htmlForDOM returns the escaped html for nodes, which are the children of
+// parent, so that it can be used to set the inner html of an element in the
+// actual DOM. parent may be nil.
+func htmlForDOM(parent *Element, nodes []Node) string {
+	buf := &bytes.Buffer{}
+	hw := &htmlWriter{w: buf}
+	hw.writeChildren(parent, nodes)
+	return buf.String()
+}
+
+// writeAttr writes attr with its value escaped, including a leading space.
+// Boolean attributes of html elements are written without a value.
+func (hw *htmlWriter) writeAttr(namespace string, attr Attr) {
+	if isBooleanAttr(namespace, attr.Name) {
+		hw.write(" " + attr.Name)
+		return
+	}
+	hw.write(" " + attr.Name + `="` + hw.escapeAttr(attr.Value) + `"`)
+}
+
+// writeNode writes the html for node and all of its children.
+func (hw *htmlWriter) writeNode(node Node) {
+	switch n := node.(type) {
+	case *Element:
+		hw.write("<" + n.Name)
+		for _, attr := range n.Attrs {
+			hw.writeAttr(n.Namespace, attr)
+		}
+		if n.Namespace != "" && len(n.children) == 0 {
+			// Inside of svg or mathml, the browser only closes an element
+			// without a closing tag if it closes itself, e.g. <path/>.
+			hw.write("/>")
+			return
+		}
+		hw.write(">")
+		if voidElements[n.Name] {
+			return
+		}
+		hw.writeChildren(n, n.children)
+		hw.write("</" + n.Name + ">")
+	case *Text:
+		hw.write(hw.escapeText(string(n.Value)))
+	case *Comment:
+		hw.write("<!--" + string(n.Value) + "-->")
+	case *Doctype:
+		hw.write(string(n.HTML()))
+	case *CDATA:
+		hw.write("<![CDATA[" + string(n.Value) + "]]>")
+	}
+}
+
+// escapeText returns s escaped for use as text.
+func (hw *htmlWriter) escapeText(s string) string {
+	if hw.format {
+		return textEscaper.Replace(s)
+	}
+	return html.EscapeString(s)
+}
+
+// escapeAttr returns s escaped for use as a double-quoted attribute value.
+func (hw *htmlWriter) escapeAttr(s string) string {
+	if hw.format {
+		return attrEscaper.Replace(s)
+	}
+	return html.EscapeString(s)
+}
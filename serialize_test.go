@@ -0,0 +1,89 @@
+package vdom
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteHTML(t *testing.T) {
+	testCases := []struct {
+		name     string
+		src      string
+		expected string
+	}{
+		{
+			name:     "nested elements",
+			src:      `<div class="container"><ul><li>one</li><li>two</li></ul></div>`,
+			expected: `<div class="container"><ul><li>one</li><li>two</li></ul></div>`,
+		},
+		{
+			name:     "escaped text",
+			src:      `<p>&lt;script&gt;alert(&#34;hi&#34;)&lt;/script&gt; &amp; more</p>`,
+			expected: `<p>&lt;script&gt;alert(&#34;hi&#34;)&lt;/script&gt; &amp; more</p>`,
+		},
+		{
+			name:     "escaped attribute",
+			src:      `<div title="&#34;quoted&#34; &lt;b&gt;"></div>`,
+			expected: `<div title="&#34;quoted&#34; &lt;b&gt;"></div>`,
+		},
+		{
+			name:     "void elements",
+			src:      `<form><input type="text"><br></form>`,
+			expected: `<form><input type="text"><br></form>`,
+		},
+		{
+			name:     "comments and whitespace",
+			src:      "<div>\n\t<!-- comment -->\n</div>",
+			expected: "<div>\n\t<!-- comment -->\n</div>",
+		},
+		{
+			name:     "multiple roots",
+			src:      `<p>one</p>text<p>two</p>`,
+			expected: `<p>one</p>text<p>two</p>`,
+		},
+		{
+			name:     "raw text",
+			src:      `<div><script>if (a < b && c) { x = "&lt;/div&gt;" }</script><style>a > b {}</style></div>`,
+			expected: `<div><script>if (a < b && c) { x = "&lt;/div&gt;" }</script><style>a > b {}</style></div>`,
+		},
+		{
+			name:     "document",
+			src:      "<!DOCTYPE html>\n<html><body><svg><![CDATA[x < y]]></svg></body></html>",
+			expected: "<!DOCTYPE html>\n<html><body><svg><![CDATA[x < y]]></svg></body></html>",
+		},
+		{
+			name:     "self-closed svg elements",
+			src:      `<svg><path d="M0 0"/><circle r="1"/></svg>`,
+			expected: `<svg><path d="M0 0"/><circle r="1"/></svg>`,
+		},
+		{
+			name:     "rcdata",
+			src:      `<div><textarea><b>bold</b> &amp;amp;</textarea><title>a &lt; b</title></div>`,
+			expected: `<div><textarea>&lt;b&gt;bold&lt;/b&gt; &amp;amp;</textarea><title>a &lt; b</title></div>`,
+		},
+	}
+	for _, tc := range testCases {
+		tree, err := Parse([]byte(tc.src))
+		if err != nil {
+			t.Errorf("%s: Unexpected error in Parse: %s", tc.name, err.Error())
+			continue
+		}
+		buf := bytes.NewBuffer(nil)
+		if err := tree.WriteHTML(buf); err != nil {
+			t.Errorf("%s: Unexpected error in WriteHTML: %s", tc.name, err.Error())
+			continue
+		}
+		if got := buf.String(); got != tc.expected {
+			t.Errorf("%s: WriteHTML was not correct.\nExpected: %s\nGot:      %s", tc.name, tc.expected, got)
+		}
+		// Parsing the result should give us the same tree.
+		reparsed, err := Parse(buf.Bytes())
+		if err != nil {
+			t.Errorf("%s: Unexpected error parsing the result of WriteHTML: %s", tc.name, err.Error())
+			continue
+		}
+		if match, msg := tree.Compare(reparsed, true); !match {
+			t.Errorf("%s: Parsing the result of WriteHTML gave a different tree.\n%s", tc.name, msg)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package vdom
+
+import (
+	"strings"
+
+	"honnef.co/go/js/dom"
+)
+
+// StyleDeclaration is a single declaration from the style attribute of an
+// element, e.g. "color: red" or "margin: 0 !important".
+type StyleDeclaration struct {
+	// Property is the name of the css property. It is lowercase unless it
+	// is a custom property (e.g. --main-color), since those are case
+	// sensitive.
+	Property string
+	// Value is the value of the property, without any !important.
+	Value string
+	// Important is true iff the declaration ends with !important.
+	Important bool
+}
+
+// String returns the declaration the way it would be written in a style
+// attribute, without a trailing semicolon.
+func (d StyleDeclaration) String() string {
+	if d.Important {
+		return d.Property + ": " + d.Value + " !important"
+	}
+	return d.Property + ": " + d.Value
+}
+
+// Styles returns the declarations in the style attribute of e, in the order
+// they appear. If a property is declared more than once, only the last
+// declaration is kept, just like in the browser. It returns nil if e does
+// not have a style attribute.
+func (e *Element) Styles() []StyleDeclaration {
+	style, found := e.AttrMap()["style"]
+	if !found {
+		return nil
+	}
+	return parseStyle(style)
+}
+
+// parseStyle parses the value of a style attribute. Declarations without a
+// property or a value are skipped.
+func parseStyle(style string) []StyleDeclaration {
+	decls := []StyleDeclaration{}
+	indexes := map[string]int{}
+	for _, part := range splitDeclarations(style) {
+		colon := strings.IndexByte(part, ':')
+		if colon == -1 {
+			continue
+		}
+		decl := StyleDeclaration{
+			Property: strings.TrimSpace(part[:colon]),
+			Value:    strings.TrimSpace(part[colon+1:]),
+		}
+		if !strings.HasPrefix(decl.Property, "--") {
+			decl.Property = strings.ToLower(decl.Property)
+		}
+		if bang := strings.LastIndexByte(decl.Value, '!'); bang != -1 && strings.EqualFold(strings.TrimSpace(decl.Value[bang+1:]), "important") {
+			decl.Value = strings.TrimSpace(decl.Value[:bang])
+			decl.Important = true
+		}
+		if decl.Property == "" || decl.Value == "" {
+			continue
+		}
+		if i, found := indexes[decl.Property]; found {
+			decls[i] = decl
+			continue
+		}
+		indexes[decl.Property] = len(decls)
+		decls = append(decls, decl)
+	}
+	return decls
+}
+
+// splitDeclarations splits style on the semicolons which separate its
+// declarations. Semicolons inside of quotes or parentheses (e.g. in a data
+// url) do not count.
+func splitDeclarations(style string) []string {
+	parts := []string{}
+	depth := 0
+	var quote byte
+	start := 0
+	for i := 0; i < len(style); i++ {
+		c := style[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')' && depth > 0:
+			depth--
+		case c == ';' && depth == 0:
+			parts = append(parts, style[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, style[start:])
+}
+
+// diffStyles adds a SetStyle patch for each declaration which is new or
+// different in otherEl, in the order they appear in otherEl, followed by a
+// RemoveStyle patch for each property which is in el but not otherEl, in the
+// order they appear in el. Unlike setting the style attribute, this leaves
+// any properties which were set in the actual DOM by other code alone.
+func diffStyles(patches *[]Patcher, el, otherEl *Element) {
+	decls := map[string]StyleDeclaration{}
+	for _, decl := range el.Styles() {
+		decls[decl.Property] = decl
+	}
+	otherDecls := map[string]bool{}
+	for _, otherDecl := range otherEl.Styles() {
+		otherDecls[otherDecl.Property] = true
+		if decl, found := decls[otherDecl.Property]; !found || decl != otherDecl {
+			otherDecl := otherDecl
+			*patches = append(*patches, &SetStyle{
+				Node:  el,
+				Style: &otherDecl,
+			})
+		}
+	}
+	for _, decl := range el.Styles() {
+		if !otherDecls[decl.Property] {
+			*patches = append(*patches, &RemoveStyle{
+				Node:     el,
+				Property: decl.Property,
+			})
+		}
+	}
+}
+
+// SetStyle is a Patcher which will set a single property in the style of
+// the given Node. Any other properties are left alone.
+type SetStyle struct {
+	Node  Node
+	Style *StyleDeclaration
+}
+
+// Patch satisfies the Patcher interface and applies the change to the
+// actual DOM.
+func (p *SetStyle) Patch(root dom.Element) error {
+	self := findInDOM(p.Node, root)
+	priority := ""
+	if p.Style.Important {
+		priority = "important"
+	}
+	callNodeMethod(self, "style", "setProperty", p.Style.Property, p.Style.Value, priority)
+	return nil
+}
+
+// RemoveStyle is a Patcher which will remove a single property from the
+// style of the given Node. Any other properties are left alone.
+type RemoveStyle struct {
+	Node     Node
+	Property string
+}
+
+// Patch satisfies the Patcher interface and applies the change to the
+// actual DOM.
+func (p *RemoveStyle) Patch(root dom.Element) error {
+	self := findInDOM(p.Node, root)
+	callNodeMethod(self, "style", "removeProperty", p.Property)
+	return nil
+}
@@ -0,0 +1,99 @@
+package vdom
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseStyle(t *testing.T) {
+	testCases := []struct {
+		style    string
+		expected []StyleDeclaration
+	}{
+		{"", []StyleDeclaration{}},
+		{
+			style: "color: red; Margin:0 auto;",
+			expected: []StyleDeclaration{
+				{Property: "color", Value: "red"},
+				{Property: "margin", Value: "0 auto"},
+			},
+		},
+		{
+			style: "color: red; color: blue ! IMPORTANT; --Main-Color: green",
+			expected: []StyleDeclaration{
+				{Property: "color", Value: "blue", Important: true},
+				{Property: "--Main-Color", Value: "green"},
+			},
+		},
+		{
+			style: `background: url(data:image/png;base64,abc); content: "a;b"; ; width:`,
+			expected: []StyleDeclaration{
+				{Property: "background", Value: "url(data:image/png;base64,abc)"},
+				{Property: "content", Value: `"a;b"`},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		if got := parseStyle(tc.style); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%q: Expected declarations to be %#v but got %#v", tc.style, tc.expected, got)
+		}
+	}
+	el := &Element{Name: "div"}
+	if got := el.Styles(); got != nil {
+		t.Errorf("Expected nil declarations for an element without a style attribute but got %#v", got)
+	}
+}
+
+func TestDiffGranularStyle(t *testing.T) {
+	oldTree, err := Parse([]byte(`<div style="color: red; margin: 0; display: none"></div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newTree, err := Parse([]byte(`<div style="display:none;color: blue !important;padding: 1px"></div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	div := oldTree.Children[0]
+	patches, err := DiffWithOptions(oldTree, newTree, DiffOptions{GranularStyle: true})
+	if err != nil {
+		t.Fatalf("Unexpected error in DiffWithOptions: %s", err)
+	}
+	expected := PatchSet{
+		&SetStyle{Node: div, Style: &StyleDeclaration{Property: "color", Value: "blue", Important: true}},
+		&SetStyle{Node: div, Style: &StyleDeclaration{Property: "padding", Value: "1px"}},
+		&RemoveStyle{Node: div, Property: "margin"},
+	}
+	if err := expectPatchSetEquals(expected, patches); err != nil {
+		t.Fatal(err)
+	}
+
+	// A property which was set by other code should be left alone.
+	root := newMemRoot(`<div style="color: red; margin: 0; display: none"></div>`)
+	memNodeAt(root, 0).SetAttribute("style", "color: red; margin: 0; display: none; opacity: 0.5")
+	if err := patches.Patch(root); err != nil {
+		t.Fatalf("Unexpected error in Patch: %s", err)
+	}
+	expectedHTML := `<div style="color: blue !important; display: none; opacity: 0.5; padding: 1px;"></div>`
+	if got := root.InnerHTML(); got != expectedHTML {
+		t.Errorf("Actual DOM was not correct.\nExpected: %s\nGot:      %s", expectedHTML, got)
+	}
+
+	// Removing the style attribute removes each of the properties.
+	emptyTree, err := Parse([]byte(`<div></div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	patches, err = DiffWithOptions(newTree, emptyTree, DiffOptions{GranularStyle: true})
+	if err != nil {
+		t.Fatalf("Unexpected error in DiffWithOptions: %s", err)
+	}
+	newDiv := newTree.Children[0]
+	expected = PatchSet{
+		&RemoveStyle{Node: newDiv, Property: "display"},
+		&RemoveStyle{Node: newDiv, Property: "color"},
+		&RemoveStyle{Node: newDiv, Property: "padding"},
+	}
+	if err := expectPatchSetEquals(expected, patches); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,50 @@
+package vdom
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+)
+
+// ExecuteTemplate executes t with the given data and parses the result into
+// a virtual tree. Since it uses html/template to execute the template, any
+// data is escaped according to its context in the html, exactly as it would
+// be if you wrote the output of the template to the DOM yourself.
+//
+// ExecuteTemplate does not block, so it is safe to call from anywhere,
+// including js callbacks in gopherjs. To parse the html while the template
+// is still being executed, use ExecuteTemplateStream instead.
+func ExecuteTemplate(t *template.Template, data interface{}) (*Tree, error) {
+	buf := bytes.NewBuffer([]byte{})
+	if err := t.Execute(buf, data); err != nil {
+		return nil, err
+	}
+	return Parse(buf.Bytes())
+}
+
+// ExecuteTemplateStream is like ExecuteTemplate, but it builds the tree as
+// the template writes its output instead of waiting for the template to
+// finish. The template is executed in a separate goroutine and its output is
+// read directly by the parser. Like ParseReader, the output that has already
+// been parsed is thrown away, so the whole output is never held in memory.
+// Since the tree does not keep the output, the HTML methods of the nodes
+// construct the html from the nodes themselves.
+//
+// Because it waits on another goroutine, ExecuteTemplateStream blocks. In
+// gopherjs, blocking is not allowed in js callbacks (e.g. an event listener
+// or a Scheduler flush), so you should only call it from a goroutine. If
+// parsing fails before the template is done, the template is stopped with
+// the same error.
+func ExecuteTemplateStream(t *template.Template, data interface{}) (*Tree, error) {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(t.Execute(pw, data))
+	}()
+	tree, err := parse(newIndexedByteReaderFrom(pr), false, nil)
+	if err != nil {
+		// Make sure the goroutine does not block forever trying to write.
+		pr.CloseWithError(err)
+		return nil, err
+	}
+	return tree, nil
+}
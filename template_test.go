@@ -0,0 +1,103 @@
+package vdom
+
+import (
+	"errors"
+	"html/template"
+	"strings"
+	"testing"
+)
+
+var todoListTmpl = template.Must(template.New("todos").Parse(`<ul class="todo-list">{{ range . }}<li class="todo {{ if .Completed }}completed{{ end }}" data-title="{{ .Title }}"><input type="checkbox"><label>{{ .Title }}</label></li>{{ end }}</ul>`))
+
+type templateTodo struct {
+	Title     string
+	Completed bool
+}
+
+func TestExecuteTemplate(t *testing.T) {
+	todos := []templateTodo{
+		{Title: "Write tests"},
+		{Title: "Fix <b>bugs</b> & \"things\"", Completed: true},
+		{Title: "<script>alert('hi')</script>"},
+	}
+	// Add enough todos that the output is bigger than a single chunk when
+	// streaming.
+	for i := 0; i < 50; i++ {
+		todos = append(todos, templateTodo{Title: strings.Repeat("x", i)})
+	}
+	// The expected tree is the one we get from executing the template into a
+	// buffer and parsing it separately.
+	buf := &strings.Builder{}
+	if err := todoListTmpl.Execute(buf, todos); err != nil {
+		t.Fatalf("Unexpected error executing template: %s", err.Error())
+	}
+	expected, err := Parse([]byte(buf.String()))
+	if err != nil {
+		t.Fatalf("Unexpected error in Parse: %s", err.Error())
+	}
+	for _, execute := range []struct {
+		name string
+		f    func(*template.Template, interface{}) (*Tree, error)
+	}{
+		{"ExecuteTemplate", ExecuteTemplate},
+		{"ExecuteTemplateStream", ExecuteTemplateStream},
+	} {
+		got, err := execute.f(todoListTmpl, todos)
+		if err != nil {
+			t.Errorf("%s: Unexpected error: %s", execute.name, err.Error())
+			continue
+		}
+		if report := NewDiffReport(expected, got); !report.Empty() {
+			t.Errorf("%s: Tree was not correct.\n%s", execute.name, report)
+		}
+		if string(got.Children[0].HTML()) != string(expected.Children[0].HTML()) {
+			t.Errorf("%s: HTML was not correct.\nExpected: %s\nGot:      %s", execute.name, expected.Children[0].HTML(), got.Children[0].HTML())
+		}
+		// The script in the title should have been escaped by html/template, so
+		// it is a text node instead of an element.
+		label := got.Children[0].Children()[2].Children()[1]
+		if len(label.Children()) != 1 {
+			t.Fatalf("%s: Expected label to have 1 child but got %d", execute.name, len(label.Children()))
+		}
+		if text, ok := label.Children()[0].(*Text); !ok {
+			t.Errorf("%s: Expected escaped script to be a text node but got %T", execute.name, label.Children()[0])
+		} else if string(text.Value) != todos[2].Title {
+			t.Errorf("%s: Expected text to be %s but got %s", execute.name, todos[2].Title, text.Value)
+		}
+		li := got.Children[0].Children()[1].(*Element)
+		if value := li.AttrMap()["data-title"]; value != todos[1].Title {
+			t.Errorf("%s: Expected attribute to be %s but got %s", execute.name, todos[1].Title, value)
+		}
+	}
+
+	// When streaming, the output of the template is thrown away once it has
+	// been parsed.
+	got, err := ExecuteTemplateStream(todoListTmpl, todos)
+	if err != nil {
+		t.Fatalf("ExecuteTemplateStream: Unexpected error: %s", err.Error())
+	}
+	if len(got.src) != 0 {
+		t.Errorf("ExecuteTemplateStream: Expected the output to be discarded, but the tree kept %d bytes of it", len(got.src))
+	}
+}
+
+func TestExecuteTemplateError(t *testing.T) {
+	errTemplate := errors.New("template failed")
+	tmpl := template.Must(template.New("error").Funcs(template.FuncMap{
+		"fail": func() (string, error) { return "", errTemplate },
+	}).Parse(`<div><p>{{ fail }}</p></div>`))
+	if _, err := ExecuteTemplate(tmpl, nil); err == nil {
+		t.Error("ExecuteTemplate: Expected an error from the template but got none")
+	}
+	if _, err := ExecuteTemplateStream(tmpl, nil); err == nil {
+		t.Error("ExecuteTemplateStream: Expected an error from the template but got none")
+	}
+
+	// If the html is malformed, the parser stops before the template is done.
+	// Make sure that this doesn't cause a deadlock.
+	malformed := template.Must(template.New("malformed").Parse(`<div></p>{{ range . }}<p>{{ . }}</p>{{ end }}</div>`))
+	data := make([]string, 1000)
+	if _, err := ExecuteTemplateStream(malformed, data); err == nil {
+		t.Error("ExecuteTemplateStream: Expected an error for malformed html but got none")
+	}
+}
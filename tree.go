@@ -1,9 +1,15 @@
 package vdom
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
+	"hash"
+	"hash/fnv"
 	"html"
 	"reflect"
+	"sort"
+	"strings"
 )
 
 // A Tree is a virtual, in-memory representation of a DOM tree
@@ -12,11 +18,26 @@ type Tree struct {
 	Children []Node
 	reader   *IndexedByteReader
 	src      []byte
+	// modified is true if any nodes were changed after parsing, which means
+	// that src no longer matches them.
+	modified bool
+	// hasRawText is true if the tree contains a raw text element (see
+	// rawTextElements) whose html must not be unescaped.
+	hasRawText bool
 }
 
 // HTML returns the html of this tree and recursively its children
 // as a slice of bytes.
 func (t *Tree) HTML() []byte {
+	if t.src == nil || t.modified || t.hasRawText {
+		// The tree does not have the original html, so construct it from the
+		// children instead.
+		result := []byte{}
+		for _, child := range t.Children {
+			result = append(result, child.HTML()...)
+		}
+		return result
+	}
 	escaped := string(t.src)
 	return []byte(html.UnescapeString(escaped))
 }
@@ -37,6 +58,27 @@ type Node interface {
 	// child of some root node, Index should return [0, 1]. This means we
 	// can get to this node via root.ChildNodes()[0].ChildNodes()[1].
 	Index() []int
+	// Pos returns the part of the html that this node was parsed
+	// from.
+	Pos() Pos
+}
+
+// Position is a location in the html that a node was parsed from.
+type Position struct {
+	// Offset is the number of bytes before the position.
+	Offset int
+	// Line is the line number, starting at 1.
+	Line int
+	// Column is the number of bytes from the start of the line, starting at 1.
+	Column int
+}
+
+// Pos is the part of the html that a node was parsed from. Start is the
+// position of the first byte and End is the position just after the last
+// byte. Nodes which were not parsed have the zero Pos.
+type Pos struct {
+	Start Position
+	End   Position
 }
 
 // Attr is an html attribute
@@ -45,11 +87,39 @@ type Attr struct {
 	Value string
 }
 
+// normalizeAttrs returns attrs the way the browser would store them for an
+// element in the given namespace. The names of attributes on html elements
+// are case insensitive, so they are lowercased. If there is more than one
+// attribute with the same name, only the first one is kept. attrs itself is
+// not modified.
+func normalizeAttrs(attrs []Attr, namespace string) []Attr {
+	if len(attrs) == 0 {
+		return attrs
+	}
+	result := make([]Attr, 0, len(attrs))
+	seen := map[string]bool{}
+	for _, attr := range attrs {
+		if namespace == "" {
+			attr.Name = strings.ToLower(attr.Name)
+		}
+		if seen[attr.Name] {
+			continue
+		}
+		seen[attr.Name] = true
+		result = append(result, attr)
+	}
+	return result
+}
+
 // Element is an html element, e.g., <div></div>. Name does not include the
-// <, >, or / symbols.
+// <, >, or / symbols. Namespace is empty for html elements, or SVGNamespace or
+// MathMLNamespace for elements inside of <svg> or <math>.
 type Element struct {
 	Name          string
+	Namespace     string
 	Attrs         []Attr
+	Listeners     []Listener
+	component     Component
 	parent        *Element
 	children      []Node
 	tree          *Tree
@@ -58,7 +128,12 @@ type Element struct {
 	srcInnerStart int
 	srcInnerEnd   int
 	autoClosed    bool
+	modified      bool
+	hasRawText    bool
 	index         []int
+	pos           Pos
+	hash          uint64
+	hashed        bool
 }
 
 func (e *Element) Parent() *Element {
@@ -74,10 +149,26 @@ func (e *Element) HTML() []byte {
 		// If the tag was autoclosed, it has no children. Just construct the html manually
 		result := []byte(fmt.Sprintf("<%s", e.Name))
 		for _, attr := range e.Attrs {
-			result = append(result, []byte(fmt.Sprintf(` %s="%s"`, attr.Name, attr.Value))...)
+			result = append(result, []byte(attrHTML(e.Namespace, attr))...)
+		}
+		if e.Namespace != "" {
+			// Unlike void html elements, svg and mathml elements need to close
+			// themselves.
+			return append(result, []byte("/>")...)
 		}
 		result = append(result, '>')
 		return result
+	} else if !e.hasSource() {
+		// The children were changed after parsing or the tree did not keep the
+		// original html. Construct the html from the children instead.
+		result := []byte(fmt.Sprintf("<%s", e.Name))
+		for _, attr := range e.Attrs {
+			result = append(result, []byte(attrHTML(e.Namespace, attr))...)
+		}
+		result = append(result, '>')
+		result = append(result, e.InnerHTML()...)
+		result = append(result, []byte(fmt.Sprintf("</%s>", e.Name))...)
+		return result
 	} else {
 		escaped := string(e.tree.src[e.srcStart:e.srcEnd])
 		return []byte(html.UnescapeString(escaped))
@@ -85,11 +176,15 @@ func (e *Element) HTML() []byte {
 }
 
 // AttrMap returns this element's attributes as a map
-// of attribute name to attribute value
+// of attribute name to attribute value. If there is more
+// than one attribute with the same name, the first one wins,
+// just like in the browser.
 func (e *Element) AttrMap() map[string]string {
 	m := map[string]string{}
 	for _, attr := range e.Attrs {
-		m[attr.Name] = attr.Value
+		if _, found := m[attr.Name]; !found {
+			m[attr.Name] = attr.Value
+		}
 	}
 	return m
 }
@@ -102,12 +197,78 @@ func (e *Element) InnerHTML() []byte {
 	if e.autoClosed {
 		// If the tag was autoclosed, it has no children, and therefore no inner html.
 		return nil
+	} else if !e.hasSource() {
+		result := []byte{}
+		for _, child := range e.children {
+			result = append(result, child.HTML()...)
+		}
+		return result
 	} else {
 		escaped := string(e.tree.src[e.srcInnerStart:e.srcInnerEnd])
 		return []byte(html.UnescapeString(escaped))
 	}
 }
 
+// hasSource returns true iff the html for e can be taken from the source
+// of its tree. The source is unescaped, which would change the contents of
+// any raw text elements, so elements which contain them are built from their
+// children instead.
+func (e *Element) hasSource() bool {
+	return !e.modified && !e.hasRawText && e.tree != nil && e.tree.src != nil
+}
+
+// setChildren replaces the children of e with the given nodes, which may come
+// from a different tree. The parents and indexes of the nodes are updated to
+// match their new position. Since the source no longer matches the children,
+// e and all of its ancestors are marked as modified.
+func (e *Element) setChildren(children []Node) {
+	e.children = children
+	for i, child := range children {
+		setPosition(child, e, childIndex(e.index, i))
+	}
+	for el := e; el != nil; el = el.parent {
+		el.modified = true
+		el.hashed = false
+	}
+	if e.tree != nil {
+		e.tree.modified = true
+	}
+}
+
+// setPosition sets the parent and index of node and recursively updates the
+// indexes of all of its descendants.
+func setPosition(node Node, parent *Element, index []int) {
+	switch n := node.(type) {
+	case *Element:
+		n.parent = parent
+		n.index = index
+		for i, child := range n.children {
+			setPosition(child, n, childIndex(index, i))
+		}
+	case *Text:
+		n.parent = parent
+		n.index = index
+	case *Comment:
+		n.parent = parent
+		n.index = index
+	case *Doctype:
+		n.parent = parent
+		n.index = index
+	case *CDATA:
+		n.parent = parent
+		n.index = index
+	}
+}
+
+// childIndex returns the index of the ith child of a node with the given
+// index. It does not modify index.
+func childIndex(index []int, i int) []int {
+	result := make([]int, len(index)+1)
+	copy(result, index)
+	result[len(index)] = i
+	return result
+}
+
 // Selector returns a css selector which can be used to find
 // the corresponding element in the actual DOM. The selector
 // should be applied to the root of the tree, i.e. the starting
@@ -125,6 +286,175 @@ func (e *Element) Index() []int {
 	return e.index
 }
 
+func (e *Element) Pos() Pos {
+	return e.pos
+}
+
+// Hash returns a hash of the contents of e, i.e. its name and namespace, its
+// attributes, the types of its Listeners, and all of its descendants. Elements with the
+// same contents always have the same hash, which lets Diff skip over
+// subtrees that have not changed without generating patches for every node
+// inside them. Since different subtrees can have the same hash, Diff only
+// skips a subtree after checking that its contents are the same.
+//
+// The hash is computed the first time Hash is called and then cached.
+// AddEventListener and the methods which change the children of e clear the
+// cache, but changing Attrs or Listeners directly does not. A stale hash
+// never makes Diff miss a change, since it checks the contents anyway, but
+// it can make Diff compare subtrees which are known to be different.
+func (e *Element) Hash() uint64 {
+	if !e.hashed {
+		h := fnv.New64a()
+		writeHashString(h, e.Name)
+		writeHashString(h, e.Namespace)
+		// The order of the attributes does not matter, so they are sorted
+		// by name.
+		attrs := normalizeAttrs(e.Attrs, e.Namespace)
+		sortedAttrs := make([]Attr, len(attrs))
+		copy(sortedAttrs, attrs)
+		sort.Slice(sortedAttrs, func(i, j int) bool {
+			return sortedAttrs[i].Name < sortedAttrs[j].Name
+		})
+		for _, attr := range sortedAttrs {
+			writeHashString(h, attr.Name)
+			if isBooleanAttr(e.Namespace, attr.Name) {
+				// The value of a boolean attribute does not matter.
+				writeHashString(h, "")
+			} else {
+				writeHashString(h, attr.Value)
+			}
+		}
+		for _, listener := range e.Listeners {
+			// Handlers can't be compared, so only the type is included. A
+			// Dispatcher always calls the handlers from the current tree.
+			writeHashString(h, "on:"+listener.Type)
+		}
+		for _, child := range e.children {
+			writeHashUint64(h, hashNode(child))
+		}
+		e.hash = h.Sum64()
+		e.hashed = true
+	}
+	return e.hash
+}
+
+// forgetHash clears the cached hash of e and of its ancestors, whose hashes
+// depend on it.
+func (e *Element) forgetHash() {
+	for el := e; el != nil; el = el.parent {
+		el.hashed = false
+	}
+}
+
+// hashNode returns a hash of the contents of node. Different types of nodes
+// with the same contents have different hashes.
+func hashNode(node Node) uint64 {
+	h := fnv.New64a()
+	switch n := node.(type) {
+	case *Element:
+		h.Write([]byte{'e'})
+		writeHashUint64(h, n.Hash())
+	case *Text:
+		h.Write([]byte{'t'})
+		h.Write(n.Value)
+	case *Comment:
+		h.Write([]byte{'c'})
+		h.Write(n.Value)
+	case *Doctype:
+		h.Write([]byte{'d'})
+		writeHashString(h, n.Name)
+		writeHashString(h, n.PublicID)
+		writeHashString(h, n.SystemID)
+	case *CDATA:
+		h.Write([]byte{'x'})
+		h.Write(n.Value)
+	}
+	return h.Sum64()
+}
+
+// sameContents returns true iff e and other have the same contents, i.e.
+// everything that is included in their hashes. It stops at the first
+// difference.
+func (e *Element) sameContents(other *Element) bool {
+	if e == other {
+		return true
+	}
+	if e.Name != other.Name || e.Namespace != other.Namespace {
+		return false
+	}
+	attrs := normalizeAttrs(e.Attrs, e.Namespace)
+	otherAttrs := normalizeAttrs(other.Attrs, other.Namespace)
+	if len(attrs) != len(otherAttrs) {
+		return false
+	}
+	values := map[string]string{}
+	for _, attr := range attrs {
+		values[attr.Name] = attr.Value
+	}
+	for _, otherAttr := range otherAttrs {
+		value, found := values[otherAttr.Name]
+		if !found || !attrValuesEqual(e.Namespace, otherAttr.Name, value, otherAttr.Value) {
+			return false
+		}
+	}
+	if len(e.Listeners) != len(other.Listeners) {
+		return false
+	}
+	for i, listener := range e.Listeners {
+		if listener.Type != other.Listeners[i].Type {
+			return false
+		}
+	}
+	if len(e.children) != len(other.children) {
+		return false
+	}
+	for i, child := range e.children {
+		if !sameNodeContents(child, other.children[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameNodeContents returns true iff node and other have the same type and
+// contents.
+func sameNodeContents(node, other Node) bool {
+	switch n := node.(type) {
+	case *Element:
+		o, ok := other.(*Element)
+		// Comparing the hashes first is usually enough to find a difference
+		// without visiting the rest of the subtree.
+		return ok && n.Hash() == o.Hash() && n.sameContents(o)
+	case *Text:
+		o, ok := other.(*Text)
+		return ok && bytes.Equal(n.Value, o.Value)
+	case *Comment:
+		o, ok := other.(*Comment)
+		return ok && bytes.Equal(n.Value, o.Value)
+	case *Doctype:
+		o, ok := other.(*Doctype)
+		return ok && n.Name == o.Name && n.PublicID == o.PublicID && n.SystemID == o.SystemID
+	case *CDATA:
+		o, ok := other.(*CDATA)
+		return ok && bytes.Equal(n.Value, o.Value)
+	}
+	return false
+}
+
+// writeHashString writes s to h, followed by a separator so that
+// consecutive strings can't run together.
+func writeHashString(h hash.Hash64, s string) {
+	h.Write([]byte(s))
+	h.Write([]byte{0})
+}
+
+// writeHashUint64 writes the bytes of x to h.
+func writeHashUint64(h hash.Hash64, x uint64) {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, x)
+	h.Write(buf)
+}
+
 // Compare non-recursively compares e to other. It does not check
 // the child nodes since they can be a Node with any underlying type.
 // If you want to compare the parent and children fields, use CompareNodes.
@@ -132,18 +462,31 @@ func (e *Element) Compare(other *Element, compareAttrs bool) (bool, string) {
 	if e.Name != other.Name {
 		return false, fmt.Sprintf("e.Name was %s but other.Name was %s", e.Name, other.Name)
 	}
+	if e.Namespace != other.Namespace {
+		return false, fmt.Sprintf("e.Namespace was %q but other.Namespace was %q", e.Namespace, other.Namespace)
+	}
 	if !compareAttrs {
 		return true, ""
 	}
-	attrs := e.Attrs
-	otherAttrs := other.Attrs
+	// The attributes are compared the way the browser would store them, so
+	// the order, the case of html attribute names, and any duplicates after
+	// the first do not matter. Neither do the values of boolean attributes.
+	attrs := normalizeAttrs(e.Attrs, e.Namespace)
+	otherAttrs := normalizeAttrs(other.Attrs, other.Namespace)
 	if len(attrs) != len(otherAttrs) {
 		return false, fmt.Sprintf("n has %d attrs but other has %d attrs.", len(attrs), len(otherAttrs))
 	}
-	for i, attr := range attrs {
-		otherAttr := otherAttrs[i]
-		if attr != otherAttr {
-			return false, fmt.Sprintf("e.Attrs[%d] was %s but other.Attrs[%d] was %s", i, attr, i, otherAttr)
+	otherValues := map[string]string{}
+	for _, otherAttr := range otherAttrs {
+		otherValues[otherAttr.Name] = otherAttr.Value
+	}
+	for _, attr := range attrs {
+		otherValue, found := otherValues[attr.Name]
+		if !found {
+			return false, fmt.Sprintf("e has attr %s but other does not", attr.Name)
+		}
+		if !attrValuesEqual(e.Namespace, attr.Name, attr.Value, otherValue) {
+			return false, fmt.Sprintf("e attr %s was %q but other attr %s was %q", attr.Name, attr.Value, attr.Name, otherValue)
 		}
 	}
 	return true, ""
@@ -155,6 +498,7 @@ type Text struct {
 	Value  []byte
 	parent *Element
 	index  []int
+	pos    Pos
 }
 
 func (t *Text) Parent() *Element {
@@ -174,6 +518,10 @@ func (t *Text) Index() []int {
 	return t.index
 }
 
+func (t *Text) Pos() Pos {
+	return t.pos
+}
+
 // Compare non-recursively compares t to other. It does not check
 // the child nodes since they can be a Node with any underlying type.
 // If you want to compare the parent and children fields, use CompareNodes.
@@ -190,6 +538,7 @@ type Comment struct {
 	Value  []byte
 	parent *Element
 	index  []int
+	pos    Pos
 }
 
 func (c *Comment) Parent() *Element {
@@ -213,6 +562,10 @@ func (c *Comment) Index() []int {
 	return c.index
 }
 
+func (c *Comment) Pos() Pos {
+	return c.pos
+}
+
 // Compare non-recursively compares c to other. It does not check
 // the child nodes since they can be a Node with any underlying type.
 // If you want to compare the parent and children fields, use CompareNodes.
@@ -223,6 +576,99 @@ func (c *Comment) Compare(other *Comment) (bool, string) {
 	return true, ""
 }
 
+// Doctype is a document type declaration, e.g. <!DOCTYPE html>. Name is
+// the name of the root element, which is html for html documents. The
+// PublicID and SystemID are only used by older doctypes, e.g. for xhtml.
+type Doctype struct {
+	Name     string
+	PublicID string
+	SystemID string
+	parent   *Element
+	index    []int
+	pos      Pos
+}
+
+func (d *Doctype) Parent() *Element {
+	return d.parent
+}
+
+func (d *Doctype) Children() []Node {
+	// A doctype can't have any children
+	return nil
+}
+
+func (d *Doctype) HTML() []byte {
+	result := "<!DOCTYPE " + d.Name
+	if d.PublicID != "" {
+		result += ` PUBLIC "` + d.PublicID + `"`
+		if d.SystemID != "" {
+			result += ` "` + d.SystemID + `"`
+		}
+	} else if d.SystemID != "" {
+		result += ` SYSTEM "` + d.SystemID + `"`
+	}
+	return []byte(result + ">")
+}
+
+func (d *Doctype) Index() []int {
+	return d.index
+}
+
+func (d *Doctype) Pos() Pos {
+	return d.pos
+}
+
+// Compare compares d to other.
+func (d *Doctype) Compare(other *Doctype) (bool, string) {
+	if d.Name != other.Name || d.PublicID != other.PublicID || d.SystemID != other.SystemID {
+		return false, fmt.Sprintf("d was %s but other was %s", d.HTML(), other.HTML())
+	}
+	return true, ""
+}
+
+// CDATA is a CDATA section of the form <![CDATA[ value ]]> inside of svg or
+// mathml. Value does not include the <![CDATA[ and ]]> markers. There are no
+// CDATA sections in the actual DOM of an html document, so it is a text node
+// with the same value there.
+type CDATA struct {
+	Value  []byte
+	parent *Element
+	index  []int
+	pos    Pos
+}
+
+func (c *CDATA) Parent() *Element {
+	return c.parent
+}
+
+func (c *CDATA) Children() []Node {
+	// A CDATA section can't have any children
+	return nil
+}
+
+func (c *CDATA) HTML() []byte {
+	result := []byte("<![CDATA[")
+	result = append(result, c.Value...)
+	result = append(result, []byte("]]>")...)
+	return result
+}
+
+func (c *CDATA) Index() []int {
+	return c.index
+}
+
+func (c *CDATA) Pos() Pos {
+	return c.pos
+}
+
+// Compare non-recursively compares c to other.
+func (c *CDATA) Compare(other *CDATA) (bool, string) {
+	if string(c.Value) != string(other.Value) {
+		return false, fmt.Sprintf("c.Value was %s but other.Value was %s", string(c.Value), string(other.Value))
+	}
+	return true, ""
+}
+
 // Compare recursively compares t to other. It returns false and a detailed
 // message if n does not equal other. Otherwise, it returns true and an empty
 // string. NOTE: Comare never checks the parent properties of t's
@@ -269,6 +715,14 @@ func CompareNodes(n Node, other Node, compareAttrs bool) (bool, string) {
 		if match, msg := comment.Compare(otherComment); !match {
 			return false, msg
 		}
+	case *Doctype:
+		if match, msg := n.(*Doctype).Compare(other.(*Doctype)); !match {
+			return false, msg
+		}
+	case *CDATA:
+		if match, msg := n.(*CDATA).Compare(other.(*CDATA)); !match {
+			return false, msg
+		}
 	default:
 		return false, fmt.Sprintf("Don't know how to compare n of underlying type %T", n)
 	}